@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/hajimehoshi/go2cpp/gowasm2cpp"
+)
+
+func check(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	flagJSON := fs.Bool("json", false, "Output in JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s check [flags] file.wasm\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	diags, err := gowasm2cpp.Check(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *flagJSON {
+		if diags == nil {
+			diags = []*gowasm2cpp.Diagnostic{}
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(diags); err != nil {
+			return err
+		}
+	} else {
+		if err := writeDiagnostics(os.Stdout, diags); err != nil {
+			return err
+		}
+	}
+
+	if len(diags) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func writeDiagnostics(w io.Writer, diags []*gowasm2cpp.Diagnostic) error {
+	for _, d := range diags {
+		fmt.Fprintln(w, d.Error())
+	}
+	if len(diags) == 0 {
+		return nil
+	}
+
+	type key struct {
+		opcode string
+		reason string
+	}
+	type summary struct {
+		key
+		count int
+		funcs map[int]struct{}
+	}
+	summaries := map[key]*summary{}
+	funcs := map[int]struct{}{}
+	for _, d := range diags {
+		k := key{d.Opcode, d.Reason}
+		s, ok := summaries[k]
+		if !ok {
+			s = &summary{
+				key:   k,
+				funcs: map[int]struct{}{},
+			}
+			summaries[k] = s
+		}
+		s.count++
+		s.funcs[d.FuncIndex] = struct{}{}
+		funcs[d.FuncIndex] = struct{}{}
+	}
+	var ss []*summary
+	for _, s := range summaries {
+		ss = append(ss, s)
+	}
+	sort.Slice(ss, func(a, b int) bool {
+		if ss[a].count != ss[b].count {
+			return ss[a].count > ss[b].count
+		}
+		if ss[a].opcode != ss[b].opcode {
+			return ss[a].opcode < ss[b].opcode
+		}
+		return ss[a].reason < ss[b].reason
+	})
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "count\tfuncs\topcode\treason\n")
+	for _, s := range ss {
+		op := s.opcode
+		if op == "" {
+			op = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", s.count, len(s.funcs), op, s.reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%d unsupported constructs in %d functions\n", len(diags), len(funcs))
+	return nil
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hajimehoshi/go2cpp/gowasm2cpp"
+)
+
+func inspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	flagJSON := fs.Bool("json", false, "Output in JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s inspect [flags] file.wasm\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	info, err := gowasm2cpp.Inspect(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *flagJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(info)
+	}
+	return writeModuleInfo(os.Stdout, info)
+}
+
+func writeModuleInfo(w io.Writer, info *gowasm2cpp.ModuleInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Target: %s (%s)\n", info.Target, info.ABI)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "Imports (%d):\n", len(info.Imports))
+	for _, i := range info.Imports {
+		impl := "implemented"
+		switch {
+		case i.Host:
+			impl = "host"
+		case !i.Implemented:
+			impl = "NOT IMPLEMENTED"
+		}
+		fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\n", i.Index, i.Module, i.Field, impl)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "Exports (%d):\n", len(info.Exports))
+	for _, e := range info.Exports {
+		fmt.Fprintf(tw, "  %s\t%s\t%d\n", e.Name, e.Kind, e.Index)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "Functions (%d, including %d imports):\n", info.NumFuncs, len(info.Imports))
+	fmt.Fprintf(tw, "  index\tsize\tlocals\tname\n")
+	var unsupported []gowasm2cpp.FuncInfo
+	for _, f := range info.Funcs {
+		name := f.Name
+		if f.Special {
+			name += " (special)"
+		}
+		fmt.Fprintf(tw, "  %d\t%d\t%d\t%s\n", f.Index, f.BodySize, f.NumLocals, name)
+		if f.Unsupported != "" {
+			unsupported = append(unsupported, f)
+		}
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "Unsupported functions (%d):\n", len(unsupported))
+	for _, f := range unsupported {
+		fmt.Fprintf(tw, "  %d\t%s\t%s\n", f.Index, f.Name, f.Unsupported)
+	}
+
+	return tw.Flush()
+}
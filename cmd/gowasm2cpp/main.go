@@ -13,14 +13,49 @@ import (
 )
 
 var (
-	flagOut       = flag.String("out", ".", "Output directory")
-	flagInclude   = flag.String("include", "", "Include path")
-	flagWasm      = flag.String("wasm", "", "WebAssembly file generated by Go")
-	flagNamespace = flag.String("namespace", "", "Namespace")
-	flagProfile   = flag.Bool("profile", false, "Take profiles")
+	flagOut              = flag.String("out", ".", "Output directory")
+	flagInclude          = flag.String("include", "", "Include path")
+	flagWasm             = flag.String("wasm", "", "WebAssembly file generated by Go (.wasm, or .wat for the text format)")
+	flagNamespace        = flag.String("namespace", "", "Namespace")
+	flagProfile          = flag.Bool("profile", false, "Take profiles")
+	flagInterp           = flag.Bool("interp", false, "Execute functions that cannot be translated with an embedded interpreter")
+	flagCrash            = flag.Bool("crash-handler", false, "Print Go stack traces on crashes")
+	flagAnnotate         = flag.Bool("annotate", false, "Annotate the generated code with the original Wasm instructions")
+	flagRuntimeNamespace = flag.String("runtime-namespace", "", "Namespace of the runtime generated by the runtime command. If empty, the runtime is generated with the program")
+	flagRuntimeInclude   = flag.String("runtime-include", "", "Include path of the runtime generated by the runtime command")
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			if err := check(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "inspect":
+			if err := inspect(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "report":
+			if err := report(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "runtime":
+			if err := runtime(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "spectest":
+			if err := specTest(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	flag.Parse()
 	if *flagProfile {
 		defer profile.Start().Stop()
@@ -29,7 +64,14 @@ func main() {
 	if err := os.MkdirAll(*flagOut, 0755); err != nil {
 		log.Fatal(err)
 	}
-	if err := gowasm2cpp.Generate(*flagOut, *flagInclude, *flagWasm, *flagNamespace); err != nil {
+	if err := gowasm2cpp.GenerateWithOptions(*flagOut, *flagInclude, *flagWasm, *flagNamespace, &gowasm2cpp.Options{
+		Interpreter:  *flagInterp,
+		CrashHandler: *flagCrash,
+		Annotate:     *flagAnnotate,
+
+		RuntimeNamespace: *flagRuntimeNamespace,
+		RuntimeInclude:   *flagRuntimeInclude,
+	}); err != nil {
 		log.Fatal(err)
 	}
 }
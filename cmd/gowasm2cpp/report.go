@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hajimehoshi/go2cpp/gowasm2cpp"
+)
+
+func report(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	flagJSON := fs.Bool("json", false, "Output in JSON")
+	flagTop := fs.Int("top", 50, "Number of symbols to show (0 to show all)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s report [flags] file.wasm\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r, err := gowasm2cpp.Report(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *flagJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(r)
+	}
+	return writeSizeReport(os.Stdout, r, *flagTop)
+}
+
+func writeSizeReport(w io.Writer, r *gowasm2cpp.SizeReport, top int) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+
+	var total gowasm2cpp.PackageSize
+	fmt.Fprintf(tw, "cpp bytes\tcpp lines\twasm bytes\tfuncs\t\tpackage\n")
+	for _, p := range r.Packages {
+		name := p.Package
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t\t%s\n", p.CppBytes, p.CppLines, p.WasmBytes, p.NumFuncs, name)
+		total.CppBytes += p.CppBytes
+		total.CppLines += p.CppLines
+		total.WasmBytes += p.WasmBytes
+		total.NumFuncs += p.NumFuncs
+	}
+	fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t\t(total)\n", total.CppBytes, total.CppLines, total.WasmBytes, total.NumFuncs)
+	fmt.Fprintln(tw, "\t\t\t\t\t")
+
+	syms := r.Symbols
+	if top > 0 && len(syms) > top {
+		syms = syms[:top]
+	}
+	fmt.Fprintf(tw, "cpp bytes\tcpp lines\twasm bytes\t\t\tsymbol\n")
+	for _, s := range syms {
+		name := s.Name
+		if s.Unsupported {
+			name += " (unsupported)"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t\t\t%s\n", s.CppBytes, s.CppLines, s.WasmBytes, name)
+	}
+	fmt.Fprintln(tw, "\t\t\t\t\t")
+
+	fmt.Fprintf(tw, "cpp bytes\t\twasm bytes\tsegments\t\tdata\n")
+	fmt.Fprintf(tw, "%d\t\t%d\t%d\t\t(initial_data_)\n", r.Data.CppBytes, r.Data.WasmBytes, len(r.Data.Segments))
+
+	return tw.Flush()
+}
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hajimehoshi/go2cpp/gowasm2cpp"
+)
+
+func runtime(args []string) error {
+	fs := flag.NewFlagSet("runtime", flag.ExitOnError)
+	flagOut := fs.String("out", ".", "Output directory")
+	flagNamespace := fs.String("namespace", "", "Namespace of the runtime")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s runtime [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *flagNamespace == "" || fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := os.MkdirAll(*flagOut, 0755); err != nil {
+		return err
+	}
+	return gowasm2cpp.GenerateRuntime(*flagOut, *flagNamespace)
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hajimehoshi/go2cpp/internal/spectest"
+)
+
+func specTest(args []string) error {
+	fs := flag.NewFlagSet("spectest", flag.ExitOnError)
+	flagJSON := fs.Bool("json", false, "Output in JSON")
+	flagInterp := fs.Bool("interp", false, "Execute functions that cannot be translated with an embedded interpreter")
+	flagVerbose := fs.Bool("v", false, "Print the failed assertions")
+	flagTimeout := fs.Duration("timeout", 5*time.Second, "Time limit of each assertion")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s spectest [flags] file.wast...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var r spectest.Result
+	for _, f := range fs.Args() {
+		r2, err := spectest.Run(f, &spectest.Options{
+			Interpreter: *flagInterp,
+			Timeout:     *flagTimeout,
+		})
+		if err != nil {
+			return err
+		}
+		r.Add(r2)
+	}
+
+	if *flagJSON {
+		if r.Groups == nil {
+			r.Groups = []*spectest.Group{}
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(r); err != nil {
+			return err
+		}
+	} else {
+		if err := writeSpecTestResult(os.Stdout, &r, *flagVerbose); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range r.Groups {
+		if g.Failed > 0 {
+			os.Exit(1)
+		}
+	}
+	return nil
+}
+
+func writeSpecTestResult(w io.Writer, r *spectest.Result, verbose bool) error {
+	if verbose {
+		for _, g := range r.Groups {
+			for _, f := range g.Failures {
+				fmt.Fprintln(w, f)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	var total spectest.Group
+	fmt.Fprintf(tw, "passed\tfailed\tskipped\t\tgroup\n")
+	for _, g := range r.Groups {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t\t%s\n", g.Passed, g.Failed, g.Skipped, g.Name)
+		total.Passed += g.Passed
+		total.Failed += g.Failed
+		total.Skipped += g.Skipped
+	}
+	fmt.Fprintf(tw, "%d\t%d\t%d\t\t(total)\n", total.Passed, total.Failed, total.Skipped)
+	return tw.Flush()
+}
@@ -0,0 +1,7 @@
+// SPDX-License-Identifier: Apache-2.0
+
+#include "autogen/wasi.h"
+
+int main(int argc, char** argv) {
+  return go2cpp_autogen::Main(argc, argv);
+}
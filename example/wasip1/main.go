@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// +build example
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("Hello, WASI!")
+	fmt.Println("Args:", os.Args[1:])
+
+	wd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	es, err := os.ReadDir(wd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, e := range es {
+		fmt.Println(e.Name())
+	}
+}
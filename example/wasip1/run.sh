@@ -0,0 +1,7 @@
+set -e
+env GOOS=wasip1 GOARCH=wasm go build -tags example -o wasip1.wasm -trimpath .
+rm -rf autogen *.o
+# Go 1.21 and later use post-MVP operators that only the interpreter can execute.
+go run ../../cmd/gowasm2cpp -out autogen -include autogen -wasm wasip1.wasm -namespace go2cpp_autogen -interp
+clang++ -O3 -Wall -std=c++14 -pthread -I. -o wasip1 -g *.cpp autogen/*.cpp
+./wasip1 foo bar
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-interpreter/wagon/disasm"
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// instrString returns a text representation of the instruction like the WebAssembly text format.
+func instrString(instr disasm.Instr) string {
+	name := instr.Op.Name
+	if strings.Contains(name, ".load") || strings.Contains(name, ".store") {
+		// The immediates are the alignment in log2 and the offset.
+		return fmt.Sprintf("%s offset=%d align=%d", name, instr.Immediates[1], 1<<instr.Immediates[0].(uint32))
+	}
+
+	strs := []string{name}
+	for _, imm := range instr.Immediates {
+		if t, ok := imm.(wasm.BlockType); ok {
+			if t == wasm.BlockTypeEmpty {
+				continue
+			}
+			strs = append(strs, fmt.Sprintf("(result %s)", wasm.ValueType(t)))
+			continue
+		}
+		strs = append(strs, fmt.Sprint(imm))
+	}
+	return strings.Join(strs, " ")
+}
+
+// annotation returns a comment line for the instruction at the given offset.
+// offset is -1 when unknown.
+func annotation(offset int, instr disasm.Instr) string {
+	if offset < 0 {
+		return "// " + instrString(instr)
+	}
+	return fmt.Sprintf("// 0x%x: %s", offset, instrString(instr))
+}
+
+func isCommentLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "//")
+}
+
+// ignoringComments applies the pass to the lines except for comment-only lines.
+// The pass must keep the number of lines.
+func ignoringComments(body []string, pass func([]string) []string) []string {
+	var code []string
+	for _, l := range body {
+		if !isCommentLine(l) {
+			code = append(code, l)
+		}
+	}
+	if len(code) == len(body) {
+		return pass(body)
+	}
+
+	code = pass(code)
+	r := make([]string, 0, len(body))
+	for _, l := range body {
+		if isCommentLine(l) {
+			r = append(r, l)
+			continue
+		}
+		r = append(r, code[0])
+		code = code[1:]
+	}
+	return r
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIgnoringComments(t *testing.T) {
+	body := []string{
+		"  if (x) {",
+		"    // 0x10: br 1",
+		"    goto label1;",
+		"  }",
+		"  // 0x12: end",
+		"label0:;",
+		"  // main.go:10",
+		"  return 1;",
+	}
+	var got []string
+	r := ignoringComments(body, func(lines []string) []string {
+		got = append([]string{}, lines...)
+		lines[0] = "  A"
+		lines[len(lines)-1] = "  B"
+		return lines
+	})
+
+	wantPass := []string{
+		"  if (x) {",
+		"    goto label1;",
+		"  }",
+		"label0:;",
+		"  return 1;",
+	}
+	if !reflect.DeepEqual(got, wantPass) {
+		t.Errorf("ignoringComments: the pass got: %v, want: %v", got, wantPass)
+	}
+
+	want := []string{
+		"  A",
+		"    // 0x10: br 1",
+		"    goto label1;",
+		"  }",
+		"  // 0x12: end",
+		"label0:;",
+		"  // main.go:10",
+		"  B",
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("ignoringComments: got: %v, want: %v", r, want)
+	}
+}
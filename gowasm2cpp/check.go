@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Diagnostic describes a construct that cannot be converted to C++.
+type Diagnostic struct {
+	Func      string `json:"func"`
+	FuncIndex int    `json:"funcIndex"`
+
+	// Offset is the byte offset of the instruction in the function body, or -1 if unknown.
+	Offset int `json:"offset"`
+
+	// Opcode is the name of the instruction, or empty if unknown.
+	Opcode string `json:"opcode,omitempty"`
+
+	Reason string `json:"reason"`
+}
+
+func (d *Diagnostic) Error() string {
+	loc := d.Func
+	if d.Offset >= 0 {
+		loc = fmt.Sprintf("%s+%#x", d.Func, d.Offset)
+	}
+	if d.Opcode != "" {
+		return fmt.Sprintf("%s: %s: %s", loc, d.Opcode, d.Reason)
+	}
+	return fmt.Sprintf("%s: %s", loc, d.Reason)
+}
+
+func (f *wasmFunc) newDiagnostic(offset int, opcode string, reason string) *Diagnostic {
+	return &Diagnostic{
+		Func:      f.Wasm.Name,
+		FuncIndex: f.Index,
+		Offset:    offset,
+		Opcode:    opcode,
+		Reason:    reason,
+	}
+}
+
+// Check converts all the functions in the given Wasm file in memory and returns all the constructs that cannot be converted.
+//
+// Check doesn't stop at the first unsupported construct.
+// The diagnostics are sorted by the function indices and the offsets.
+func Check(wasmFile string) ([]*Diagnostic, error) {
+	m, err := loadModule(wasmFile)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]*Diagnostic, len(m.fs))
+	var g errgroup.Group
+	for i, f := range m.fs {
+		if f.Wasm.Body == nil || f.BodyStr != "" {
+			continue
+		}
+		i, f := i, f
+		g.Go(func() error {
+			results[i] = f.diagnose()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	var diags []*Diagnostic
+	for i, f := range m.ifs {
+		if f.BodyStr != "" {
+			continue
+		}
+		e := m.mod.Import.Entries[i]
+		diags = append(diags, f.newDiagnostic(-1, "", fmt.Sprintf("unknown import %s for %s", importKey{module: e.ModuleName, field: e.FieldName}, m.imports.name)))
+	}
+	for _, r := range results {
+		diags = append(diags, r...)
+	}
+	sort.SliceStable(diags, func(a, b int) bool {
+		if diags[a].FuncIndex != diags[b].FuncIndex {
+			return diags[a].FuncIndex < diags[b].FuncIndex
+		}
+		return diags[a].Offset < diags[b].Offset
+	})
+	return diags, nil
+}
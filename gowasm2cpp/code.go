@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/go-interpreter/wagon/wasm/leb128"
+	"github.com/go-interpreter/wagon/wasm/operators"
+)
+
+// postMVPOpNames is the names of the operators that are not in the WebAssembly MVP.
+// The disassembler doesn't know them.
+var postMVPOpNames = map[byte]string{
+	0xc0: "i32.extend8_s",
+	0xc1: "i32.extend16_s",
+	0xc2: "i64.extend8_s",
+	0xc3: "i64.extend16_s",
+	0xc4: "i64.extend32_s",
+}
+
+// prefixedOpNames is the names of the operators prefixed by 0xfc.
+var prefixedOpNames = map[uint32]string{
+	0:  "i32.trunc_sat_f32_s",
+	1:  "i32.trunc_sat_f32_u",
+	2:  "i32.trunc_sat_f64_s",
+	3:  "i32.trunc_sat_f64_u",
+	4:  "i64.trunc_sat_f32_s",
+	5:  "i64.trunc_sat_f32_u",
+	6:  "i64.trunc_sat_f64_s",
+	7:  "i64.trunc_sat_f64_u",
+	8:  "memory.init",
+	9:  "data.drop",
+	10: "memory.copy",
+	11: "memory.fill",
+}
+
+type invalidOpcodeError struct {
+	Offset int
+	Name   string
+}
+
+func (e *invalidOpcodeError) Error() string {
+	return fmt.Sprintf("%s is not supported by the disassembler", e.Name)
+}
+
+// prefixedOpImmediates is the number of LEB128 immediates of the operators prefixed by 0xfc.
+var prefixedOpImmediates = map[uint32]int{
+	8:  2,
+	9:  1,
+	10: 2,
+	11: 1,
+}
+
+func readInvalidOpcode(r *bytes.Reader, offset int, code byte) error {
+	if name, ok := postMVPOpNames[code]; ok {
+		return &invalidOpcodeError{
+			Offset: offset,
+			Name:   name,
+		}
+	}
+	if code == 0xfc {
+		sub, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return err
+		}
+		name, ok := prefixedOpNames[sub]
+		if !ok {
+			name = fmt.Sprintf("0xfc %d", sub)
+		}
+		for i := 0; i < prefixedOpImmediates[sub]; i++ {
+			if _, err := leb128.ReadVarUint32(r); err != nil {
+				return err
+			}
+		}
+		return &invalidOpcodeError{
+			Offset: offset,
+			Name:   name,
+		}
+	}
+	return &invalidOpcodeError{
+		Offset: offset,
+		Name:   fmt.Sprintf("opcode %#x", code),
+	}
+}
+
+// instrOffsets returns the byte offsets of the instructions in the function body.
+//
+// As disasm.NewDisassembly drops unreachable instructions, instrOffsets also skips them.
+// Then, the i-th offset corresponds to the i-th instruction of the disassembly.
+//
+// If the body includes an invalid opcode, instrOffsets returns an *invalidOpcodeError.
+func instrOffsets(code []byte) ([]int, error) {
+	r := bytes.NewReader(code)
+
+	// polymorphic represents whether each block has an instruction that makes the rest of the block unreachable.
+	polymorphic := []bool{false}
+	// unreachableDepth is the number of nested blocks in an unreachable region.
+	unreachableDepth := 0
+
+	var offsets []int
+	for {
+		offset := len(code) - r.Len()
+		op, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := operators.New(op); err != nil {
+			return nil, readInvalidOpcode(r, offset, op)
+		}
+		if err := skipImmediates(r, op); err != nil {
+			return nil, err
+		}
+
+		if unreachableDepth > 0 || polymorphic[len(polymorphic)-1] {
+			switch op {
+			case operators.Block, operators.Loop, operators.If:
+				unreachableDepth++
+			case operators.Else:
+				if unreachableDepth == 0 {
+					polymorphic[len(polymorphic)-1] = false
+					offsets = append(offsets, offset)
+				}
+			case operators.End:
+				if unreachableDepth > 0 {
+					unreachableDepth--
+					continue
+				}
+				polymorphic = polymorphic[:len(polymorphic)-1]
+				offsets = append(offsets, offset)
+			}
+			continue
+		}
+
+		switch op {
+		case operators.Block, operators.Loop, operators.If:
+			polymorphic = append(polymorphic, false)
+		case operators.Else:
+			polymorphic[len(polymorphic)-1] = false
+		case operators.End:
+			polymorphic = polymorphic[:len(polymorphic)-1]
+		case operators.Unreachable, operators.Br, operators.BrTable, operators.Return:
+			polymorphic[len(polymorphic)-1] = true
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
+
+// invalidOpcodes returns all the opcodes in the function body that the disassembler doesn't know.
+//
+// invalidOpcodes stops at an opcode whose immediates are unknown.
+func invalidOpcodes(code []byte) []*invalidOpcodeError {
+	r := bytes.NewReader(code)
+
+	var errs []*invalidOpcodeError
+	for {
+		offset := len(code) - r.Len()
+		op, err := r.ReadByte()
+		if err != nil {
+			return errs
+		}
+		if _, err := operators.New(op); err == nil {
+			if err := skipImmediates(r, op); err != nil {
+				return errs
+			}
+			continue
+		}
+		e, ok := readInvalidOpcode(r, offset, op).(*invalidOpcodeError)
+		if !ok {
+			return errs
+		}
+		errs = append(errs, e)
+		if _, ok := postMVPOpNames[op]; !ok && op != 0xfc {
+			return errs
+		}
+	}
+}
+
+func skipImmediates(r *bytes.Reader, op byte) error {
+	var n int
+	switch op {
+	case operators.Block, operators.Loop, operators.If, operators.CurrentMemory, operators.GrowMemory:
+		if _, err := wasm.ReadByte(r); err != nil {
+			return err
+		}
+	case operators.Br, operators.BrIf, operators.Call, operators.GetLocal, operators.SetLocal, operators.TeeLocal, operators.GetGlobal, operators.SetGlobal:
+		n = 1
+	case operators.CallIndirect:
+		if _, err := leb128.ReadVarUint32(r); err != nil {
+			return err
+		}
+		if _, err := wasm.ReadByte(r); err != nil {
+			return err
+		}
+	case operators.BrTable:
+		c, err := leb128.ReadVarUint32(r)
+		if err != nil {
+			return err
+		}
+		// The targets and the default target.
+		n = int(c) + 1
+	case operators.I32Const:
+		if _, err := leb128.ReadVarint32(r); err != nil {
+			return err
+		}
+	case operators.I64Const:
+		if _, err := leb128.ReadVarint64(r); err != nil {
+			return err
+		}
+	case operators.F32Const:
+		if _, err := r.Seek(4, io.SeekCurrent); err != nil {
+			return err
+		}
+	case operators.F64Const:
+		if _, err := r.Seek(8, io.SeekCurrent); err != nil {
+			return err
+		}
+	case operators.I32Load, operators.I64Load, operators.F32Load, operators.F64Load,
+		operators.I32Load8s, operators.I32Load8u, operators.I32Load16s, operators.I32Load16u,
+		operators.I64Load8s, operators.I64Load8u, operators.I64Load16s, operators.I64Load16u, operators.I64Load32s, operators.I64Load32u,
+		operators.I32Store, operators.I64Store, operators.F32Store, operators.F64Store,
+		operators.I32Store8, operators.I32Store16, operators.I64Store8, operators.I64Store16, operators.I64Store32:
+		// Alignment and offset.
+		n = 2
+	}
+	for i := 0; i < n; i++ {
+		if _, err := leb128.ReadVarUint32(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
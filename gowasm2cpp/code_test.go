@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInvalidOpcodes(t *testing.T) {
+	code := []byte{
+		0x20, 0x00, // local.get 0
+		0xc4,       // i64.extend32_s
+		0x41, 0x7f, // i32.const -1
+		0xfc, 0x0a, 0x00, 0x00, // memory.copy
+		0xfc, 0x0b, 0x00, // memory.fill
+		0x1a, // drop
+		0x0b, // end
+	}
+	var got []invalidOpcodeError
+	for _, e := range invalidOpcodes(code) {
+		got = append(got, *e)
+	}
+	want := []invalidOpcodeError{
+		{Offset: 2, Name: "i64.extend32_s"},
+		{Offset: 5, Name: "memory.copy"},
+		{Offset: 9, Name: "memory.fill"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("invalidOpcodes: got: %v, want: %v", got, want)
+	}
+}
+
+func TestInstrOffsets(t *testing.T) {
+	code := []byte{
+		0x02, 0x40, // block
+		0x0c, 0x00, // br 0
+		0x41, 0x01, // i32.const 1 (unreachable)
+		0x1a, // drop (unreachable)
+		0x0b, // end
+		0x0b, // end
+	}
+	got, err := instrOffsets(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{0, 2, 7, 8}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("instrOffsets: got: %v, want: %v", got, want)
+	}
+}
+
+func TestCheckCollectsAllDiagnostics(t *testing.T) {
+	const src = `(module
+  (func $two (result i32 i32)
+    i32.const 1
+    i32.const 2)
+  (func $f (result i32)
+    (block (result i32)
+      (br 0 (i32.const 1)))
+    drop
+    call $two
+    drop
+    drop
+    f32.const 1
+    i32.reinterpret_f32))
+`
+	dir, err := ioutil.TempDir("", "gowasm2cpp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wasmFile := filepath.Join(dir, "check.wat")
+	if err := ioutil.WriteFile(wasmFile, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diags, err := Check(wasmFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type diag struct {
+		FuncIndex int
+		Opcode    string
+		Reason    string
+	}
+	var got []diag
+	for _, d := range diags {
+		got = append(got, diag{FuncIndex: d.FuncIndex, Opcode: d.Opcode, Reason: d.Reason})
+	}
+	want := []diag{
+		{FuncIndex: 0, Opcode: "", Reason: "unexpected num of return types: 2"},
+		{FuncIndex: 1, Opcode: "block", Reason: "block with a returning value is not implemented yet"},
+		{FuncIndex: 1, Opcode: "call", Reason: "unexpected num of return types: 2"},
+		{FuncIndex: 1, Opcode: "i32.reinterpret/f32", Reason: "not implemented yet"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check: got: %v, want: %v", got, want)
+	}
+}
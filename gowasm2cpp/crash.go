@@ -0,0 +1,480 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+type crashFunc struct {
+	Name   string
+	PCs    int
+	NumPCs int
+}
+
+type crashPC struct {
+	SPDelta int
+	File    int
+	Line    int
+}
+
+// cppStringLiteral returns a C++ string literal of str.
+func cppStringLiteral(str string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f || c == '?':
+			// Use octal escapes since hexadecimal escapes don't have a length limit. '?' is escaped to avoid trigraphs.
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func writeCrash(dir string, incpath string, namespace string, fs []*wasmFunc) error {
+	{
+		f, err := os.Create(filepath.Join(dir, "crash.h"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err := crashHTmpl.Execute(f, struct {
+			IncludeGuard string
+			Namespace    string
+		}{
+			IncludeGuard: includeGuard(namespace) + "_CRASH_H",
+			Namespace:    namespace,
+		}); err != nil {
+			return err
+		}
+	}
+	{
+		f, err := os.Create(filepath.Join(dir, "crash.cpp"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var files []string
+		fileIndices := map[string]int{}
+		// funcs is indexed by the function index without imports.
+		funcs := make([]crashFunc, len(fs))
+		var pcs []crashPC
+		for _, f := range fs {
+			funcs[f.Index-len(f.Mod.Import.Entries)] = crashFunc{
+				Name:   cppStringLiteral(f.Wasm.Name),
+				PCs:    len(pcs),
+				NumPCs: len(f.PCs),
+			}
+			for _, pc := range f.PCs {
+				file := -1
+				if pc.Pos.File != "" {
+					idx, ok := fileIndices[pc.Pos.File]
+					if !ok {
+						idx = len(files)
+						fileIndices[pc.Pos.File] = idx
+						files = append(files, cppStringLiteral(pc.Pos.File))
+					}
+					file = idx
+				}
+				pcs = append(pcs, crashPC{
+					SPDelta: pc.SPDelta,
+					File:    file,
+					Line:    pc.Pos.Line,
+				})
+			}
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("the crash handler requires the line table of Go functions but not found")
+		}
+
+		if err := crashCppTmpl.Execute(f, struct {
+			IncludePath     string
+			Namespace       string
+			FuncValueOffset int
+			Files           []string
+			Funcs           []crashFunc
+			PCs             []crashPC
+		}{
+			IncludePath:     incpath,
+			Namespace:       namespace,
+			FuncValueOffset: funcValueOffset,
+			Files:           files,
+			Funcs:           funcs,
+			PCs:             pcs,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var crashHTmpl = template.Must(template.New("crash.h").Parse(`// Code generated by go2cpp. DO NOT EDIT.
+
+#ifndef {{.IncludeGuard}}
+#define {{.IncludeGuard}}
+
+namespace {{.Namespace}} {
+
+class Inst;
+class Mem;
+
+// InstallCrashHandler installs signal handlers that print the Go stack trace on crashes. The previous handlers are
+// invoked after the stack trace is printed.
+//
+// The stack trace is printed for the instance of the innermost CrashHandlerScope on the crashing thread. Multiple
+// instances can be installed, and they can run on the same thread.
+void InstallCrashHandler(Inst* inst, Mem* mem);
+
+// UninstallCrashHandler unregisters the instance. The signal handlers are restored when all the instances are
+// unregistered. UninstallCrashHandler does nothing if the instance is not installed.
+void UninstallCrashHandler(Inst* inst);
+
+// CrashHandlerScope makes the instance the one whose stack trace is printed on crashes of the current thread while
+// the scope is alive. Create the scope whenever the instance runs Go code. Scopes can be nested, e.g. when a host
+// function called by an instance runs another instance, and the previous instance is restored at the end of the scope.
+class CrashHandlerScope {
+public:
+  CrashHandlerScope(Inst* inst, Mem* mem);
+  ~CrashHandlerScope();
+
+  CrashHandlerScope(const CrashHandlerScope&) = delete;
+  CrashHandlerScope& operator=(const CrashHandlerScope&) = delete;
+
+private:
+  Inst* prev_inst_;
+  Mem* prev_mem_;
+};
+
+// PrintGoStackTrace prints the Go stack trace of the instance to the file descriptor.
+// PrintGoStackTrace is async-signal-safe.
+void PrintGoStackTrace(int fd, Inst* inst, Mem* mem);
+
+}
+
+#endif  // {{.IncludeGuard}}
+`))
+
+var crashCppTmpl = template.Must(template.New("crash.cpp").Parse(`// Code generated by go2cpp. DO NOT EDIT.
+
+#include "{{.IncludePath}}crash.h"
+
+#include "{{.IncludePath}}inst.h"
+#include "{{.IncludePath}}mem.h"
+
+#include <algorithm>
+#include <csignal>
+#include <cstdint>
+#include <cstring>
+#include <mutex>
+#include <signal.h>
+#include <unistd.h>
+#include <vector>
+
+namespace {{.Namespace}} {
+
+namespace {
+
+struct PCInfo {
+  // sp_delta is the size of the stack frame, or -1 if unknown.
+  int32_t sp_delta;
+  // file is the index of kFiles, or -1 if unknown.
+  int32_t file;
+  int32_t line;
+};
+
+struct FuncInfo {
+  const char* name;
+  // pcs is the index of the first resume point in kPCs.
+  int32_t pcs;
+  int32_t num_pcs;
+};
+
+// PC_F of a function is kFuncValueOffset plus the function index without imports.
+constexpr uint64_t kFuncValueOffset = {{.FuncValueOffset}};
+
+// kMaxScanSize is the maximum size of the stack area to search for a return address.
+constexpr int64_t kMaxScanSize = 64 * 1024;
+
+constexpr int kMaxFrames = 100;
+
+const char* const kFiles[] = {
+{{range $value := .Files}}  {{$value}},
+{{end}}};
+
+const PCInfo kPCs[] = {
+{{range $value := .PCs}}  { {{- $value.SPDelta}}, {{$value.File}}, {{$value.Line -}} },
+{{end}}};
+
+const FuncInfo kFuncs[] = {
+{{range $value := .Funcs}}  { {{- $value.Name}}, {{$value.PCs}}, {{$value.NumPCs -}} },
+{{end}}};
+
+// SignalSafeWriter writes strings without allocating memory so that it can be used in signal handlers.
+class SignalSafeWriter {
+public:
+  explicit SignalSafeWriter(int fd)
+      : fd_{fd} {
+  }
+
+  ~SignalSafeWriter() {
+    Flush();
+  }
+
+  void Write(const char* str) {
+    for (; *str; str++) {
+      WriteChar(*str);
+    }
+  }
+
+  void WriteInt(int64_t v) {
+    if (v < 0) {
+      WriteChar('-');
+      v = -v;
+    }
+    WriteUint(static_cast<uint64_t>(v), 10);
+  }
+
+  void WriteHex(uint64_t v) {
+    Write("0x");
+    WriteUint(v, 16);
+  }
+
+  void Flush() {
+    size_t written = 0;
+    while (written < len_) {
+      ssize_t n = ::write(fd_, buf_ + written, len_ - written);
+      if (n <= 0) {
+        break;
+      }
+      written += n;
+    }
+    len_ = 0;
+  }
+
+private:
+  void WriteChar(char c) {
+    if (len_ == sizeof(buf_)) {
+      Flush();
+    }
+    buf_[len_] = c;
+    len_++;
+  }
+
+  void WriteUint(uint64_t v, int base) {
+    char digits[32];
+    int n = 0;
+    do {
+      digits[n] = "0123456789abcdef"[v % base];
+      n++;
+      v /= base;
+    } while (v);
+    while (n > 0) {
+      n--;
+      WriteChar(digits[n]);
+    }
+  }
+
+  int fd_;
+  char buf_[256];
+  size_t len_ = 0;
+};
+
+// LookupFunc returns the function that has the given PC, or nullptr if the PC is not valid.
+const FuncInfo* LookupFunc(uint64_t pc) {
+  uint64_t pc_f = pc >> 16;
+  if (pc_f < kFuncValueOffset || pc_f - kFuncValueOffset >= sizeof(kFuncs) / sizeof(kFuncs[0])) {
+    return nullptr;
+  }
+  const FuncInfo* f = &kFuncs[pc_f - kFuncValueOffset];
+  if ((pc & 0xffff) >= static_cast<uint64_t>(f->num_pcs)) {
+    return nullptr;
+  }
+  return f;
+}
+
+// FindReturnAddress searches the stack from addr for a value that looks like a return address.
+// FindReturnAddress returns -1 if not found.
+int64_t FindReturnAddress(Mem* mem, int64_t addr) {
+  int64_t mem_size = static_cast<int64_t>(mem->GetSize()) * Mem::kPageSize;
+  for (int64_t end = addr + kMaxScanSize; addr + 8 <= mem_size && addr < end; addr += 8) {
+    if (LookupFunc(static_cast<uint64_t>(mem->LoadInt64(addr)))) {
+      return addr;
+    }
+  }
+  return -1;
+}
+
+const char* SignalName(int sig) {
+  switch (sig) {
+  case SIGSEGV:
+    return "SIGSEGV: segmentation violation";
+  case SIGBUS:
+    return "SIGBUS: bus error";
+  case SIGFPE:
+    return "SIGFPE: floating-point exception";
+  case SIGILL:
+    return "SIGILL: illegal instruction";
+  case SIGABRT:
+    return "SIGABRT: abort";
+  }
+  return "unknown signal";
+}
+
+constexpr int kSignals[] = {SIGSEGV, SIGBUS, SIGFPE, SIGILL, SIGABRT};
+constexpr int kNumSignals = sizeof(kSignals) / sizeof(kSignals[0]);
+
+// t_inst and t_mem are the instance of the innermost CrashHandlerScope on the current thread. A signal caused by a
+// crash is delivered to the crashing thread.
+thread_local Inst* t_inst = nullptr;
+thread_local Mem* t_mem = nullptr;
+
+// g_mutex protects g_insts and g_old_actions.
+std::mutex g_mutex;
+std::vector<Inst*> g_insts;
+struct sigaction g_old_actions[kNumSignals];
+volatile sig_atomic_t g_handling = 0;
+
+void HandleSignal(int sig) {
+  if (!g_handling) {
+    g_handling = 1;
+    {
+      SignalSafeWriter w{STDERR_FILENO};
+      w.Write("[signal ");
+      w.Write(SignalName(sig));
+      w.Write("]\n\n");
+    }
+    if (t_inst && t_mem) {
+      PrintGoStackTrace(STDERR_FILENO, t_inst, t_mem);
+    }
+  }
+
+  // Invoke the previous handler.
+  for (int i = 0; i < kNumSignals; i++) {
+    if (kSignals[i] == sig) {
+      sigaction(sig, &g_old_actions[i], nullptr);
+      break;
+    }
+  }
+  raise(sig);
+}
+
+}
+
+void InstallCrashHandler(Inst* inst, Mem* mem) {
+  std::lock_guard<std::mutex> lock{g_mutex};
+  if (std::find(g_insts.begin(), g_insts.end(), inst) != g_insts.end()) {
+    return;
+  }
+  g_insts.push_back(inst);
+  if (g_insts.size() > 1) {
+    return;
+  }
+
+  struct sigaction action;
+  std::memset(&action, 0, sizeof(action));
+  action.sa_handler = HandleSignal;
+  sigemptyset(&action.sa_mask);
+  for (int i = 0; i < kNumSignals; i++) {
+    sigaction(kSignals[i], &action, &g_old_actions[i]);
+  }
+}
+
+void UninstallCrashHandler(Inst* inst) {
+  std::lock_guard<std::mutex> lock{g_mutex};
+  auto it = std::find(g_insts.begin(), g_insts.end(), inst);
+  if (it == g_insts.end()) {
+    return;
+  }
+  g_insts.erase(it);
+  if (!g_insts.empty()) {
+    return;
+  }
+  for (int i = 0; i < kNumSignals; i++) {
+    sigaction(kSignals[i], &g_old_actions[i], nullptr);
+  }
+}
+
+CrashHandlerScope::CrashHandlerScope(Inst* inst, Mem* mem)
+    : prev_inst_{t_inst},
+      prev_mem_{t_mem} {
+  t_inst = inst;
+  t_mem = mem;
+}
+
+CrashHandlerScope::~CrashHandlerScope() {
+  t_inst = prev_inst_;
+  t_mem = prev_mem_;
+}
+
+void PrintGoStackTrace(int fd, Inst* inst, Mem* mem) {
+  SignalSafeWriter w{fd};
+  w.Write("goroutine ? [running]:\n");
+
+  // The function running at the crash is unknown. Start from the first return address on the stack.
+  int64_t addr = FindReturnAddress(mem, static_cast<uint32_t>(inst->getsp()));
+  if (addr < 0) {
+    w.Write("(no Go frames found)\n");
+    return;
+  }
+  w.Write("(innermost frame unknown)\n");
+
+  int64_t mem_size = static_cast<int64_t>(mem->GetSize()) * Mem::kPageSize;
+  for (int i = 0; i < kMaxFrames; i++) {
+    uint64_t pc = static_cast<uint64_t>(mem->LoadInt64(addr));
+    const FuncInfo* f = LookupFunc(pc);
+    if (!f) {
+      break;
+    }
+    int64_t sp = addr + 8;
+
+    // A return address is the resume point after the call.
+    int32_t pc_b = static_cast<int32_t>(pc & 0xffff);
+    const PCInfo& call = kPCs[f->pcs + (pc_b > 0 ? pc_b - 1 : 0)];
+    w.Write(f->name);
+    w.Write("()\n\t");
+    w.Write(call.file >= 0 ? kFiles[call.file] : "?");
+    w.Write(":");
+    w.WriteInt(call.line);
+    w.Write(" +");
+    w.WriteHex(pc_b);
+    w.Write("\n");
+
+    if (std::strcmp(f->name, "runtime.goexit") == 0) {
+      return;
+    }
+
+    // The caller's return address is just above the frame.
+    int32_t sp_delta = kPCs[f->pcs + pc_b].sp_delta;
+    if (sp_delta < 0) {
+      addr = FindReturnAddress(mem, sp);
+      if (addr < 0) {
+        return;
+      }
+      continue;
+    }
+    addr = sp + sp_delta;
+    if (addr + 8 > mem_size) {
+      return;
+    }
+  }
+  if (LookupFunc(static_cast<uint64_t>(mem->LoadInt64(addr)))) {
+    w.Write("...additional frames elided...\n");
+  }
+}
+
+}
+`))
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const crashMainCpp = `#include "go.h"
+
+#include <csignal>
+#include <memory>
+
+int main() {
+  go2cpp_test::Go a;
+  go2cpp_test::Go b;
+  a.Global().ToObject().Set("crash", go2cpp_test::Value{std::make_shared<go2cpp_test::Function>(
+    [](go2cpp_test::Value self, std::vector<go2cpp_test::Value> args) -> go2cpp_test::Value {
+      std::raise(SIGSEGV);
+      return go2cpp_test::Value{};
+    })});
+  a.Start();
+  // b runs on the same thread and is installed after a, but the stack trace is printed for a, which crashes.
+  b.Start();
+  a.CallFunction("run").get();
+  return 0;
+}
+`
+
+func TestCrashHandler(t *testing.T) {
+	p := compileCppProgram(t, "./testdata/crash", &cppProgramOptions{
+		CrashHandler: true,
+	})
+	defer p.remove()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(p.build(t, "main", crashMainCpp))
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("the program must crash")
+	}
+	got := stderr.String()
+	for _, want := range []string{"[signal SIGSEGV: segmentation violation]", "main.crashInGo()"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("stderr must contain %q but not: %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const callExportMainCpp = `#include "go.h"
+
+#include <atomic>
+#include <chrono>
+#include <iostream>
+#include <stdexcept>
+#include <thread>
+
+int main() {
+  go2cpp_test::Go go;
+  go.Start();
+  std::cout << "add: " << go.add(1, 2) << std::endl;
+
+  std::atomic<bool> done{false};
+  std::thread t1([&go, &done]() {
+    std::cout << "add on another thread: " << go.add(3, 4) << std::endl;
+    done = true;
+  });
+  while (!done) {
+    go.Poll();
+  }
+  t1.join();
+
+  // The call on another thread is discarded by Shutdown.
+  std::thread t2([&go]() {
+    try {
+      go.add(5, 6);
+      std::cout << "discarded call: no exception" << std::endl;
+    } catch (const std::runtime_error&) {
+      std::cout << "discarded call: runtime_error" << std::endl;
+    }
+  });
+  std::this_thread::sleep_for(std::chrono::milliseconds(100));
+  go.Shutdown();
+  t2.join();
+  while (!go.IsExited()) {
+    go.Poll();
+  }
+
+  try {
+    go.add(7, 8);
+    std::cout << "call after exit: no exception" << std::endl;
+  } catch (const std::runtime_error&) {
+    std::cout << "call after exit: runtime_error" << std::endl;
+  }
+  return 0;
+}
+`
+
+const hostMainCpp = `#include "go.h"
+
+#include <iostream>
+
+class Host : public go2cpp_test::IHost {
+public:
+  int32_t env__double(int32_t x) override {
+    return x * 2;
+  }
+
+  int32_t my__module__add_one(int32_t x) override {
+    return x + 1;
+  }
+};
+
+int main() {
+  Host host;
+  go2cpp_test::Go go{&host};
+  go.Start();
+  std::cout << "callHost: " << go.callHost(5) << std::endl;
+  go.Shutdown();
+  while (!go.IsExited()) {
+    go.Poll();
+  }
+  return 0;
+}
+`
+
+const noHostMainCpp = `#include "go.h"
+
+#include <iostream>
+
+int main() {
+  go2cpp_test::Go go;
+  go.Start();
+  go.callHost(5);
+  std::cout << "callHost returned" << std::endl;
+  return 0;
+}
+`
+
+func TestDirectives(t *testing.T) {
+	p := compileCppProgram(t, "./testdata/directives", nil)
+	defer p.remove()
+
+	t.Run("CallExport", func(t *testing.T) {
+		got := strings.TrimSpace(p.run(t, "callexport", callExportMainCpp))
+		want := strings.Join([]string{
+			"ready",
+			"add: 3",
+			"add on another thread: 7",
+			"discarded call: runtime_error",
+			"call after exit: runtime_error",
+		}, "\n")
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+	t.Run("HostHeader", func(t *testing.T) {
+		h, err := ioutil.ReadFile(filepath.Join(p.genDir, "host.h"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range []string{
+			"// OriginalName: env.double\n",
+			"  virtual int32_t env__double(int32_t local0_) = 0;\n",
+			"// OriginalName: my.module.add-one\n",
+			"  virtual int32_t my__module__add_one(int32_t local0_) = 0;\n",
+		} {
+			if !strings.Contains(string(h), decl) {
+				t.Errorf("host.h doesn't have %q:\n%s", decl, h)
+			}
+		}
+	})
+
+	t.Run("Host", func(t *testing.T) {
+		got := strings.TrimSpace(p.run(t, "host", hostMainCpp))
+		want := "ready\ncallHost: 11"
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+
+	t.Run("NoHost", func(t *testing.T) {
+		out, err := exec.Command(p.build(t, "nohost", noHostMainCpp)).CombinedOutput()
+		if err == nil {
+			t.Fatalf("the program must fail without a host:\n%s", out)
+		}
+		if msg := "no IHost is given"; !strings.Contains(string(out), msg) {
+			t.Errorf("output: got: %q, want: contains %q", out, msg)
+		}
+		if strings.Contains(string(out), "callHost returned") {
+			t.Errorf("output: got: %q, want: no callHost returned", out)
+		}
+	})
+}
@@ -8,7 +8,7 @@ import (
 	"text/template"
 )
 
-func writeGame(dir string, incpath string, namespace string) error {
+func writeGame(dir string, incpath string, namespace string, rt runtimeLib) error {
 	{
 		f, err := os.Create(filepath.Join(dir, "game.h"))
 		if err != nil {
@@ -38,9 +38,11 @@ func writeGame(dir string, incpath string, namespace string) error {
 		if err := gameCppTmpl.Execute(f, struct {
 			IncludePath string
 			Namespace   string
+			RuntimeLib  runtimeLib
 		}{
 			IncludePath: incpath,
 			Namespace:   namespace,
+			RuntimeLib:  rt,
 		}); err != nil {
 			return err
 		}
@@ -123,7 +125,7 @@ public:
   int Run(const std::vector<std::string>& args);
 
 private:
-  void Update(Value f);
+  void Update(Object& go2cpp, Value f);
 
   std::unique_ptr<Driver> driver_;
   std::vector<Touch> touches_;
@@ -140,7 +142,7 @@ var gameCppTmpl = template.Must(template.New("game.cpp").Parse(`// Code generate
 
 #include "{{.IncludePath}}game.h"
 
-#include "{{.IncludePath}}gl.h"
+#include "{{.RuntimeLib.IncludePath}}gl.h"
 
 #include <cstring>
 #include <thread>
@@ -360,7 +362,9 @@ int Game::Run(const std::vector<std::string>& args) {
     return EXIT_FAILURE;
   }
 
-  auto& global = Value::Global().ToObject();
+  Go go;
+
+  auto& global = go.Global().ToObject();
   global.Set("localStorage", Value{std::make_shared<LocalStorage>(driver_.get())});
 
   auto go2cpp = std::make_shared<DictionaryValues>();
@@ -423,8 +427,6 @@ int Game::Run(const std::vector<std::string>& args) {
       return Value{static_cast<double>(gamepads_[idx].axes[axis_idx])};
     })});
 
-  Go go;
-
   go2cpp->Set("createAudio", Value{std::make_shared<Function>(
     [this, &go](Value self, std::vector<Value> args) -> Value {
       int sample_rate = static_cast<int>(args[0].ToNumber());
@@ -441,11 +443,11 @@ int Game::Run(const std::vector<std::string>& args) {
 
   global.Set("requestAnimationFrame",
              Value{std::make_shared<Function>(
-                 [this, &go](Value self, std::vector<Value> args) -> Value {
+                 [this, &go, go2cpp](Value self, std::vector<Value> args) -> Value {
                    Value f = args[0];
-                   go.EnqueueTask([this, f]() {
-                     driver_->Update([this, f]() mutable {
-                       Update(f);
+                   go.EnqueueTask([this, go2cpp, f]() {
+                     driver_->Update([this, go2cpp, f]() mutable {
+                       Update(*go2cpp, f);
                      });
                    });
                    return Value{};
@@ -454,10 +456,7 @@ int Game::Run(const std::vector<std::string>& args) {
   return go.Run(args);
 }
 
-void Game::Update(Value f) {
-  auto& global = Value::Global().ToObject();
-  auto& go2cpp = global.Get("go2cpp").ToObject();
-
+void Game::Update(Object& go2cpp, Value f) {
   touches_ = driver_->GetTouches();
   go2cpp.Set("touchCount", Value{static_cast<double>(touches_.size())});
 
@@ -4,42 +4,23 @@ package gowasm2cpp
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 
 	"github.com/go-interpreter/wagon/wasm"
 	"golang.org/x/sync/errgroup"
-)
 
-func identifierFromString(str string) string {
-	var ident string
-	for _, r := range []rune(str) {
-		if r > 0xff {
-			panic("identifiers cannot include non-Latin1 characters")
-		}
-		if '0' <= r && r <= '9' {
-			ident += string(r)
-			continue
-		}
-		if 'a' <= r && r <= 'z' {
-			ident += string(r)
-			continue
-		}
-		if 'A' <= r && r <= 'Z' {
-			ident += string(r)
-			continue
-		}
-		ident += fmt.Sprintf("_%02x", r)
-	}
-	if len(ident) > 512 {
-		ident = ident[:511]
-	}
-	return ident
-}
+	"github.com/hajimehoshi/go2cpp/internal/wat"
+)
 
 func includeGuard(str string) string {
 	return strings.ToUpper(str)
@@ -55,10 +36,35 @@ type wasmFunc struct {
 	Index   int
 	Import  bool
 	BodyStr string
+
+	// Host reports whether the function is imported from the embedder via IHost.
+	Host bool
+
+	// ident is the unique C++ identifier assigned by assignIdentifiers.
+	ident string
+
+	// PCs is the information for each resume point. PCs is nil when the function is not a Go function.
+	PCs []pcInfo
+
+	// InterpFallback reports whether the function is executed by the interpreter when the translator cannot convert it.
+	InterpFallback bool
+
+	// InterpAlways reports whether the function is executed by the interpreter even when the translator can convert
+	// it.
+	InterpAlways bool
+
+	// Annotate reports whether the generated body has comments of the original Wasm instructions.
+	Annotate bool
 }
 
+// errInterpAlways is used as a translation error when the interpreter is forced.
+var errInterpAlways = errors.New("gowasm2cpp: the interpreter is forced")
+
 func (f *wasmFunc) Identifier() string {
-	return identifierFromString(f.Wasm.Name)
+	if f.ident == "" {
+		return identifierFromString(f.Wasm.Name)
+	}
+	return f.ident
 }
 
 var funcDeclTmpl = template.Must(template.New("funcDecl").Parse(`// OriginalName: {{.OriginalName}}
@@ -67,7 +73,8 @@ var funcDeclTmpl = template.Must(template.New("funcDecl").Parse(`// OriginalName
 
 var funcImplTmpl = template.Must(template.New("func").Parse(`// OriginalName: {{.OriginalName}}
 // Index:        {{.Index}}
-{{.ReturnType}} {{.Class}}::{{.Name}}({{.Args}}) {
+{{if .Source}}// Source:       {{.Source}}
+{{end}}{{.ReturnType}} {{.Class}}::{{.Name}}({{.Args}}) {
 {{range .Locals}}  {{.}}
 {{end}}{{if .Locals}}
 {{end}}{{range .Body}}{{.}}
@@ -115,7 +122,7 @@ func (f *wasmFunc) CppDecl(indent string, abstract bool, override bool) (string,
 		Override     bool
 	}{
 		OriginalName: f.Wasm.Name,
-		Name:         identifierFromString(f.Wasm.Name),
+		Name:         f.Identifier(),
 		Index:        f.Index,
 		ReturnType:   retType.Cpp(),
 		Args:         strings.Join(args, ", "),
@@ -162,17 +169,27 @@ func (f *wasmFunc) CppImpl(className string, indent string) (string, error) {
 			}
 		}
 		var err error
-		body, err = f.bodyToCpp()
+		if f.InterpAlways {
+			err = errInterpAlways
+		} else {
+			body, err = f.bodyToCpp()
+		}
 		if err != nil {
-			return "", err
+			if !f.InterpFallback {
+				return "", err
+			}
+			locals = nil
+			body = f.interpBody()
+		} else {
+			locals = removeUnusedLocalVariables(locals, body)
 		}
-		locals = removeUnusedLocalVariables(locals, body)
 	} else {
-		// TODO: Use error function.
-		ident := identifierFromString(f.Wasm.Name)
-		body = []string{
-			fmt.Sprintf(`  std::cerr << "%s not implemented" << std::endl;`, ident),
-			"  std::exit(1);"}
+		return "", fmt.Errorf("%s is an unknown import", f.Wasm.Name)
+	}
+
+	var source string
+	if p, ok := f.sourcePos(0); ok {
+		source = p.String()
 	}
 
 	var buf bytes.Buffer
@@ -181,15 +198,17 @@ func (f *wasmFunc) CppImpl(className string, indent string) (string, error) {
 		Name         string
 		Class        string
 		Index        int
+		Source       string
 		ReturnType   string
 		Args         string
 		Locals       []string
 		Body         []string
 	}{
 		OriginalName: f.Wasm.Name,
-		Name:         identifierFromString(f.Wasm.Name),
+		Name:         f.Identifier(),
 		Class:        className,
 		Index:        f.Index,
+		Source:       source,
 		ReturnType:   retType.Cpp(),
 		Args:         strings.Join(args, ", "),
 		Locals:       locals,
@@ -299,7 +318,7 @@ func (e *wasmExport) CppImpl(indent string) (string, error) {
 	str := fmt.Sprintf(`%s Inst::%s(%s) {
   %s%s(%s);
 }
-`, retType.Cpp(), e.Name, strings.Join(args, ", "), ret, identifierFromString(f.Wasm.Name), strings.Join(argsToPass, ", "))
+`, retType.Cpp(), e.Name, strings.Join(args, ", "), ret, f.Identifier(), strings.Join(argsToPass, ", "))
 
 	lines := strings.Split(str, "\n")
 	for i := range lines {
@@ -308,6 +327,173 @@ func (e *wasmExport) CppImpl(indent string) (string, error) {
 	return strings.Join(lines, "\n"), nil
 }
 
+// goRuntimeExports is the exports that Go's js/wasm runtime uses internally. The other exports are the functions with
+// //go:wasmexport.
+var goRuntimeExports = map[string]struct{}{
+	"run":    {},
+	"resume": {},
+	"getsp":  {},
+}
+
+// goMemberNames is the list of the member names of Go that the entry points of the exports must not conflict with.
+// The member variables are not included, as their names end with '_', which the export names cannot.
+// TestGoMemberNames checks that the list matches the class.
+var goMemberNames = []string{
+	"Go",
+	"Run",
+	"Start",
+	"RunPendingTasks",
+	"Poll",
+	"IsExited",
+	"ExitCode",
+	"HostEnv",
+	"Shutdown",
+	"kShutdownExitCode",
+	"Snapshot",
+	"Restore",
+	"SetWakeupCallback",
+	"WakeupFd",
+	"EnqueueTask",
+	"Global",
+	"CallFunction",
+	"Import",
+	"GoObject",
+	"LoadValue",
+	"StoreValue",
+	"LoadSliceOfValues",
+	"SnapshotWriter",
+	"SnapshotReader",
+	"Init",
+	"CheckExited",
+	"Exit",
+	"Resume",
+	"Release",
+	"MakeFuncWrapper",
+	"DebugWrite",
+	"PreciseNowInNanoseconds",
+	"UnixNowInMilliseconds",
+	"SetTimeout",
+	"ScheduleTimeout",
+	"ClearTimeout",
+	"HasTimeout",
+	"GetRandomBytes",
+	"GetIdFromValue",
+	"Host",
+	"CallExport",
+	"WriteSnapshotValue",
+	"WriteSnapshotEntries",
+	"ReadSnapshotValue",
+	"ReadSnapshotEntries",
+	"ToValue",
+}
+
+// goNamespaceNames is the list of the names at namespace scope that the members of Go refer to. An entry point with
+// such a name would hide it in the members.
+var goNamespaceNames = []string{
+	// go.cpp
+	"error",
+	"FuncWrapper",
+	"UnrestoredObject",
+	"kModuleHash",
+	"kSnapshotMagic",
+	"kSnapshotVersion",
+	"SnapshotTag",
+	"ThrowBrokenSnapshot",
+	"TaskPromise",
+
+	// The runtime
+	"Value",
+	"Object",
+	"Function",
+	"DictionaryValues",
+	"Writer",
+	"BytesSpan",
+	"TaskQueue",
+	"Timer",
+	"Mem",
+	"Inst",
+	"IImport",
+	"IHost",
+	"InstallCrashHandler",
+	"UninstallCrashHandler",
+	"CrashHandlerScope",
+	"PrintGoStackTrace",
+
+	// The standard library
+	"int8_t",
+	"int16_t",
+	"int32_t",
+	"int64_t",
+	"uint8_t",
+	"uint16_t",
+	"uint32_t",
+	"uint64_t",
+	"size_t",
+}
+
+// goExports returns the exports with //go:wasmexport.
+func goExports(exports []*wasmExport) ([]*wasmExport, error) {
+	var result []*wasmExport
+	for _, e := range exports {
+		if _, ok := goRuntimeExports[e.Name]; ok {
+			continue
+		}
+		for _, n := range goMemberNames {
+			if e.Name == n {
+				return nil, fmt.Errorf("export %s conflicts with a member of Go", e.Name)
+			}
+		}
+		for _, n := range goNamespaceNames {
+			if e.Name == n {
+				return nil, fmt.Errorf("export %s conflicts with a name that Go refers to", e.Name)
+			}
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// GoCppImpl returns the implementation of the typed entry point on Go for the export.
+// The entry point calls the export via CallExport so that the call is executed on Run's or Start's thread.
+func (e *wasmExport) GoCppImpl() (string, error) {
+	f := e.Funcs[e.Index]
+
+	var retType returnType
+	switch ts := f.Wasm.Sig.ReturnTypes; len(ts) {
+	case 0:
+		retType = returnTypeVoid
+	case 1:
+		retType = wasmTypeToReturnType(ts[0])
+	default:
+		return "", fmt.Errorf("the number of return values must be 0 or 1 but %d", len(ts))
+	}
+
+	var args []string
+	var argsToPass []string
+	for i, t := range f.Wasm.Sig.ParamTypes {
+		args = append(args, fmt.Sprintf("%s arg%d", wasmTypeToReturnType(t).Cpp(), i))
+		argsToPass = append(argsToPass, fmt.Sprintf("arg%d", i))
+	}
+
+	call := fmt.Sprintf("inst_->%s(%s)", e.Name, strings.Join(argsToPass, ", "))
+	if retType == returnTypeVoid {
+		return fmt.Sprintf(`void Go::%s(%s) {
+  CallExport([&]() {
+    %s;
+  });
+}
+`, e.Name, strings.Join(args, ", "), call), nil
+	}
+	return fmt.Sprintf(`%s Go::%s(%s) {
+  %s result = 0;
+  CallExport([&]() {
+    result = %s;
+  });
+  return result;
+}
+`, retType.Cpp(), e.Name, strings.Join(args, ", "), retType.Cpp(), call), nil
+}
+
 type wasmGlobal struct {
 	Type  wasm.ValueType
 	Index int
@@ -341,16 +527,95 @@ func (t *wasmType) Cpp() (string, error) {
 	return fmt.Sprintf("%s (Inst::*)(%s)", retType.Cpp(), strings.Join(args, ", ")), nil
 }
 
-func Generate(outDir string, include string, wasmFile string, namespace string) error {
+type wasmModule struct {
+	mod     *wasm.Module
+	types   []*wasmType
+	globals []*wasmGlobal
+	ifs     []*wasmFunc
+	fs      []*wasmFunc
+	exports []*wasmExport
+	tables  [][]uint32
+	data    []wasmData
+
+	// imports is the import table detected from the module's imports.
+	imports *importTable
+
+	// wasi reports whether the module imports WASI preview1 functions instead of Go's js/wasm functions.
+	wasi bool
+
+	// goWASIP1 reports whether the module is a Go program compiled with GOOS=wasip1.
+	goWASIP1 bool
+
+	// hash is the SHA-256 hash of the file, which identifies the module in snapshots.
+	hash string
+}
+
+// decodeModule decodes the given file. The file is either a binary module or a text module with the extension .wat.
+func decodeModule(wasmFile string) (*wasm.Module, error) {
+	if strings.EqualFold(filepath.Ext(wasmFile), ".wat") {
+		src, err := ioutil.ReadFile(wasmFile)
+		if err != nil {
+			return nil, err
+		}
+		bin, err := wat.Parse(src)
+		if err != nil {
+			return nil, err
+		}
+		return wasm.DecodeModule(bytes.NewReader(bin))
+	}
+
 	f, err := os.Open(wasmFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
 
-	mod, err := wasm.DecodeModule(f)
+	return wasm.DecodeModule(f)
+}
+
+func loadModule(wasmFile string) (*wasmModule, error) {
+	mod, err := decodeModule(wasmFile)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	src, err := ioutil.ReadFile(wasmFile)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(src)
+
+	// Hand-written modules might not have some sections.
+	if mod.Types == nil {
+		mod.Types = &wasm.SectionTypes{}
+	}
+	if mod.Import == nil {
+		mod.Import = &wasm.SectionImports{}
+	}
+	if mod.Function == nil {
+		mod.Function = &wasm.SectionFunctions{}
+	}
+	if mod.Table == nil {
+		mod.Table = &wasm.SectionTables{}
+	}
+	if mod.Memory == nil || len(mod.Memory.Entries) == 0 {
+		mod.Memory = &wasm.SectionMemories{
+			Entries: []wasm.Memory{{}},
+		}
+	}
+	if mod.Global == nil {
+		mod.Global = &wasm.SectionGlobals{}
+	}
+	if mod.Export == nil {
+		mod.Export = &wasm.SectionExports{}
+	}
+	if mod.Elements == nil {
+		mod.Elements = &wasm.SectionElements{}
+	}
+	if mod.Code == nil {
+		mod.Code = &wasm.SectionCode{}
+	}
+	if mod.Data == nil {
+		mod.Data = &wasm.SectionData{}
 	}
 
 	var types []*wasmType
@@ -373,9 +638,18 @@ func Generate(outDir string, include string, wasmFile string, namespace string)
 		})
 	}
 
+	imports := detectImportTable(mod)
+	wasi := imports.wasi
+
 	var ifs []*wasmFunc
 	for i, e := range mod.Import.Entries {
 		name := e.FieldName
+		body, ok := imports.bodies[importKey{module: e.ModuleName, field: name}]
+		host := !ok && !isRuntimeImportModule(e.ModuleName)
+		if host {
+			// Host functions are named with their modules, as different modules might have the same field names.
+			name = e.ModuleName + "." + e.FieldName
+		}
 		ifs = append(ifs, &wasmFunc{
 			Type: types[e.Type.(wasm.FuncImport).Type],
 			Wasm: wasm.Function{
@@ -385,7 +659,8 @@ func Generate(outDir string, include string, wasmFile string, namespace string)
 			Globals: globals,
 			Index:   i,
 			Import:  true,
-			BodyStr: importFuncBodies[name],
+			BodyStr: body,
+			Host:    host,
 		})
 	}
 
@@ -394,19 +669,23 @@ func Generate(outDir string, include string, wasmFile string, namespace string)
 	if c := mod.Custom(wasm.CustomSectionName); c != nil {
 		var nsec wasm.NameSection
 		if err := nsec.UnmarshalWASM(bytes.NewReader(c.Data)); err != nil {
-			return err
+			return nil, err
 		}
 		if len(nsec.Types[wasm.NameFunction]) > 0 {
 			sub, err := nsec.Decode(wasm.NameFunction)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			names = sub.(*wasm.FunctionNames).Names
 		}
 	}
 	var fs []*wasmFunc
 	for i, t := range mod.Function.Types {
-		name := names[uint32(i+len(mod.Import.Entries))]
+		name, ok := names[uint32(i+len(mod.Import.Entries))]
+		if !ok {
+			// Hand-written modules might not have names.
+			name = fmt.Sprintf("func%d", i+len(mod.Import.Entries))
+		}
 		bodyStr, ok := specialFunctionBodies[name]
 		var body *wasm.FunctionBody
 		if !ok {
@@ -429,6 +708,9 @@ func Generate(outDir string, include string, wasmFile string, namespace string)
 	for _, e := range mod.Export.Entries {
 		switch e.Kind {
 		case wasm.ExternalFunction:
+			if err := checkExportName(e.FieldStr); err != nil {
+				return nil, err
+			}
 			exports = append(exports, &wasmExport{
 				Index: int(e.Index),
 				Name:  e.FieldStr,
@@ -436,18 +718,40 @@ func Generate(outDir string, include string, wasmFile string, namespace string)
 		case wasm.ExternalMemory:
 			// Ignore
 		default:
-			return fmt.Errorf("export type %d is not implemented", e.Kind)
+			return nil, fmt.Errorf("export type %d is not implemented", e.Kind)
 		}
 	}
+	// The entries are a map. Sort them for deterministic results.
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].Name < exports[j].Name
+	})
 
 	allfs := append(ifs, fs...)
 	for _, e := range exports {
 		e.Funcs = allfs
 	}
+	var exportNames []string
+	for _, e := range exports {
+		exportNames = append(exportNames, e.Name)
+	}
+	// The imported functions are members of IImport and the other functions are members of Inst.
+	if err := assignIdentifiers(ifs, nil); err != nil {
+		return nil, err
+	}
+	if err := assignIdentifiers(fs, exportNames); err != nil {
+		return nil, err
+	}
 	for _, f := range ifs {
 		f.Mod = mod
 		f.Funcs = allfs
 		f.Types = types
+		if f.Host {
+			owner := "go_"
+			if wasi {
+				owner = "wasi_"
+			}
+			f.BodyStr = f.hostFuncBody(owner)
+		}
 	}
 	for _, f := range fs {
 		f.Mod = mod
@@ -456,14 +760,14 @@ func Generate(outDir string, include string, wasmFile string, namespace string)
 	}
 
 	if mod.Start != nil {
-		return fmt.Errorf("start section must be nil but not")
+		return nil, fmt.Errorf("start section must be nil but not")
 	}
 
 	tables := make([][]uint32, len(mod.Table.Entries))
 	for _, e := range mod.Elements.Entries {
 		v, err := mod.ExecInitExpr(e.Offset)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		offset := v.(int32)
 		if diff := int(offset) + int(len(e.Elems)) - int(len(tables[e.Index])); diff > 0 {
@@ -476,7 +780,7 @@ func Generate(outDir string, include string, wasmFile string, namespace string)
 	for _, e := range mod.Data.Entries {
 		offset, err := mod.ExecInitExpr(e.Offset)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		data = append(data, wasmData{
 			Offset: int(offset.(int32)),
@@ -484,6 +788,110 @@ func Generate(outDir string, include string, wasmFile string, namespace string)
 		})
 	}
 
+	pcln, err := newPCLineTable(data)
+	if err != nil {
+		return nil, err
+	}
+	if pcln != nil {
+		for i, f := range fs {
+			f.PCs = pcln.funcPCs(i)
+		}
+	}
+
+	return &wasmModule{
+		mod:     mod,
+		types:   types,
+		globals: globals,
+		ifs:     ifs,
+		fs:      fs,
+		exports: exports,
+		tables:  tables,
+		data:    data,
+		imports: imports,
+		wasi:    wasi,
+
+		// Go's linker always adds the build ID section.
+		goWASIP1: wasi && mod.Custom("go:buildid") != nil,
+
+		hash: hex.EncodeToString(hash[:]),
+	}, nil
+}
+
+// Options represents the options for GenerateWithOptions.
+type Options struct {
+	// Interpreter specifies whether the functions that the translator cannot convert are executed by an embedded
+	// interpreter. If Interpreter is false, generation fails at such functions.
+	Interpreter bool
+
+	// InterpretAll specifies whether all the functions are executed by the embedded interpreter even when the
+	// translator can convert them. InterpretAll implies Interpreter. This is useful to test the interpreter.
+	InterpretAll bool
+
+	// CrashHandler specifies whether the generated runtime installs signal handlers that print the Go stack trace on
+	// crashes. The Go program must be compiled with the line table.
+	CrashHandler bool
+
+	// Annotate specifies whether each generated C++ statement is preceded by comments of the Wasm instructions it
+	// comes from, with their byte offsets in the function body.
+	Annotate bool
+
+	// RuntimeNamespace specifies the namespace of the runtime generated by GenerateRuntime. If RuntimeNamespace is
+	// not empty, the runtime files that don't depend on the module are not generated, and the generated files use
+	// the runtime's instead. The files generated per program are go, game, host, inst and mem, and interp and crash
+	// when they are enabled.
+	RuntimeNamespace string
+
+	// RuntimeInclude specifies the include path of the runtime's headers. RuntimeInclude is used only when
+	// RuntimeNamespace is not empty.
+	RuntimeInclude string
+}
+
+func Generate(outDir string, include string, wasmFile string, namespace string) error {
+	return GenerateWithOptions(outDir, include, wasmFile, namespace, nil)
+}
+
+// GenerateWithOptions is same as Generate with the given options.
+// The options can be nil.
+func GenerateWithOptions(outDir string, include string, wasmFile string, namespace string, options *Options) error {
+	if options == nil {
+		options = &Options{}
+	}
+
+	m, err := loadModule(wasmFile)
+	if err != nil {
+		return err
+	}
+	mod := m.mod
+	ifs := m.ifs
+	fs := m.fs
+
+	var unknown []string
+	for i, f := range ifs {
+		if f.BodyStr == "" {
+			e := mod.Import.Entries[i]
+			unknown = append(unknown, importKey{module: e.ModuleName, field: e.FieldName}.String())
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown imports for %s: %s", m.imports.name, strings.Join(unknown, ", "))
+	}
+	interp := options.Interpreter || options.InterpretAll
+	if options.InterpretAll {
+		for _, f := range fs {
+			f.InterpAlways = true
+		}
+	}
+	if interp {
+		for _, f := range fs {
+			f.InterpFallback = true
+		}
+	}
+	if options.Annotate {
+		for _, f := range fs {
+			f.Annotate = true
+		}
+	}
+
 	var incpath string
 	if include != "" {
 		include = filepath.ToSlash(include)
@@ -492,73 +900,62 @@ func Generate(outDir string, include string, wasmFile string, namespace string)
 		}
 	}
 
+	rt := newRuntimeLib(incpath, namespace, options)
+
 	var g errgroup.Group
 	g.Go(func() error {
-		{
-			out, err := os.Create(filepath.Join(outDir, "go.h"))
-			if err != nil {
-				return err
-			}
-			defer out.Close()
-
-			if err := goHTmpl.Execute(out, struct {
-				IncludeGuard string
-				IncludePath  string
-				Namespace    string
-				ImportFuncs  []*wasmFunc
-			}{
-				IncludeGuard: includeGuard(namespace) + "_GO_H",
-				IncludePath:  incpath,
-				Namespace:    namespace,
-				ImportFuncs:  ifs,
-			}); err != nil {
-				return err
-			}
-		}
-		{
-			out, err := os.Create(filepath.Join(outDir, "go.cpp"))
-			if err != nil {
-				return err
-			}
-			defer out.Close()
-
-			if err := goCppTmpl.Execute(out, struct {
-				IncludePath string
-				Namespace   string
-				ImportFuncs []*wasmFunc
-			}{
-				IncludePath: incpath,
-				Namespace:   namespace,
-				ImportFuncs: ifs,
-			}); err != nil {
-				return err
-			}
+		runtime := "Go"
+		if m.wasi {
+			runtime = "WASI"
 		}
-		return nil
-	})
-	g.Go(func() error {
-		return writeBits(outDir, incpath, namespace)
-	})
-	g.Go(func() error {
-		return writeGame(outDir, incpath, namespace)
-	})
-	g.Go(func() error {
-		return writeGL(outDir, incpath, namespace)
-	})
-	g.Go(func() error {
-		return writeJS(outDir, incpath, namespace)
-	})
-	g.Go(func() error {
-		return writeTaskQueue(outDir, incpath, namespace)
-	})
-	g.Go(func() error {
-		return writeBytes(outDir, incpath, namespace)
+		return writeHost(outDir, incpath, namespace, runtime, ifs)
 	})
+	if m.wasi {
+		g.Go(func() error {
+			return writeWASI(outDir, incpath, namespace, ifs, m.exports, m.goWASIP1, options.CrashHandler)
+		})
+	} else {
+		g.Go(func() error {
+			return writeGo(outDir, incpath, namespace, rt, ifs, m.exports, m.hash, options.CrashHandler)
+		})
+		g.Go(func() error {
+			return writeGame(outDir, incpath, namespace, rt)
+		})
+		if options.RuntimeNamespace == "" {
+			g.Go(func() error {
+				return writeGL(outDir, incpath, namespace)
+			})
+			g.Go(func() error {
+				return writeJS(outDir, incpath, namespace)
+			})
+			g.Go(func() error {
+				return writeTaskQueue(outDir, incpath, namespace)
+			})
+		}
+	}
+	if options.RuntimeNamespace == "" {
+		g.Go(func() error {
+			return writeBits(outDir, incpath, namespace)
+		})
+		g.Go(func() error {
+			return writeBytes(outDir, incpath, namespace)
+		})
+	}
 	g.Go(func() error {
-		return writeInst(outDir, incpath, namespace, ifs, fs, exports, globals, types, tables)
+		return writeInst(outDir, incpath, namespace, rt, ifs, fs, m.exports, m.globals, m.types, m.tables, interp)
 	})
+	if interp {
+		g.Go(func() error {
+			return writeInterp(outDir, incpath, namespace, rt)
+		})
+	}
+	if options.CrashHandler {
+		g.Go(func() error {
+			return writeCrash(outDir, incpath, namespace, fs)
+		})
+	}
 	g.Go(func() error {
-		return writeMem(outDir, incpath, namespace, int(mod.Memory.Entries[0].Limits.Initial), data)
+		return writeMem(outDir, incpath, namespace, rt, int(mod.Memory.Entries[0].Limits.Initial), m.data)
 	})
 
 	if err := g.Wait(); err != nil {
@@ -568,25 +965,92 @@ func Generate(outDir string, include string, wasmFile string, namespace string)
 	return nil
 }
 
+func writeGo(dir string, incpath string, namespace string, rt runtimeLib, importFuncs []*wasmFunc, exports []*wasmExport, moduleHash string, crashHandler bool) error {
+	exports, err := goExports(exports)
+	if err != nil {
+		return err
+	}
+
+	{
+		out, err := os.Create(filepath.Join(dir, "go.h"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		if err := goHTmpl.Execute(out, struct {
+			IncludeGuard string
+			IncludePath  string
+			Namespace    string
+			RuntimeLib   runtimeLib
+			ImportFuncs  []*wasmFunc
+			Exports      []*wasmExport
+		}{
+			IncludeGuard: includeGuard(namespace) + "_GO_H",
+			IncludePath:  incpath,
+			Namespace:    namespace,
+			RuntimeLib:   rt,
+			ImportFuncs:  importFuncs,
+			Exports:      exports,
+		}); err != nil {
+			return err
+		}
+	}
+	{
+		out, err := os.Create(filepath.Join(dir, "go.cpp"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		if err := goCppTmpl.Execute(out, struct {
+			IncludePath  string
+			Namespace    string
+			ImportFuncs  []*wasmFunc
+			Exports      []*wasmExport
+			ModuleHash   string
+			CrashHandler bool
+		}{
+			IncludePath:  incpath,
+			Namespace:    namespace,
+			ImportFuncs:  importFuncs,
+			Exports:      exports,
+			ModuleHash:   moduleHash,
+			CrashHandler: crashHandler,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 var goHTmpl = template.Must(template.New("go.h").Parse(`// Code generated by go2cpp. DO NOT EDIT.
 
 #ifndef {{.IncludeGuard}}
 #define {{.IncludeGuard}}
 
-#include "{{.IncludePath}}bytes.h"
-#include "{{.IncludePath}}js.h"
+#include "{{.RuntimeLib.IncludePath}}bytes.h"
+#include "{{.IncludePath}}host.h"
+#include "{{.RuntimeLib.IncludePath}}js.h"
 #include "{{.IncludePath}}inst.h"
 #include "{{.IncludePath}}mem.h"
-#include "{{.IncludePath}}taskqueue.h"
+#include "{{.RuntimeLib.IncludePath}}taskqueue.h"
 
 #include <algorithm>
+#include <atomic>
 #include <cstdint>
 #include <chrono>
 #include <functional>
+#include <future>
+#include <limits>
 #include <map>
 #include <memory>
+#include <mutex>
+#include <random>
 #include <stack>
 #include <string>
+#include <thread>
+#include <type_traits>
 #include <unordered_map>
 #include <vector>
 
@@ -597,13 +1061,129 @@ class Mem;
 class Go {
 public:
   Go();
+
+  // The host must outlive the Go.
+  explicit Go(IHost* host);
+
+  // Run runs the Go program on the current thread, and blocks until the program exits. Run returns the exit code.
+  //
+  // env is the environment variables of the program. Without env, the program has no environment variables. Pass
+  // HostEnv() to forward the host's environment variables.
+  //
+  // If the arguments and the environment variables are too long to be passed to the program, Run throws
+  // std::runtime_error without running the program.
   int Run();
   int Run(int argc, char** argv);
   int Run(const std::vector<std::string>& args);
-
-  // EnqueuTask is concurrent-safe.
+  int Run(const std::vector<std::string>& args, const std::map<std::string, std::string>& env);
+
+  // Start starts the Go program on the current thread, and returns when the program's goroutines are blocked or the
+  // program exits. Unlike Run, Start doesn't take over the thread: the host has to call RunPendingTasks or Poll on
+  // the same thread from its own loop until IsExited returns true.
+  //
+  // The tasks enqueued before Run or Start and the Shutdown calls before them are discarded. Start throws
+  // std::runtime_error in the same case as Run.
+  void Start();
+  void Start(int argc, char** argv);
+  void Start(const std::vector<std::string>& args);
+  void Start(const std::vector<std::string>& args, const std::map<std::string, std::string>& env);
+
+  // RunPendingTasks runs the enqueued tasks like timers and callbacks until no task is left, the program exits, or
+  // max_duration passes. RunPendingTasks doesn't wait for new tasks. RunPendingTasks returns the number of the
+  // executed tasks.
+  int RunPendingTasks(std::chrono::steady_clock::duration max_duration);
+
+  // Poll runs the enqueued tasks until no task is left or the program exits. Poll returns the number of the executed
+  // tasks.
+  int Poll();
+
+  // IsExited reports whether the Go program started by Start has exited.
+  bool IsExited() const;
+
+  // ExitCode returns the exit code of the Go program. ExitCode is valid after IsExited returns true.
+  int ExitCode() const;
+
+  // HostEnv returns the host's environment variables.
+  static std::map<std::string, std::string> HostEnv();
+
+  // kShutdownExitCode is the exit code when the Go program is stopped by Shutdown.
+  static constexpr int kShutdownExitCode = std::numeric_limits<int32_t>::min();
+
+  // Shutdown stops the Go program. The pending timers are stopped, and the pending tasks and the tasks enqueued after
+  // this are discarded. Then Run
+  // returns kShutdownExitCode, and the resources of the program like the values and the memory are released. With
+  // Start, the program exits at the next RunPendingTasks or Poll call. The wakeup callback and the wakeup file
+  // descriptor are signaled so that the host notices it.
+  //
+  // Shutdown is concurrent-safe. The program stops after the current task ends: Shutdown cannot interrupt a
+  // long-running Go function.
+  void Shutdown();
+
+  // Snapshot serializes the state of the Go program: the memory, the globals, the values that Go refers to, and the
+  // pending timeouts. Snapshot must be called on Run's or Start's thread while no Go function is running, e.g. in a
+  // task enqueued by EnqueueTask or between RunPendingTasks calls. The enqueued tasks are not included.
+  //
+  // The objects that are not created by Go, like fs, are serialized as their paths from the global object.
+  std::vector<uint8_t> Snapshot();
+
+  // Restore restores the Go program from the snapshot on the current thread instead of Start. The host should prepare
+  // the global object in the same way as when the snapshot was taken. After Restore, call RunPendingTasks or Poll on
+  // the same thread as after Start.
+  //
+  // An object that is not created by Go and is not found in the global object is restored as a placeholder that
+  // aborts on use.
+  //
+  // Restore throws std::runtime_error if the snapshot is broken or is for another module.
+  void Restore(const std::vector<uint8_t>& snapshot);
+
+  // SetWakeupCallback sets the function called when a task is enqueued. The host should call RunPendingTasks or Poll
+  // on Start's thread after the callback is called. The callback is called on the enqueueing thread, which might be
+  // another thread than Start's. The callback is also called on Start's thread when RunPendingTasks returns with tasks
+  // left.
+  //
+  // SetWakeupCallback is concurrent-safe.
+  void SetWakeupCallback(std::function<void()> callback);
+
+  // WakeupFd returns the file descriptor that becomes readable when a task is enqueued, so that the host can watch
+  // it with e.g. epoll. RunPendingTasks and Poll drain the file descriptor, and make it readable again when they
+  // return with tasks left. WakeupFd returns -1 if this is not supported on the platform. The Go owns the file
+  // descriptor.
+  //
+  // WakeupFd is concurrent-safe.
+  int WakeupFd();
+
+  // EnqueuTask is concurrent-safe. The tasks enqueued after the program exits are discarded.
   void EnqueueTask(std::function<void()> task);
 
+  // Global returns the global object of the Go program, which is js.Global() in Go. Each Go has its own global
+  // object, so multiple Gos can run in parallel in one process. The global object must be accessed only on Run's or
+  // Start's thread while the program is running.
+  Value Global() const;
+
+  // CallFunction calls the global function that the Go program sets like js.Global().Set(name, js.FuncOf(f)), and
+  // returns the future of the result. CallFunction must be called while the program is running by Run or Start.
+  //
+  // CallFunction is concurrent-safe. The function is called on Run's or Start's thread. When CallFunction is called
+  // on that thread, the function is called immediately and the returned future is ready. Otherwise, the function is called
+  // as a task.
+  //
+  // If the function is not found, or the Go program has already exited or exits before the function is called, the
+  // future has std::runtime_error.
+  std::future<Value> CallFunction(const std::string& name, std::vector<Value> args);
+
+  // CallFunction calls the function with the arguments converted to Values.
+  template <typename... Args>
+  std::future<Value> CallFunction(const std::string& name, Args... args) {
+    return CallFunction(name, std::vector<Value>{ToValue(args)...});
+  }
+{{if .Exports}}
+  // The functions exported with //go:wasmexport. These must be called while the program is running by Run or Start.
+  // These are concurrent-safe: when called from another thread than Run's or Start's, the call is executed as a task
+  // on that thread and the caller waits for the result.
+  //
+  // These throw std::runtime_error if the Go program has already exited or exits before the call is executed.
+{{range $value := .Exports}}{{$value.CppDecl "  "}}
+{{end}}{{end}}
 private:
   class Import : public IImport {
   public:
@@ -630,18 +1210,47 @@ private:
   Value LoadValue(int32_t addr);
   void StoreValue(int32_t addr, Value v);
   std::vector<Value> LoadSliceOfValues(int32_t addr);
+
+  class SnapshotWriter;
+  class SnapshotReader;
+
+  void Init();
+  bool CheckExited();
   void Exit(int32_t code);
   void Resume();
+  void Release();
   Value MakeFuncWrapper(int32_t id);
   void DebugWrite(BytesSpan bytes);
   int64_t PreciseNowInNanoseconds();
   double UnixNowInMilliseconds();
   int32_t SetTimeout(double interval);
+  void ScheduleTimeout(int32_t id, double interval);
   void ClearTimeout(int32_t id);
+  bool HasTimeout(int32_t id);
   void GetRandomBytes(BytesSpan bytes);
   int32_t GetIdFromValue(Value value);
+  IHost* Host();
+  void CallExport(const std::function<void()>& func);
+  void WriteSnapshotValue(SnapshotWriter* writer, Value value);
+  void WriteSnapshotEntries(SnapshotWriter* writer, Object& object);
+  Value ReadSnapshotValue(SnapshotReader* reader, Value existing);
+  void ReadSnapshotEntries(SnapshotReader* reader, Value target);
+
+  static Value ToValue(Value value) { return value; }
+  static Value ToValue(bool b) { return Value{b}; }
+  static Value ToValue(const char* str) { return Value{str}; }
+  static Value ToValue(const std::string& str) { return Value{str}; }
+  template <typename T>
+  static typename std::enable_if<std::is_arithmetic<T>::value, Value>::type ToValue(T num) {
+    return Value{static_cast<double>(num)};
+  }
 
   Import import_;
+  IHost* host_ = nullptr;
+  Value global_;
+  Value empty_args_;
+  // TODO: Use cryptographically strong random values instead of std::random_device.
+  std::random_device random_device_;
   Writer debug_writer_;
   // A TaskQueue must be destructed after the timers are destructed.
   TaskQueue task_queue_;
@@ -649,7 +1258,10 @@ private:
   Value pending_event_;
   std::unordered_map<int32_t, Value> cached_args_;
   std::unordered_map<int32_t, Value> cached_events_;
+  // timeouts_mutex_ guards scheduled_timeouts_, as Shutdown stops the timers on another thread.
+  std::mutex timeouts_mutex_;
   std::unordered_map<int32_t, std::unique_ptr<Timer>> scheduled_timeouts_;
+  std::unordered_map<int32_t, std::chrono::steady_clock::time_point> timeout_deadlines_;
   int32_t next_callback_timeout_id_ = 1;
 
   std::unique_ptr<Inst> inst_;
@@ -660,6 +1272,10 @@ private:
   std::stack<int32_t, std::vector<int32_t>> id_pool_;
   bool exited_ = false;
   int32_t exit_code_ = 0;
+  std::atomic<bool> shutdown_requested_{false};
+  std::thread::id thread_id_;
+  // go_call_depth_ is the number of the Go functions running on the stack.
+  int go_call_depth_ = 0;
 
   std::chrono::high_resolution_clock::time_point start_time_point_ = std::chrono::high_resolution_clock::now();
 };
@@ -673,13 +1289,21 @@ private:
 var goCppTmpl = template.Must(template.New("go.cpp").Parse(`// Code generated by go2cpp. DO NOT EDIT.
 
 #include "{{.IncludePath}}go.h"
-
+{{if .CrashHandler}}
+#include "{{.IncludePath}}crash.h"
+{{end}}
 #include <cassert>
 #include <cmath>
 #include <cstring>
+#include <future>
 #include <iostream>
 #include <limits>
 #include <random>
+#include <stdexcept>
+
+#ifndef _WIN32
+extern char** environ;
+#endif
 
 namespace {{.Namespace}} {
 
@@ -691,10 +1315,270 @@ void error(const std::string& msg) {
   std::exit(1);
 }
 
+// TaskPromise is a promise that a task owns. If the task is destroyed without setting the result, e.g. when the task
+// is discarded by Shutdown or after the program exits, the future throws std::runtime_error.
+template <typename T>
+class TaskPromise {
+public:
+  TaskPromise() = default;
+  TaskPromise(const TaskPromise&) = delete;
+  TaskPromise& operator=(const TaskPromise&) = delete;
+
+  ~TaskPromise() {
+    if (!done_) {
+      promise_.set_exception(std::make_exception_ptr(std::runtime_error("Go program has already exited")));
+    }
+  }
+
+  std::future<T> GetFuture() {
+    return promise_.get_future();
+  }
+
+  template <typename... Args>
+  void SetValue(Args&&... args) {
+    promise_.set_value(std::forward<Args>(args)...);
+    done_ = true;
+  }
+
+  void SetException(std::exception_ptr e) {
+    promise_.set_exception(e);
+    done_ = true;
+  }
+
+private:
+  std::promise<T> promise_;
+  bool done_ = false;
+};
+
+// FuncWrapper is a function made by js.FuncOf. The ID is used for snapshots.
+class FuncWrapper : public Function {
+public:
+  FuncWrapper(int32_t id, Object::Func fn)
+      : Function{std::move(fn)},
+        id_{id} {
+  }
+
+  int32_t Id() const { return id_; }
+
+private:
+  int32_t id_;
+};
+
+// UnrestoredObject is a placeholder for a host object that is not found at Go::Restore.
+class UnrestoredObject : public Object {
+public:
+  explicit UnrestoredObject(const std::string& name)
+      : name_{name} {
+  }
+
+  Value Get(const std::string& key) override {
+    error(name_ + " is not restored from the snapshot: getting " + key);
+    return Value{};
+  }
+
+  void Set(const std::string& key, Value value) override {
+    error(name_ + " is not restored from the snapshot: setting " + key);
+  }
+
+  Value Invoke(Value self, std::vector<Value> args) override {
+    error(name_ + " is not restored from the snapshot: invoking");
+    return Value{};
+  }
+
+  Value New(std::vector<Value> args) override {
+    error(name_ + " is not restored from the snapshot: constructing");
+    return Value{};
+  }
+
+  std::string ToString() const override { return name_; }
+
+private:
+  std::string name_;
+};
+
+constexpr char kModuleHash[] = "{{.ModuleHash}}";
+constexpr char kSnapshotMagic[] = "go2cpp snapshot";
+constexpr uint32_t kSnapshotVersion = 1;
+
+enum class SnapshotTag : uint8_t {
+  Undefined,
+  Null,
+  Bool,
+  Number,
+  String,
+  Ref,
+  Array,
+  EmptyArgs,
+  Global,
+  GoObject,
+  FuncWrapper,
+  Dictionary,
+  HostObject,
+};
+
+void ThrowBrokenSnapshot() {
+  throw std::runtime_error("Go::Restore: the snapshot is broken");
+}
+
+}
+
+class Go::SnapshotWriter {
+public:
+  void WriteUint8(uint8_t v) {
+    bytes_.push_back(v);
+  }
+
+  void WriteUint32(uint32_t v) {
+    for (int i = 0; i < 4; i++) {
+      bytes_.push_back(static_cast<uint8_t>(v >> (8 * i)));
+    }
+  }
+
+  void WriteUint64(uint64_t v) {
+    for (int i = 0; i < 8; i++) {
+      bytes_.push_back(static_cast<uint8_t>(v >> (8 * i)));
+    }
+  }
+
+  void WriteFloat64(double v) {
+    uint64_t bits;
+    std::memcpy(&bits, &v, sizeof(bits));
+    WriteUint64(bits);
+  }
+
+  void WriteBytes(const uint8_t* data, size_t size) {
+    bytes_.insert(bytes_.end(), data, data + size);
+  }
+
+  void WriteString(const std::string& str) {
+    WriteUint32(static_cast<uint32_t>(str.size()));
+    WriteBytes(reinterpret_cast<const uint8_t*>(str.data()), str.size());
+  }
+
+  // AddNode registers an object or an array, and returns false if the node is already registered.
+  // In this case, the index of the node is written instead.
+  bool AddNode(const void* node) {
+    auto it = nodes_.find(node);
+    if (it != nodes_.end()) {
+      WriteUint8(static_cast<uint8_t>(SnapshotTag::Ref));
+      WriteUint32(it->second);
+      return false;
+    }
+    uint32_t index = static_cast<uint32_t>(nodes_.size());
+    nodes_[node] = index;
+    return true;
+  }
+
+  std::vector<uint8_t>& Bytes() {
+    return bytes_;
+  }
+
+private:
+  std::vector<uint8_t> bytes_;
+  std::unordered_map<const void*, uint32_t> nodes_;
+};
+
+class Go::SnapshotReader {
+public:
+  explicit SnapshotReader(const std::vector<uint8_t>& bytes)
+      : bytes_{bytes} {
+  }
+
+  uint8_t ReadUint8() {
+    return *ReadBytes(1);
+  }
+
+  uint32_t ReadUint32() {
+    const uint8_t* p = ReadBytes(4);
+    uint32_t v = 0;
+    for (int i = 0; i < 4; i++) {
+      v |= static_cast<uint32_t>(p[i]) << (8 * i);
+    }
+    return v;
+  }
+
+  uint64_t ReadUint64() {
+    const uint8_t* p = ReadBytes(8);
+    uint64_t v = 0;
+    for (int i = 0; i < 8; i++) {
+      v |= static_cast<uint64_t>(p[i]) << (8 * i);
+    }
+    return v;
+  }
+
+  double ReadFloat64() {
+    uint64_t bits = ReadUint64();
+    double v;
+    std::memcpy(&v, &bits, sizeof(v));
+    return v;
+  }
+
+  const uint8_t* ReadBytes(size_t size) {
+    if (size > bytes_.size() - pos_) {
+      ThrowBrokenSnapshot();
+    }
+    const uint8_t* p = bytes_.data() + pos_;
+    pos_ += size;
+    return p;
+  }
+
+  std::string ReadString() {
+    uint32_t size = ReadUint32();
+    const uint8_t* p = ReadBytes(size);
+    return std::string{p, p + size};
+  }
+
+  bool AtEnd() const {
+    return pos_ == bytes_.size();
+  }
+
+  void AddNode(Value node) {
+    nodes_.push_back(node);
+  }
+
+  Value GetNode(uint32_t index) const {
+    if (index >= nodes_.size()) {
+      ThrowBrokenSnapshot();
+    }
+    return nodes_[index];
+  }
+
+private:
+  const std::vector<uint8_t>& bytes_;
+  size_t pos_ = 0;
+  std::vector<Value> nodes_;
+};
+
+constexpr int Go::kShutdownExitCode;
+
+std::map<std::string, std::string> Go::HostEnv() {
+#ifdef _WIN32
+  char** envp = _environ;
+#else
+  char** envp = environ;
+#endif
+  std::map<std::string, std::string> env;
+  for (char** e = envp; e && *e; e++) {
+    std::string str{*e};
+    size_t pos = str.find('=');
+    // Skip entries without '=' and Windows' special entries like '=C:'.
+    if (pos == std::string::npos || pos == 0) {
+      continue;
+    }
+    env[str.substr(0, pos)] = str.substr(pos + 1);
+  }
+  return env;
 }
 
 Go::Go()
+    : Go{nullptr} {
+}
+
+Go::Go(IHost* host)
     : import_{this},
+      host_{host},
+      global_{Value::MakeGlobal()},
+      empty_args_{std::vector<Value>()},
       debug_writer_{std::cerr},
       pending_event_{Value::Null()} {
 }
@@ -709,8 +1593,40 @@ int Go::Run(int argc, char** argv) {
 }
 
 int Go::Run(const std::vector<std::string>& args) {
+  return Run(args, std::map<std::string, std::string>{});
+}
+
+int Go::Run(const std::vector<std::string>& args, const std::map<std::string, std::string>& env) {
+  Start(args, env);
+  while (!CheckExited()) {
+    TaskQueue::Task task = task_queue_.Dequeue();
+    // A task might be enqueued between Shutdown's discarding the tasks and closing the queue, e.g. by a timer that has
+    // just fired.
+    if (CheckExited()) {
+      break;
+    }
+    task();
+  }
+  Release();
+  return static_cast<int>(exit_code_);
+}
+
+void Go::Start() {
+  Start(std::vector<std::string>{});
+}
+
+void Go::Start(int argc, char** argv) {
+  std::vector<std::string> args(argv, argv + argc);
+  Start(args);
+}
+
+void Go::Init() {
+  thread_id_ = std::this_thread::get_id();
   mem_ = std::make_unique<Mem>();
   inst_ = std::make_unique<Inst>(mem_.get(), &import_);
+  if (host_) {
+    host_->mem_ = mem_.get();
+  }
 
   values_ = {
     Value{std::nan("")},
@@ -718,7 +1634,7 @@ int Go::Run(const std::vector<std::string>& args) {
     Value::Null(),
     Value{true},
     Value{false},
-    Value::Global(),
+    global_,
     Value{std::make_unique<GoObject>(this)},
   };
   static constexpr double inf = std::numeric_limits<double>::infinity();
@@ -735,6 +1651,57 @@ int Go::Run(const std::vector<std::string>& args) {
   id_pool_ = {};
   exited_ = false;
   exit_code_ = 0;
+  // Discard the tasks and the shutdown request left by the previous run.
+  shutdown_requested_ = false;
+  task_queue_.Clear();
+  task_queue_.Open();
+}
+
+bool Go::CheckExited() {
+  if (shutdown_requested_.exchange(false) && !exited_) {
+    exited_ = true;
+    exit_code_ = kShutdownExitCode;
+  }
+  return exited_;
+}
+
+void Go::Start(const std::vector<std::string>& args) {
+  Start(args, std::map<std::string, std::string>{});
+}
+
+void Go::Start(const std::vector<std::string>& args, const std::map<std::string, std::string>& env) {
+  // 'js' is requried as the first argument.
+  std::vector<std::string> margs = args;
+  if (margs.size() == 0) {
+    margs.push_back("js");
+  } else {
+    margs[0] = "js";
+  }
+  std::vector<std::string> envs;
+  // The keys are sorted as std::map is ordered, as in wasm_exec.js.
+  for (const auto& kv : env) {
+    envs.push_back(kv.first + "=" + kv.second);
+  }
+
+  // The strings and the pointers to them are put between 4096 and the data, which the Go linker guarantees to start
+  // from kWasmMinDataAddr. Check the size before writing anything.
+  static constexpr int32_t kWasmMinDataAddr = 4096 + 8192;
+  auto aligned_size = [](const std::string& str) -> size_t {
+    size_t size = str.size() + 1;
+    return (size + 7) / 8 * 8;
+  };
+  size_t size = (margs.size() + 1 + envs.size() + 1) * 8;
+  for (const std::string& arg : margs) {
+    size += aligned_size(arg);
+  }
+  for (const std::string& e : envs) {
+    size += aligned_size(e);
+  }
+  if (size >= kWasmMinDataAddr - 4096) {
+    throw std::runtime_error("Go::Start: total length of command line and environment variables exceeds limit");
+  }
+
+  Init();
 
   int32_t offset = 4096;
   auto str_ptr = [this, &offset](const std::string& str) -> int32_t {
@@ -749,20 +1716,15 @@ int Go::Run(const std::vector<std::string>& args) {
     return ptr;
   };
 
-  // 'js' is requried as the first argument.
-  std::vector<std::string> margs = args;
-  if (margs.size() == 0) {
-    margs.push_back("js");
-  } else {
-    margs[0] = "js";
-  }
   int argc = margs.size();
   std::vector<int32_t> argv_ptrs;
   for (const std::string& arg : margs) {
     argv_ptrs.push_back(str_ptr(arg));
   }
   argv_ptrs.push_back(0);
-  // TODO: Add environment variables.
+  for (const std::string& e : envs) {
+    argv_ptrs.push_back(str_ptr(e));
+  }
   argv_ptrs.push_back(0);
 
   int32_t argv = offset;
@@ -772,16 +1734,416 @@ int Go::Run(const std::vector<std::string>& args) {
     offset += 8;
   }
 
-  inst_->run(argc, argv);
+{{if .CrashHandler}}  InstallCrashHandler(inst_.get(), mem_.get());
 
-  while (!exited_) {
-    TaskQueue::Task task = task_queue_.Dequeue();
+{{end}}  {
+{{if .CrashHandler}}    CrashHandlerScope crash_handler_scope{inst_.get(), mem_.get()};
+{{end}}    go_call_depth_++;
+    inst_->run(argc, argv);
+    go_call_depth_--;
+  }
+  if (CheckExited()) {
+    Release();
+  }
+}
+
+int Go::RunPendingTasks(std::chrono::steady_clock::duration max_duration) {
+  if (std::this_thread::get_id() != thread_id_) {
+    error("RunPendingTasks must be called on Start's thread");
+  }
+  task_queue_.DrainWakeupFd();
+  auto start = std::chrono::steady_clock::now();
+  int n = 0;
+  TaskQueue::Task task;
+  while (!CheckExited() && task_queue_.TryDequeue(&task)) {
+    if (CheckExited()) {
+      break;
+    }
     task();
+    n++;
+    if (std::chrono::steady_clock::now() - start >= max_duration) {
+      break;
+    }
+  }
+  if (CheckExited()) {
+    Release();
+    return n;
   }
+  // The wakeup file descriptor was drained above. Signal the host again if max_duration passes before the tasks run
+  // out.
+  task_queue_.Rewake();
+  return n;
+}
+
+int Go::Poll() {
+  return RunPendingTasks(std::chrono::steady_clock::duration::max());
+}
+
+bool Go::IsExited() const {
+  return exited_;
+}
 
+int Go::ExitCode() const {
   return static_cast<int>(exit_code_);
 }
 
+void Go::Shutdown() {
+  shutdown_requested_ = true;
+  {
+    std::lock_guard<std::mutex> lock{timeouts_mutex_};
+    for (auto& timeout : scheduled_timeouts_) {
+      timeout.second->Stop();
+    }
+  }
+  task_queue_.Clear();
+  // Enqueue an empty task to wake up Run's loop, the wakeup callback, and the wakeup file descriptor. The loop
+  // exits before running it.
+  task_queue_.Enqueue([]{});
+  // The tasks enqueued after this are discarded so that their promises are broken.
+  task_queue_.Close();
+}
+
+std::vector<uint8_t> Go::Snapshot() {
+  if (std::this_thread::get_id() != thread_id_) {
+    error("Go::Snapshot: Snapshot must be called on the same thread as Run or Start");
+  }
+  if (!mem_ || exited_) {
+    error("Go::Snapshot: Go program is not running");
+  }
+  if (go_call_depth_ > 0) {
+    error("Go::Snapshot: Snapshot must not be called while a Go function is running");
+  }
+
+  SnapshotWriter writer;
+  writer.WriteBytes(reinterpret_cast<const uint8_t*>(kSnapshotMagic), sizeof(kSnapshotMagic));
+  writer.WriteUint32(kSnapshotVersion);
+  writer.WriteString(kModuleHash);
+  writer.WriteUint64(static_cast<uint64_t>(PreciseNowInNanoseconds()));
+
+  int32_t pages = mem_->GetSize();
+  writer.WriteUint32(static_cast<uint32_t>(pages));
+  for (int32_t i = 0; i < pages; i++) {
+    BytesSpan page = mem_->LoadSliceDirectly(static_cast<int64_t>(i) * Mem::kPageSize, Mem::kPageSize);
+    writer.WriteBytes(page.begin(), page.size());
+  }
+
+  std::vector<uint64_t> globals = inst_->GetGlobals();
+  writer.WriteUint32(static_cast<uint32_t>(globals.size()));
+  for (uint64_t global : globals) {
+    writer.WriteUint64(global);
+  }
+
+  writer.WriteUint32(static_cast<uint32_t>(values_.size()));
+  for (const Value& value : values_) {
+    WriteSnapshotValue(&writer, value);
+  }
+  writer.WriteUint32(static_cast<uint32_t>(go_ref_counts_.size()));
+  for (double count : go_ref_counts_) {
+    writer.WriteFloat64(count);
+  }
+
+  // Copy the pool to keep the order of the IDs.
+  std::stack<int32_t, std::vector<int32_t>> pool = id_pool_;
+  std::vector<int32_t> pool_ids;
+  while (!pool.empty()) {
+    pool_ids.push_back(pool.top());
+    pool.pop();
+  }
+  writer.WriteUint32(static_cast<uint32_t>(pool_ids.size()));
+  for (auto it = pool_ids.rbegin(); it != pool_ids.rend(); it++) {
+    writer.WriteUint32(static_cast<uint32_t>(*it));
+  }
+
+  for (const auto* cache : {&cached_args_, &cached_events_}) {
+    writer.WriteUint32(static_cast<uint32_t>(cache->size()));
+    for (const auto& kv : *cache) {
+      writer.WriteUint32(static_cast<uint32_t>(kv.first));
+      WriteSnapshotValue(&writer, kv.second);
+    }
+  }
+  WriteSnapshotValue(&writer, pending_event_);
+
+  writer.WriteUint32(static_cast<uint32_t>(next_callback_timeout_id_));
+  auto now = std::chrono::steady_clock::now();
+  writer.WriteUint32(static_cast<uint32_t>(timeout_deadlines_.size()));
+  for (const auto& kv : timeout_deadlines_) {
+    double remaining = std::chrono::duration<double, std::milli>(kv.second - now).count();
+    writer.WriteUint32(static_cast<uint32_t>(kv.first));
+    writer.WriteFloat64(std::max(remaining, 0.0));
+  }
+
+  return std::move(writer.Bytes());
+}
+
+void Go::Restore(const std::vector<uint8_t>& snapshot) {
+  if (mem_) {
+    error("Go::Restore: Go program is already running");
+  }
+
+  SnapshotReader reader{snapshot};
+  if (std::memcmp(reader.ReadBytes(sizeof(kSnapshotMagic)), kSnapshotMagic, sizeof(kSnapshotMagic)) != 0 ||
+      reader.ReadUint32() != kSnapshotVersion) {
+    ThrowBrokenSnapshot();
+  }
+  if (reader.ReadString() != kModuleHash) {
+    throw std::runtime_error("Go::Restore: the snapshot is for another module");
+  }
+
+  Init();
+  try {
+    int64_t elapsed = static_cast<int64_t>(reader.ReadUint64());
+
+    int32_t pages = static_cast<int32_t>(reader.ReadUint32());
+    if (pages < mem_->GetSize()) {
+      ThrowBrokenSnapshot();
+    }
+    mem_->Grow(pages - mem_->GetSize());
+    if (mem_->GetSize() != pages) {
+      ThrowBrokenSnapshot();
+    }
+    for (int32_t i = 0; i < pages; i++) {
+      BytesSpan page = mem_->LoadSliceDirectly(static_cast<int64_t>(i) * Mem::kPageSize, Mem::kPageSize);
+      std::memcpy(page.begin(), reader.ReadBytes(page.size()), page.size());
+    }
+
+    std::vector<uint64_t> globals(reader.ReadUint32());
+    if (globals.size() != inst_->GetGlobals().size()) {
+      ThrowBrokenSnapshot();
+    }
+    for (uint64_t& global : globals) {
+      global = reader.ReadUint64();
+    }
+    inst_->SetGlobals(globals);
+
+    // Read the values into local variables first, since MakeFuncWrapper modifies the tables.
+    std::vector<Value> values;
+    for (uint32_t n = reader.ReadUint32(), i = 0; i < n; i++) {
+      values.push_back(ReadSnapshotValue(&reader, Value{}));
+    }
+    std::vector<double> go_ref_counts;
+    for (uint32_t n = reader.ReadUint32(), i = 0; i < n; i++) {
+      go_ref_counts.push_back(reader.ReadFloat64());
+    }
+    if (values.size() != go_ref_counts.size()) {
+      ThrowBrokenSnapshot();
+    }
+    std::stack<int32_t, std::vector<int32_t>> id_pool;
+    for (uint32_t n = reader.ReadUint32(), i = 0; i < n; i++) {
+      id_pool.push(static_cast<int32_t>(reader.ReadUint32()));
+    }
+    std::unordered_map<int32_t, Value> caches[2];
+    for (auto& cache : caches) {
+      for (uint32_t n = reader.ReadUint32(), i = 0; i < n; i++) {
+        int32_t id = static_cast<int32_t>(reader.ReadUint32());
+        cache[id] = ReadSnapshotValue(&reader, Value{});
+      }
+    }
+    Value pending_event = ReadSnapshotValue(&reader, Value{});
+
+    int32_t next_callback_timeout_id = static_cast<int32_t>(reader.ReadUint32());
+    std::vector<std::pair<int32_t, double>> timeouts;
+    for (uint32_t n = reader.ReadUint32(), i = 0; i < n; i++) {
+      int32_t id = static_cast<int32_t>(reader.ReadUint32());
+      timeouts.emplace_back(id, reader.ReadFloat64());
+    }
+    if (!reader.AtEnd()) {
+      ThrowBrokenSnapshot();
+    }
+
+    values_ = std::move(values);
+    go_ref_counts_ = std::move(go_ref_counts);
+    ids_.clear();
+    // The ID 0 is for NaN and is not registered, as in Start.
+    for (size_t i = 1; i < values_.size(); i++) {
+      if (!values_[i].IsUndefined()) {
+        ids_[values_[i]] = static_cast<int32_t>(i);
+      }
+    }
+    id_pool_ = std::move(id_pool);
+    cached_args_ = std::move(caches[0]);
+    cached_events_ = std::move(caches[1]);
+    pending_event_ = pending_event;
+    next_callback_timeout_id_ = next_callback_timeout_id;
+    start_time_point_ = std::chrono::high_resolution_clock::now() -
+        std::chrono::duration_cast<std::chrono::high_resolution_clock::duration>(std::chrono::nanoseconds(elapsed));
+    for (const auto& timeout : timeouts) {
+      ScheduleTimeout(timeout.first, timeout.second);
+    }
+  } catch (...) {
+    Release();
+    throw;
+  }
+{{if .CrashHandler}}
+  InstallCrashHandler(inst_.get(), mem_.get());
+{{end -}}
+}
+
+void Go::WriteSnapshotValue(SnapshotWriter* writer, Value value) {
+  if (value.IsUndefined()) {
+    writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::Undefined));
+    return;
+  }
+  if (value.IsNull()) {
+    writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::Null));
+    return;
+  }
+  if (value.IsBool()) {
+    writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::Bool));
+    writer->WriteUint8(value.ToBool() ? 1 : 0);
+    return;
+  }
+  if (value.IsNumber()) {
+    writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::Number));
+    writer->WriteFloat64(value.ToNumber());
+    return;
+  }
+  if (value.IsString()) {
+    writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::String));
+    writer->WriteString(value.ToString());
+    return;
+  }
+  if (value.IsArray()) {
+    std::vector<Value>& array = value.ToArray();
+    if (!writer->AddNode(&array)) {
+      return;
+    }
+    if (&array == &empty_args_.ToArray()) {
+      writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::EmptyArgs));
+      return;
+    }
+    writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::Array));
+    writer->WriteUint32(static_cast<uint32_t>(array.size()));
+    for (const Value& v : array) {
+      WriteSnapshotValue(writer, v);
+    }
+    return;
+  }
+
+  Object& object = value.ToObject();
+  if (!writer->AddNode(&object)) {
+    return;
+  }
+  if (&object == &global_.ToObject()) {
+    writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::Global));
+    WriteSnapshotEntries(writer, object);
+    return;
+  }
+  if (dynamic_cast<GoObject*>(&object)) {
+    writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::GoObject));
+    return;
+  }
+  if (FuncWrapper* f = dynamic_cast<FuncWrapper*>(&object)) {
+    writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::FuncWrapper));
+    writer->WriteUint32(static_cast<uint32_t>(f->Id()));
+    return;
+  }
+  if (dynamic_cast<DictionaryValues*>(&object)) {
+    writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::Dictionary));
+    WriteSnapshotEntries(writer, object);
+    return;
+  }
+  writer->WriteUint8(static_cast<uint8_t>(SnapshotTag::HostObject));
+  writer->WriteString(object.ToString());
+  WriteSnapshotEntries(writer, object);
+}
+
+void Go::WriteSnapshotEntries(SnapshotWriter* writer, Object& object) {
+  std::vector<std::string> keys = object.Keys();
+  writer->WriteUint32(static_cast<uint32_t>(keys.size()));
+  for (const std::string& key : keys) {
+    writer->WriteString(key);
+    WriteSnapshotValue(writer, object.Get(key));
+  }
+}
+
+Value Go::ReadSnapshotValue(SnapshotReader* reader, Value existing) {
+  switch (static_cast<SnapshotTag>(reader->ReadUint8())) {
+  case SnapshotTag::Undefined:
+    return Value{};
+  case SnapshotTag::Null:
+    return Value::Null();
+  case SnapshotTag::Bool:
+    return Value{reader->ReadUint8() != 0};
+  case SnapshotTag::Number:
+    return Value{reader->ReadFloat64()};
+  case SnapshotTag::String:
+    return Value{reader->ReadString()};
+  case SnapshotTag::Ref:
+    return reader->GetNode(reader->ReadUint32());
+  case SnapshotTag::Array: {
+    Value array{std::vector<Value>{}};
+    reader->AddNode(array);
+    uint32_t n = reader->ReadUint32();
+    for (uint32_t i = 0; i < n; i++) {
+      Value v = ReadSnapshotValue(reader, Value{});
+      array.ToArray().push_back(v);
+    }
+    return array;
+  }
+  case SnapshotTag::EmptyArgs:
+    reader->AddNode(empty_args_);
+    return empty_args_;
+  case SnapshotTag::Global:
+    reader->AddNode(global_);
+    ReadSnapshotEntries(reader, global_);
+    return global_;
+  case SnapshotTag::GoObject: {
+    Value v{std::make_shared<GoObject>(this)};
+    reader->AddNode(v);
+    return v;
+  }
+  case SnapshotTag::FuncWrapper: {
+    Value v = MakeFuncWrapper(static_cast<int32_t>(reader->ReadUint32()));
+    reader->AddNode(v);
+    return v;
+  }
+  case SnapshotTag::Dictionary: {
+    Value v = existing;
+    if (!v.IsObject() || !dynamic_cast<DictionaryValues*>(&v.ToObject())) {
+      v = Value{std::make_shared<DictionaryValues>()};
+    }
+    reader->AddNode(v);
+    ReadSnapshotEntries(reader, v);
+    return v;
+  }
+  case SnapshotTag::HostObject: {
+    std::string name = reader->ReadString();
+    Value v = existing;
+    if (!v.IsObject()) {
+      v = Value{std::make_shared<UnrestoredObject>(name)};
+    }
+    reader->AddNode(v);
+    ReadSnapshotEntries(reader, v);
+    return v;
+  }
+  }
+  ThrowBrokenSnapshot();
+  return Value{};
+}
+
+void Go::ReadSnapshotEntries(SnapshotReader* reader, Value target) {
+  Object& object = target.ToObject();
+  bool placeholder = dynamic_cast<UnrestoredObject*>(&object) != nullptr;
+  bool dictionary = dynamic_cast<DictionaryValues*>(&object) != nullptr;
+  for (uint32_t n = reader->ReadUint32(), i = 0; i < n; i++) {
+    std::string key = reader->ReadString();
+    Value current = placeholder ? Value{} : object.Get(key);
+    Value v = ReadSnapshotValue(reader, current);
+    // Only the values in dictionaries are replaced. The properties of the host objects are kept.
+    if (dictionary && !(v == current)) {
+      object.Set(key, v);
+    }
+  }
+}
+
+void Go::SetWakeupCallback(std::function<void()> callback) {
+  task_queue_.SetWakeupCallback(std::move(callback));
+}
+
+int Go::WakeupFd() {
+  return task_queue_.WakeupFd();
+}
+
 Go::Import::Import(Go* go)
     : go_{go} {
 }
@@ -884,21 +2246,53 @@ void Go::Resume() {
   if (exited_) {
     error("Go program has already exited");
   }
+{{if .CrashHandler}}  CrashHandlerScope crash_handler_scope{inst_.get(), mem_.get()};
+{{end}}  go_call_depth_++;
   inst_->resume();
+  go_call_depth_--;
   // In wasm_exec.js, |exitPromise| is resolved.
   // In this C++, the loop automatically ends when |exited_| is true.
 }
 
+void Go::Release() {
+  // Release is called after the program exits and no Go function is running.
+  {
+    std::lock_guard<std::mutex> lock{timeouts_mutex_};
+    for (auto& timeout : scheduled_timeouts_) {
+      timeout.second->Stop();
+    }
+    // The timers' threads are joined here.
+    scheduled_timeouts_.clear();
+  }
+  timeout_deadlines_.clear();
+  // The tasks enqueued after this are discarded so that their promises are broken.
+  task_queue_.Close();
+  task_queue_.Clear();
+{{if .CrashHandler}}
+  UninstallCrashHandler(inst_.get());
+{{end}}
+  pending_event_ = Value::Null();
+  cached_args_.clear();
+  cached_events_.clear();
+  values_.clear();
+  go_ref_counts_.clear();
+  ids_.clear();
+  id_pool_ = {};
+  if (host_) {
+    host_->mem_ = nullptr;
+  }
+  inst_.reset();
+  mem_.reset();
+}
+
 Value Go::MakeFuncWrapper(int32_t id) {
-  // empty_args is a Value of an empty array for arguments.
+  // empty_args_ is used for all the callbacks without arguments.
   // This assumes that the argment array is never modified in the callbacks.
   // By using the same Value, this can avoid being finalized at syscall/js.finalizeRef.
-  static Value empty_args = Value{std::vector<Value>()};
-
   static constexpr double inf = std::numeric_limits<double>::infinity();
-  go_ref_counts_[GetIdFromValue(empty_args)] = inf;
+  go_ref_counts_[GetIdFromValue(empty_args_)] = inf;
 
-  return Value{std::make_shared<Function>(
+  return Value{std::make_shared<FuncWrapper>(id,
     [this, id](Value self, std::vector<Value> args) -> Value {
       Value argsv;
 
@@ -922,7 +2316,7 @@ Value Go::MakeFuncWrapper(int32_t id) {
           go_ref_counts_[GetIdFromValue(argsv)] = inf;
         }
       } else {
-        argsv = empty_args;
+        argsv = empty_args_;
       }
 
       auto it = cached_events_.find(id);
@@ -968,34 +2362,55 @@ double Go::UnixNowInMilliseconds() {
 int32_t Go::SetTimeout(double interval) {
   int32_t id = next_callback_timeout_id_;
   next_callback_timeout_id_++;
+  ScheduleTimeout(id, interval);
+  return id;
+}
+
+void Go::ScheduleTimeout(int32_t id, double interval) {
   std::unique_ptr<Timer> timer = std::make_unique<Timer>(
     [this, id] {
       task_queue_.Enqueue([this, id]{
         Resume();
-        while (scheduled_timeouts_.find(id) != scheduled_timeouts_.end()) {
+        while (HasTimeout(id)) {
           // for some reason Go failed to register the timeout event, log and try again
           // (temporary workaround for https://github.com/golang/go/issues/28975)
           Resume();
         }
       });
     }, interval);
-  scheduled_timeouts_[id] = std::move(timer);
-  return id;
+  {
+    std::lock_guard<std::mutex> lock{timeouts_mutex_};
+    scheduled_timeouts_[id] = std::move(timer);
+  }
+  timeout_deadlines_[id] = std::chrono::steady_clock::now() +
+      std::chrono::duration_cast<std::chrono::steady_clock::duration>(std::chrono::duration<double, std::milli>(interval));
 }
 
 void Go::ClearTimeout(int32_t id) {
-  if (scheduled_timeouts_.find(id) != scheduled_timeouts_.end()) {
-    scheduled_timeouts_[id]->Stop();
+  std::unique_ptr<Timer> timer;
+  {
+    std::lock_guard<std::mutex> lock{timeouts_mutex_};
+    auto it = scheduled_timeouts_.find(id);
+    if (it != scheduled_timeouts_.end()) {
+      timer = std::move(it->second);
+      scheduled_timeouts_.erase(it);
+    }
   }
-  scheduled_timeouts_.erase(id);
+  if (timer) {
+    timer->Stop();
+  }
+  timeout_deadlines_.erase(id);
+}
+
+bool Go::HasTimeout(int32_t id) {
+  std::lock_guard<std::mutex> lock{timeouts_mutex_};
+  return scheduled_timeouts_.find(id) != scheduled_timeouts_.end();
 }
 
 void Go::GetRandomBytes(BytesSpan bytes) {
-  // TODO: Use cryptographically strong random values instead of std::random_device.
-  static std::random_device rd;
   std::uniform_int_distribution<uint8_t> dist(0, 255);
   for (int i = 0; i < bytes.size(); i++) {
-    bytes[i] = dist(rd);
+    bytes[i] = dist(random_device_);
   }
 }
 
@@ -1003,6 +2418,10 @@ void Go::EnqueueTask(std::function<void()> task) {
   task_queue_.Enqueue(task);
 }
 
+Value Go::Global() const {
+  return global_;
+}
+
 int32_t Go::GetIdFromValue(Value value) {
   auto it = ids_.find(value);
   if (it != ids_.end()) {
@@ -1028,6 +2447,64 @@ int32_t Go::GetIdFromValue(Value value) {
   return id;
 }
 
+std::future<Value> Go::CallFunction(const std::string& name, std::vector<Value> args) {
+  // The promise is owned only by the task, so that the future throws when the task is discarded.
+  auto promise = std::make_shared<TaskPromise<Value>>();
+  std::future<Value> future = promise->GetFuture();
+  auto task = [this, name, args, promise = std::move(promise)]() {
+    if (exited_) {
+      promise->SetException(std::make_exception_ptr(std::runtime_error("Go program has already exited")));
+      return;
+    }
+    Value f = Value::ReflectGet(global_, name);
+    if (!f.IsObject() || !f.ToObject().IsFunction()) {
+      promise->SetException(std::make_exception_ptr(std::runtime_error("Go::CallFunction: " + name + " is not a function")));
+      return;
+    }
+    promise->SetValue(Value::ReflectApply(f, global_, args));
+  };
+  if (std::this_thread::get_id() == thread_id_) {
+    task();
+  } else {
+    EnqueueTask(task);
+  }
+  return future;
+}
+
+void Go::CallExport(const std::function<void()>& func) {
+  if (std::this_thread::get_id() != thread_id_) {
+    // The promise is owned only by the task, so that the future throws when the task is discarded.
+    auto done = std::make_shared<TaskPromise<void>>();
+    std::future<void> future = done->GetFuture();
+    EnqueueTask([this, &func, done = std::move(done)]() {
+      try {
+        CallExport(func);
+      } catch (...) {
+        done->SetException(std::current_exception());
+        return;
+      }
+      done->SetValue();
+    });
+    future.get();
+    return;
+  }
+  if (exited_) {
+    throw std::runtime_error("Go program has already exited");
+  }
+{{if .CrashHandler}}  CrashHandlerScope crash_handler_scope{inst_.get(), mem_.get()};
+{{end}}  go_call_depth_++;
+  func();
+  go_call_depth_--;
+}
+{{range $value := .Exports}}
+{{$value.GoCppImpl}}{{end}}
+IHost* Go::Host() {
+  if (!host_) {
+    error("Go::Host: the module imports host functions but no IHost is given");
+  }
+  return host_;
+}
+
 }
 `))
 
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// isRuntimeImportModule reports whether the import module is implemented by the runtime. An unknown import from
+// such a module is an error instead of a host function, as this means the module's version is not supported.
+func isRuntimeImportModule(module string) bool {
+	switch module {
+	case "go", "gojs", wasiModuleName:
+		return true
+	}
+	return false
+}
+
+// hostFuncBody returns the body of the imported function that calls the embedder's implementation.
+// owner is the name of the member variable of the runtime in the runtime's Import class.
+func (f *wasmFunc) hostFuncBody(owner string) string {
+	var args []string
+	for i := range f.Wasm.Sig.ParamTypes {
+		args = append(args, fmt.Sprintf("local%d_", i))
+	}
+	call := fmt.Sprintf("%s->Host()->%s(%s)", owner, f.Identifier(), strings.Join(args, ", "))
+	if len(f.Wasm.Sig.ReturnTypes) > 0 {
+		return "  return " + call + ";"
+	}
+	return "  " + call + ";"
+}
+
+func writeHost(dir string, incpath string, namespace string, runtime string, importFuncs []*wasmFunc) error {
+	var hostFuncs []*wasmFunc
+	for _, f := range importFuncs {
+		if f.Host {
+			hostFuncs = append(hostFuncs, f)
+		}
+	}
+
+	f, err := os.Create(filepath.Join(dir, "host.h"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := hostHTmpl.Execute(f, struct {
+		IncludeGuard string
+		Namespace    string
+		Runtime      string
+		HostFuncs    []*wasmFunc
+	}{
+		IncludeGuard: includeGuard(namespace) + "_HOST_H",
+		Namespace:    namespace,
+		Runtime:      runtime,
+		HostFuncs:    hostFuncs,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+var hostHTmpl = template.Must(template.New("host.h").Parse(`// Code generated by go2cpp. DO NOT EDIT.
+
+#ifndef {{.IncludeGuard}}
+#define {{.IncludeGuard}}
+
+#include <cstdint>
+
+namespace {{.Namespace}} {
+
+class Mem;
+
+// IHost provides the functions that the module imports from other modules than the runtime's, like Go's functions
+// with //go:wasmimport. The embedder implements IHost and passes it to {{.Runtime}}'s constructor.
+//
+// The arguments and the return values are passed as they are. A pointer is an offset in the linear memory, which
+// is available via GetMem.
+//
+// A method is named after the module and the field of the import joined with "__", e.g. env__add for the field add
+// of the module env. As for the other functions, '.' is replaced with "__", and the other characters that cannot be
+// used in identifiers are replaced with '_' or escaped. A name that conflicts with another name gets a hash suffix.
+// The OriginalName comment of each method shows the module and the field joined with '.'.
+class IHost {
+public:
+  virtual ~IHost() = default;
+{{range $value := .HostFuncs}}
+{{$value.CppDecl "  " true false}}
+{{end}}
+protected:
+  // GetMem returns the linear memory of the running module, or nullptr if the module is not running.
+  Mem* GetMem() const { return mem_; }
+
+private:
+  friend class {{.Runtime}};
+
+  Mem* mem_ = nullptr;
+};
+
+}
+
+#endif  // {{.IncludeGuard}}
+`))
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxIdentifierLength is the maximum length of an identifier.
+// A longer identifier is truncated and gets a hash suffix.
+const maxIdentifierLength = 256
+
+// identifierFromString returns a readable C++ identifier for the given name like a Go symbol name.
+//
+// For example, main.(*Foo).Bar is converted to main__Foo__Bar.
+// The result might collide with other names. Use assignIdentifiers to get unique identifiers.
+//
+// The result never ends with '_' so that it never conflicts with member variables and local variables.
+func identifierFromString(str string) string {
+	name := str
+
+	// Go's linker replaces the characters other than [0-9A-Za-z_.] with '_' in the name section.
+	// Restore the receivers like (*T) from __T_ for readability.
+	if !strings.ContainsAny(name, "()*") {
+		tokens := strings.Split(name, ".")
+		for i, t := range tokens {
+			if i == 0 {
+				continue
+			}
+			if len(t) > 3 && strings.HasPrefix(t, "__") && strings.HasSuffix(t, "_") && t[2] != '_' {
+				tokens[i] = t[2 : len(t)-1]
+			}
+		}
+		name = strings.Join(tokens, ".")
+	}
+
+	var b strings.Builder
+	// sep reports whether the last byte is '_' for a special character.
+	sep := false
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		c := name[i]
+		i += size
+
+		switch {
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', c == '_':
+			b.WriteByte(c)
+			sep = false
+		case c == '.':
+			b.WriteString("__")
+			sep = false
+		case c == '(' || c == ')' || c == '*':
+			// Drop the decorations of methods like (*T).
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, "x%02x", c)
+			sep = false
+		case r >= utf8.RuneSelf:
+			// Unicode characters are escaped to keep the identifiers ASCII.
+			if r <= 0xffff {
+				fmt.Fprintf(&b, "u%04x", r)
+			} else {
+				fmt.Fprintf(&b, "U%08x", r)
+			}
+			sep = false
+		default:
+			if !sep {
+				b.WriteByte('_')
+				sep = true
+			}
+		}
+	}
+
+	ident := strings.TrimRight(b.String(), "_")
+	if ident == "" {
+		ident = "func"
+	}
+	if '0' <= ident[0] && ident[0] <= '9' {
+		ident = "f" + ident
+	}
+	if len(ident) > maxIdentifierLength {
+		ident = ident[:maxIdentifierLength-9] + "_" + identifierHash(str)
+	}
+	return ident
+}
+
+// identifierHash returns a short and deterministic hash of the name.
+func identifierHash(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// cppKeywords is the list of C++ keywords and alternative tokens.
+var cppKeywords = []string{
+	"alignas", "alignof", "and", "and_eq", "asm", "auto", "bitand", "bitor", "bool", "break", "case", "catch", "char",
+	"char8_t", "char16_t", "char32_t", "class", "co_await", "co_return", "co_yield", "compl", "concept", "const",
+	"consteval", "constexpr", "constinit", "const_cast", "continue", "decltype", "default", "delete", "do", "double",
+	"dynamic_cast", "else", "enum", "explicit", "export", "extern", "false", "float", "for", "friend", "goto", "if",
+	"inline", "int", "long", "mutable", "namespace", "new", "noexcept", "not", "not_eq", "nullptr", "operator", "or",
+	"or_eq", "private", "protected", "public", "register", "reinterpret_cast", "requires", "return", "short",
+	"signed", "sizeof", "static", "static_assert", "static_cast", "struct", "switch", "template", "this",
+	"thread_local", "throw", "true", "try", "typedef", "typeid", "typename", "union", "unsigned", "using", "virtual",
+	"void", "volatile", "wchar_t", "while", "xor", "xor_eq",
+	// Macros and names that are likely to conflict.
+	"assert", "errno", "linux", "unix", "NULL", "EOF",
+}
+
+// instMethodNames is the list of the member functions of Inst other than functions from Wasm.
+var instMethodNames = []string{
+	"Inst",
+	"GetGlobals",
+	"SetGlobals",
+	"GetMem",
+	"GetGlobal",
+	"SetGlobal",
+	"CallFunc",
+	"GetFuncType",
+	"GetSignature",
+	"GetTableElement",
+}
+
+// checkExportName returns an error if the export name cannot be used as it is as a member function of Inst.
+func checkExportName(name string) error {
+	// identifierFromString keeps a valid identifier as it is, unless it ends with '_' like member variables.
+	if identifierFromString(name) != name {
+		return fmt.Errorf("export %q is not a valid C++ identifier", name)
+	}
+	for _, k := range cppKeywords {
+		if name == k {
+			return fmt.Errorf("export %s is a C++ keyword", name)
+		}
+	}
+	for _, n := range instMethodNames {
+		if name == n {
+			return fmt.Errorf("export %s conflicts with a member of Inst", name)
+		}
+	}
+	return nil
+}
+
+// assignIdentifiers assigns unique identifiers to all the functions in the same C++ class.
+//
+// When identifiers of functions collide with each other or with reserved names, the functions get hash suffixes
+// of their original names. The results are deterministic and don't depend on the order of the functions.
+func assignIdentifiers(fs []*wasmFunc, reserved []string) error {
+	used := map[string]struct{}{}
+	for _, r := range cppKeywords {
+		used[r] = struct{}{}
+	}
+	for _, r := range instMethodNames {
+		used[r] = struct{}{}
+	}
+	for _, r := range reserved {
+		used[r] = struct{}{}
+	}
+
+	idents := map[string][]*wasmFunc{}
+	for _, f := range fs {
+		ident := identifierFromString(f.Wasm.Name)
+		idents[ident] = append(idents[ident], f)
+	}
+
+	var conflicted []*wasmFunc
+	for ident, fs := range idents {
+		if _, ok := used[ident]; ok || len(fs) > 1 {
+			conflicted = append(conflicted, fs...)
+			continue
+		}
+		fs[0].ident = ident
+	}
+	for _, f := range fs {
+		if f.ident != "" {
+			used[f.ident] = struct{}{}
+		}
+	}
+
+	sort.Slice(conflicted, func(i, j int) bool {
+		return conflicted[i].Index < conflicted[j].Index
+	})
+	for _, f := range conflicted {
+		base := identifierFromString(f.Wasm.Name)
+		if len(base) > maxIdentifierLength-9 {
+			base = base[:maxIdentifierLength-9]
+		}
+		ident := base + "_" + identifierHash(f.Wasm.Name)
+		if _, ok := used[ident]; ok {
+			// The original names are the same.
+			ident = fmt.Sprintf("%s_%d", ident, f.Index)
+		}
+		if _, ok := used[ident]; ok {
+			return fmt.Errorf("identifier %s for %s conflicts", ident, f.Wasm.Name)
+		}
+		f.ident = ident
+		used[ident] = struct{}{}
+	}
+	return nil
+}
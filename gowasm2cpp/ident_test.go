@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+func TestIdentifierFromString(t *testing.T) {
+	cases := []struct {
+		In  string
+		Out string
+	}{
+		{In: "main.main", Out: "main__main"},
+		{In: "main.(*Foo).Bar", Out: "main__Foo__Bar"},
+		{In: "fmt.__pp_.printArg", Out: "fmt__pp__printArg"},
+		{In: "syscall/js.valueGet", Out: "syscall_js__valueGet"},
+		{In: "type:.eq.[2]interface {}", Out: "type___eq___2_interface"},
+		{In: "_rt0_wasm_js", Out: "_rt0_wasm_js"},
+		{In: "main.こんにちは", Out: "main__u3053u3093u306bu3061u306f"},
+		{In: "main.\xff", Out: "main__xff"},
+		{In: "0abc", Out: "f0abc"},
+		{In: "", Out: "func"},
+	}
+	for _, c := range cases {
+		got := identifierFromString(c.In)
+		if got != c.Out {
+			t.Errorf("identifierFromString(%q): got: %s, want: %s", c.In, got, c.Out)
+		}
+	}
+
+	long := strings.Repeat("a", 1000)
+	if got := identifierFromString(long); len(got) > maxIdentifierLength {
+		t.Errorf("len(identifierFromString(long)): got: %d, want: <= %d", len(got), maxIdentifierLength)
+	}
+	if identifierFromString(long+"b") == identifierFromString(long+"c") {
+		t.Errorf("identifierFromString must not truncate long names into the same identifier")
+	}
+}
+
+func TestAssignIdentifiers(t *testing.T) {
+	names := []string{
+		"main.T.String",
+		"main.(*T).String",
+		"main.__T_.String",
+		"main.main",
+		"delete",
+		"run",
+	}
+	var fs []*wasmFunc
+	for i, n := range names {
+		fs = append(fs, &wasmFunc{
+			Wasm:  wasm.Function{Name: n},
+			Index: i,
+		})
+	}
+	if err := assignIdentifiers(fs, []string{"run"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fs[3].Identifier(), "main__main"; got != want {
+		t.Errorf("fs[3].Identifier(): got: %s, want: %s", got, want)
+	}
+	used := map[string]struct{}{}
+	for _, f := range fs {
+		id := f.Identifier()
+		if _, ok := used[id]; ok {
+			t.Errorf("identifier %s is duplicated", id)
+		}
+		used[id] = struct{}{}
+	}
+	for _, i := range []int{0, 1, 2, 4, 5} {
+		if got, prefix := fs[i].Identifier(), identifierFromString(names[i])+"_"; !strings.HasPrefix(got, prefix) {
+			t.Errorf("fs[%d].Identifier(): got: %s, want: %s...", i, got, prefix)
+		}
+	}
+}
+
+func TestCheckExportName(t *testing.T) {
+	cases := []struct {
+		In string
+		OK bool
+	}{
+		{In: "add", OK: true},
+		{In: "_start", OK: true},
+		{In: "Add2", OK: true},
+		{In: "2add", OK: false},
+		{In: "add-one", OK: false},
+		{In: "main.add", OK: false},
+		{In: "add_", OK: false},
+		{In: "", OK: false},
+		{In: "delete", OK: false},
+		{In: "GetMem", OK: false},
+		{In: "GetGlobals", OK: false},
+	}
+	for _, c := range cases {
+		err := checkExportName(c.In)
+		if got := err == nil; got != c.OK {
+			t.Errorf("checkExportName(%q): got: %v, want error: %v", c.In, err, !c.OK)
+		}
+	}
+}
+
+func TestGoExports(t *testing.T) {
+	for _, name := range []string{"Run", "Shutdown", "kShutdownExitCode", "CheckExited", "error", "Value", "int32_t"} {
+		if _, err := goExports([]*wasmExport{{Name: name}}); err == nil {
+			t.Errorf("goExports with %s must return an error", name)
+		}
+	}
+
+	// The names of the local variables and the parameters in Go's members don't conflict.
+	names := []string{"run", "add", "start", "size", "count", "name", "value", "id", "key", "index", "callback", "data", "offset", "args", "code", "e", "v"}
+	var es []*wasmExport
+	for _, n := range names {
+		es = append(es, &wasmExport{Name: n})
+	}
+	exports, err := goExports(es)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(exports), len(names)-1; got != want {
+		t.Errorf("len(goExports(...)): got: %d, want: %d", got, want)
+	}
+}
+
+// isIdentifierByte reports whether c can be a part of a C++ identifier.
+func isIdentifierByte(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+// declaredName returns the name that the C++ declaration in one line declares, like Run in
+// "int Run(const std::vector<std::string>& args);". declaredName returns an empty string for a definition of a
+// qualified name like Go::Run.
+func declaredName(line string) string {
+	for _, prefix := range []string{"class ", "struct ", "enum class "} {
+		if strings.HasPrefix(line, prefix) {
+			line = line[len(prefix):]
+			n := 0
+			for n < len(line) && isIdentifierByte(line[n]) {
+				n++
+			}
+			if strings.HasPrefix(line[n:], "::") {
+				return ""
+			}
+			return line[:n]
+		}
+	}
+	i := strings.IndexAny(line, "(=;{[")
+	if i < 0 {
+		return ""
+	}
+	head := strings.TrimRight(line[:i], " ")
+	j := len(head)
+	for j > 0 && isIdentifierByte(head[j-1]) {
+		j--
+	}
+	if strings.HasSuffix(head[:j], "::") {
+		return ""
+	}
+	return head[j:]
+}
+
+func TestGoMemberNames(t *testing.T) {
+	// Collect the declarations directly in the class Go, which are indented with two spaces.
+	members := map[string]struct{}{}
+	var inClass bool
+	for _, line := range strings.Split(goHTmpl.Tree.Root.String(), "\n") {
+		if line == "class Go {" {
+			inClass = true
+			continue
+		}
+		if !inClass {
+			continue
+		}
+		if line == "};" {
+			break
+		}
+		if !strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "   ") {
+			continue
+		}
+		line = strings.TrimPrefix(strings.TrimSpace(line), "~")
+		if strings.HasPrefix(line, "//") || strings.HasPrefix(line, "template ") || strings.HasSuffix(line, ":") || strings.Contains(line, "{{") {
+			continue
+		}
+		name := declaredName(line)
+		if name == "" || strings.HasSuffix(name, "_") {
+			continue
+		}
+		members[name] = struct{}{}
+	}
+
+	got := append([]string{}, goMemberNames...)
+	sort.Strings(got)
+	var want []string
+	for n := range members {
+		want = append(want, n)
+	}
+	sort.Strings(want)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("goMemberNames: got: %v, want: %v", got, want)
+	}
+
+	// Check the declarations at namespace scope in go.cpp.
+	namespaceNames := map[string]struct{}{}
+	for _, n := range goNamespaceNames {
+		namespaceNames[n] = struct{}{}
+	}
+	for _, line := range strings.Split(goCppTmpl.Tree.Root.String(), "\n") {
+		if line == "" || strings.IndexAny(line[:1], " #}") == 0 || strings.HasPrefix(line, "{{") {
+			continue
+		}
+		if strings.HasPrefix(line, "//") || strings.HasPrefix(line, "namespace ") || strings.HasPrefix(line, "extern ") || strings.HasSuffix(line, ":") {
+			continue
+		}
+		name := declaredName(line)
+		if name == "" {
+			continue
+		}
+		if _, ok := namespaceNames[name]; !ok {
+			t.Errorf("goNamespaceNames doesn't have %s", name)
+		}
+	}
+}
@@ -2,6 +2,12 @@
 
 package gowasm2cpp
 
+import (
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// importFuncBodies is the bodies of the functions that Go's js/wasm port imports, common to all the supported Go
+// versions.
 var importFuncBodies = map[string]string{
 	// func wasmExit(code int32)
 	"runtime.wasmExit": `  int32_t code = go_->mem_->LoadInt32(local0_ + 8);
@@ -28,11 +34,6 @@ var importFuncBodies = map[string]string{
 	// func nanotime1() int64
 	"runtime.nanotime1": `  go_->mem_->StoreInt64(local0_ + 8, go_->PreciseNowInNanoseconds());`,
 
-	// func walltime1() (sec int64, nsec int32)
-	"runtime.walltime1": `  double now = go_->UnixNowInMilliseconds();
-  go_->mem_->StoreInt64(local0_ + 8, static_cast<int64_t>(now / 1000));
-  go_->mem_->StoreInt32(local0_ + 16, static_cast<int32_t>(std::fmod(now, 1000) * 1000000));`,
-
 	// func scheduleTimeoutEvent(delay int64) int32
 	"runtime.scheduleTimeoutEvent": `  int64_t interval = go_->mem_->LoadInt64(local0_ + 8);
   int32_t id = go_->SetTimeout(static_cast<double>(interval));
@@ -81,18 +82,32 @@ var importFuncBodies = map[string]string{
 	"syscall/js.valueCall": `  Value v = go_->LoadValue(local0_ + 8);
   Value m = Value::ReflectGet(v, go_->mem_->LoadString(local0_ + 16));
   std::vector<Value> args = go_->LoadSliceOfValues(local0_ + 32);
-  Value result = Value::ReflectApply(m, v, args);
+  Value result;
+  bool ok = true;
+  try {
+    result = Value::ReflectApply(m, v, args);
+  } catch (const Exception& e) {
+    result = e.GetValue();
+    ok = false;
+  }
   local0_ = go_->inst_->getsp();
   go_->StoreValue(local0_ + 56, result);
-  go_->mem_->StoreInt8(local0_ + 64, 1);`,
+  go_->mem_->StoreInt8(local0_ + 64, ok ? 1 : 0);`,
 
 	// func valueInvoke(v ref, args []ref) (ref, bool)
 	"syscall/js.valueInvoke": `  Value v = go_->LoadValue(local0_ + 8);
   std::vector<Value> args = go_->LoadSliceOfValues(local0_ + 16);
-  Value result = Value::ReflectApply(v, Value{}, args);
+  Value result;
+  bool ok = true;
+  try {
+    result = Value::ReflectApply(v, Value{}, args);
+  } catch (const Exception& e) {
+    result = e.GetValue();
+    ok = false;
+  }
   local0_ = go_->inst_->getsp();
   go_->StoreValue(local0_ + 40, result);
-  go_->mem_->StoreInt8(local0_ + 48, 1);`,
+  go_->mem_->StoreInt8(local0_ + 48, ok ? 1 : 0);`,
 
 	// func valueNew(v ref, args []ref) (ref, bool)
 	"syscall/js.valueNew": `  Value v = go_->LoadValue(local0_ + 8);
@@ -152,3 +167,84 @@ var importFuncBodies = map[string]string{
 
 	"debug": `  std::cout << local0_ << std::endl;`,
 }
+
+// walltimeFuncBody is the body of runtime.walltime, which was named runtime.walltime1 before Go 1.17.
+//
+// func walltime() (sec int64, nsec int32)
+const walltimeFuncBody = `  double now = go_->UnixNowInMilliseconds();
+  go_->mem_->StoreInt64(local0_ + 8, static_cast<int64_t>(now / 1000));
+  go_->mem_->StoreInt32(local0_ + 16, static_cast<int32_t>(std::fmod(now, 1000) * 1000000));`
+
+// importKey identifies an imported function by its module name and field name.
+type importKey struct {
+	module string
+	field  string
+}
+
+func (k importKey) String() string {
+	return k.module + "." + k.field
+}
+
+// importTable is a set of the imported functions that the runtime implements for a host ABI.
+type importTable struct {
+	// name is the name of the ABI like go1.21.
+	name string
+
+	// wasi reports whether the ABI is WASI preview1. Otherwise, the ABI is Go's js/wasm port.
+	wasi bool
+
+	bodies map[importKey]string
+}
+
+func newImportTable(name string, wasi bool, module string, bodies ...map[string]string) *importTable {
+	t := &importTable{
+		name:   name,
+		wasi:   wasi,
+		bodies: map[importKey]string{},
+	}
+	for _, b := range bodies {
+		for field, body := range b {
+			t.bodies[importKey{module: module, field: field}] = body
+		}
+	}
+	return t
+}
+
+// importTables is the import tables of the supported ABIs, from older to newer.
+//
+// Go's js/wasm port has changed the imports over versions:
+//
+//   - Go 1.17 renamed runtime.walltime1 back to runtime.walltime.
+//   - Go 1.21 moved all the imports from the module go to gojs.
+var importTables = []*importTable{
+	newImportTable("go1.15", false, "go", importFuncBodies, map[string]string{"runtime.walltime1": walltimeFuncBody}),
+	newImportTable("go1.17", false, "go", importFuncBodies, map[string]string{"runtime.walltime": walltimeFuncBody}),
+	newImportTable("go1.21", false, "gojs", importFuncBodies, map[string]string{"runtime.walltime": walltimeFuncBody}),
+	newImportTable(wasiModuleName, true, wasiModuleName, wasiImportFuncBodies),
+}
+
+// detectImportTable returns the import table that implements the most imports of the module.
+// If some tables implement the same number of imports, the newest one is chosen.
+func detectImportTable(mod *wasm.Module) *importTable {
+	var result *importTable
+	max := -1
+	for _, t := range importTables {
+		n := 0
+		if mod.Import != nil {
+			for _, e := range mod.Import.Entries {
+				if _, ok := t.bodies[importKey{module: e.ModuleName, field: e.FieldName}]; ok {
+					n++
+				}
+			}
+		}
+		// The WASI table is chosen only when the module imports WASI functions.
+		if t.wasi && n == 0 {
+			continue
+		}
+		if n >= max {
+			result = t
+			max = n
+		}
+	}
+	return result
+}
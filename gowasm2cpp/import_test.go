@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"testing"
+
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+func TestDetectImportTable(t *testing.T) {
+	cases := []struct {
+		In  []importKey
+		Out string
+	}{
+		{
+			In:  nil,
+			Out: "go1.21",
+		},
+		{
+			In:  []importKey{{"go", "runtime.wasmExit"}, {"go", "runtime.walltime1"}},
+			Out: "go1.15",
+		},
+		{
+			In:  []importKey{{"go", "runtime.wasmExit"}, {"go", "runtime.walltime"}},
+			Out: "go1.17",
+		},
+		{
+			In:  []importKey{{"gojs", "runtime.wasmExit"}, {"gojs", "runtime.walltime"}},
+			Out: "go1.21",
+		},
+		{
+			In:  []importKey{{"wasi_snapshot_preview1", "fd_write"}, {"env", "foo"}},
+			Out: "wasi_snapshot_preview1",
+		},
+	}
+	for _, c := range cases {
+		mod := &wasm.Module{
+			Import: &wasm.SectionImports{},
+		}
+		for _, k := range c.In {
+			mod.Import.Entries = append(mod.Import.Entries, wasm.ImportEntry{
+				ModuleName: k.module,
+				FieldName:  k.field,
+			})
+		}
+		if got, want := detectImportTable(mod).name, c.Out; got != want {
+			t.Errorf("detectImportTable(%v): got: %v, want: %v", c.In, got, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"fmt"
+
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// ModuleInfo describes a parsed Wasm module from the converter's point of view.
+type ModuleInfo struct {
+	// Target is the host environment that the module expects: js for GOOS=js, wasip1 for GOOS=wasip1, and wasi for
+	// the other modules importing WASI preview1 functions like TinyGo's.
+	Target string `json:"target"`
+
+	// ABI is the version of the imports detected from the module's import set, like go1.21 or
+	// wasi_snapshot_preview1.
+	ABI string `json:"abi"`
+
+	Imports  []ImportInfo `json:"imports"`
+	Exports  []ExportInfo `json:"exports"`
+	NumFuncs int          `json:"numFuncs"`
+	Funcs    []FuncInfo   `json:"funcs"`
+}
+
+// ImportInfo describes an imported function.
+type ImportInfo struct {
+	Index  int    `json:"index"`
+	Module string `json:"module"`
+	Field  string `json:"field"`
+
+	// Implemented reports whether the runtime has a body for the import.
+	Implemented bool `json:"implemented"`
+
+	// Host reports whether the import is provided by the embedder via IHost.
+	Host bool `json:"host,omitempty"`
+}
+
+// ExportInfo describes an exported entity.
+type ExportInfo struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Index int    `json:"index"`
+}
+
+// FuncInfo describes a function defined in the module.
+type FuncInfo struct {
+	Index     int    `json:"index"`
+	Name      string `json:"name"`
+	BodySize  int    `json:"bodySize"`
+	NumLocals int    `json:"numLocals"`
+
+	// Special reports whether the function body is replaced with a hand-written C++ body.
+	Special bool `json:"special,omitempty"`
+
+	// Unsupported is the reason why the function cannot be converted, or empty if the function can be converted.
+	Unsupported string `json:"unsupported,omitempty"`
+}
+
+func externalKindString(kind wasm.External) string {
+	switch kind {
+	case wasm.ExternalFunction:
+		return "func"
+	case wasm.ExternalTable:
+		return "table"
+	case wasm.ExternalMemory:
+		return "memory"
+	case wasm.ExternalGlobal:
+		return "global"
+	default:
+		return fmt.Sprintf("unknown(%d)", kind)
+	}
+}
+
+// Inspect parses the given Wasm file and returns the information about the module.
+func Inspect(wasmFile string) (*ModuleInfo, error) {
+	m, err := loadModule(wasmFile)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ModuleInfo{
+		Target:   "js",
+		ABI:      m.imports.name,
+		NumFuncs: len(m.ifs) + len(m.fs),
+	}
+	switch {
+	case m.goWASIP1:
+		info.Target = "wasip1"
+	case m.wasi:
+		info.Target = "wasi"
+	}
+
+	for i, e := range m.mod.Import.Entries {
+		info.Imports = append(info.Imports, ImportInfo{
+			Index:       i,
+			Module:      e.ModuleName,
+			Field:       e.FieldName,
+			Implemented: m.ifs[i].BodyStr != "" && !m.ifs[i].Host,
+			Host:        m.ifs[i].Host,
+		})
+	}
+
+	// Export.Entries is a map. Use Export.Names to keep the order in the module.
+	for _, name := range m.mod.Export.Names {
+		e := m.mod.Export.Entries[name]
+		info.Exports = append(info.Exports, ExportInfo{
+			Name:  e.FieldStr,
+			Kind:  externalKindString(e.Kind),
+			Index: int(e.Index),
+		})
+	}
+
+	for i, f := range m.fs {
+		fi := FuncInfo{
+			Index:    f.Index,
+			Name:     f.Wasm.Name,
+			BodySize: len(m.mod.Code.Bodies[i].Code),
+			Special:  f.BodyStr != "",
+		}
+		for _, l := range m.mod.Code.Bodies[i].Locals {
+			fi.NumLocals += int(l.Count)
+		}
+		if f.Wasm.Body != nil {
+			if err := f.checkConvertible(); err != nil {
+				fi.Unsupported = err.Error()
+			}
+		}
+		info.Funcs = append(info.Funcs, fi)
+	}
+
+	return info, nil
+}
+
+// checkConvertible reports an error when the function body cannot be converted to C++.
+func (f *wasmFunc) checkConvertible() error {
+	return recoverError(func() error {
+		_, err := f.bodyToCpp()
+		return err
+	})
+}
+
+// recoverError calls fn and converts a panic in fn into an error.
+func recoverError(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return fn()
+}
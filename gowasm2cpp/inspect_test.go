@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectExportOrder(t *testing.T) {
+	const src = `(module
+  (func $f)
+  (export "c" (func $f))
+  (export "a" (func $f))
+  (export "d" (func $f))
+  (export "b" (func $f)))
+`
+	dir, err := ioutil.TempDir("", "gowasm2cpp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wasmFile := filepath.Join(dir, "exports.wat")
+	if err := ioutil.WriteFile(wasmFile, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"c", "a", "d", "b"}
+	// The order must not depend on the map iteration order.
+	for i := 0; i < 10; i++ {
+		info, err := Inspect(wasmFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range info.Exports {
+			got = append(got, e.Name)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("exports: got: %v, want: %v", got, want)
+		}
+		for j := range got {
+			if got[j] != want[j] {
+				t.Fatalf("exports: got: %v, want: %v", got, want)
+			}
+		}
+	}
+}
@@ -19,7 +19,7 @@ func min(a, b int) int {
 	return b
 }
 
-func writeInst(dir string, incpath string, namespace string, importFuncs, funcs []*wasmFunc, exports []*wasmExport, globals []*wasmGlobal, types []*wasmType, tables [][]uint32) error {
+func writeInst(dir string, incpath string, namespace string, rt runtimeLib, importFuncs, funcs []*wasmFunc, exports []*wasmExport, globals []*wasmGlobal, types []*wasmType, tables [][]uint32, interp bool) error {
 	const groupSize = 64
 
 	sort.Slice(funcs, func(a, b int) bool {
@@ -55,6 +55,7 @@ func writeInst(dir string, incpath string, namespace string, importFuncs, funcs
 			NumFuncs            int
 			NumTable            int
 			NumMaxTableElements int
+			Interp              bool
 		}{
 			IncludeGuard:        includeGuard(namespace) + "_INST_H",
 			IncludePath:         incpath,
@@ -67,6 +68,7 @@ func writeInst(dir string, incpath string, namespace string, importFuncs, funcs
 			NumFuncs:            len(importFuncs) + len(funcs),
 			NumTable:            len(tables),
 			NumMaxTableElements: m,
+			Interp:              interp,
 		}); err != nil {
 			return err
 		}
@@ -75,8 +77,7 @@ func writeInst(dir string, incpath string, namespace string, importFuncs, funcs
 
 	groups := map[byte][]*wasmFunc{}
 	for _, f := range funcs {
-		n := f.Wasm.Name
-		g := n[0]
+		g := f.Identifier()[0]
 		groups[g] = append(groups[g], f)
 	}
 
@@ -93,10 +94,12 @@ func writeInst(dir string, incpath string, namespace string, importFuncs, funcs
 			if err := instFuncCppTmpl.Execute(f, struct {
 				IncludePath string
 				Namespace   string
+				RuntimeLib  runtimeLib
 				Funcs       []*wasmFunc
 			}{
 				IncludePath: incpath,
 				Namespace:   namespace,
+				RuntimeLib:  rt,
 				Funcs:       fs,
 			}); err != nil {
 				return err
@@ -143,6 +146,7 @@ func writeInst(dir string, incpath string, namespace string, importFuncs, funcs
 			Types       []*wasmType
 			Tables      [][]uint32
 			Globals     []*wasmGlobal
+			Interp      bool
 		}{
 			IncludePath: incpath,
 			Namespace:   namespace,
@@ -151,11 +155,56 @@ func writeInst(dir string, incpath string, namespace string, importFuncs, funcs
 			Types:       types,
 			Tables:      tables,
 			Globals:     globals,
+			Interp:      interp,
 		}); err != nil {
 			return err
 		}
 		return nil
 	})
+
+	// interpreter environment
+	if interp {
+		g.Go(func() error {
+			f, err := os.Create(filepath.Join(dir, "inst.interp.cpp"))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			funcTypes := make([]int, len(importFuncs)+len(funcs))
+			for _, f := range importFuncs {
+				funcTypes[f.Index] = f.Type.Index
+			}
+			for _, f := range funcs {
+				funcTypes[f.Index] = f.Type.Index
+			}
+			var numTableElements int
+			if len(tables) > 0 {
+				numTableElements = len(tables[0])
+			}
+
+			if err := instInterpCppTmpl.Execute(f, struct {
+				IncludePath      string
+				Namespace        string
+				ImportFuncs      []*wasmFunc
+				Types            []*wasmType
+				Globals          []*wasmGlobal
+				FuncTypes        []int
+				NumTableElements int
+			}{
+				IncludePath:      incpath,
+				Namespace:        namespace,
+				ImportFuncs:      importFuncs,
+				Types:            types,
+				Globals:          globals,
+				FuncTypes:        funcTypes,
+				NumTableElements: numTableElements,
+			}); err != nil {
+				return err
+			}
+			return nil
+		})
+	}
 	if err := g.Wait(); err != nil {
 		return err
 	}
@@ -167,7 +216,10 @@ var instHTmpl = template.Must(template.New("inst.h").Parse(`// Code generated by
 #ifndef {{.IncludeGuard}}
 #define {{.IncludeGuard}}
 
-#include <cstdint>
+{{if .Interp}}#include "{{.IncludePath}}interp.h"
+
+{{end}}#include <cstdint>
+#include <vector>
 
 namespace {{.Namespace}} {
 
@@ -181,10 +233,14 @@ public:
 
 {{end -}} };
 
-class Inst {
+class Inst{{if .Interp}} : private Interp::Env{{end}} {
 public:
   Inst(Mem* mem, IImport* import);
 
+  // GetGlobals returns the bits of the globals, and SetGlobals sets them. These are used for snapshots.
+  std::vector<uint64_t> GetGlobals() const;
+  void SetGlobals(const std::vector<uint64_t>& globals);
+
 {{range $value := .Exports}}{{$value.CppDecl "  "}}
 {{end}}
 private:
@@ -196,11 +252,20 @@ private:
 
 {{range $value := .Funcs}}{{$value.CppDecl "  " false false}}
 
+{{end}}{{if .Interp}}  Mem* GetMem() override;
+  uint64_t GetGlobal(uint32_t index) override;
+  void SetGlobal(uint32_t index, uint64_t value) override;
+  uint64_t CallFunc(uint32_t index, const uint64_t* args) override;
+  uint32_t GetFuncType(uint32_t index) override;
+  Interp::Signature GetSignature(uint32_t type) override;
+  int32_t GetTableElement(uint32_t index) override;
+
 {{end}}  Mem* mem_;
   IImport* import_;
   Func funcs_[{{.NumFuncs}}];
   uint32_t table_[{{.NumTable}}][{{.NumMaxTableElements}}];
-
+{{if .Interp}}  Interp interp_;
+{{end}}
 {{range $value := .Globals}}  {{$value.Cpp}}
 {{end}}};
 
@@ -213,7 +278,7 @@ var instFuncCppTmpl = template.Must(template.New("inst.funcs.cpp").Parse(`// Cod
 
 #include "{{.IncludePath}}inst.h"
 
-#include "{{.IncludePath}}bits.h"
+#include "{{.RuntimeLib.IncludePath}}bits.h"
 #include "{{.IncludePath}}mem.h"
 
 #include <cassert>
@@ -239,6 +304,8 @@ var instInitCppTmpl = template.Must(template.New("inst.init.cpp").Parse(`// Code
 
 #include "{{.IncludePath}}inst.h"
 
+#include <cstring>
+
 namespace {{.Namespace}} {
 
 IImport::~IImport() = default;
@@ -248,10 +315,91 @@ Inst::Inst(Mem* mem, IImport* import)
       import_{import},
       table_{
 {{range $value := .Tables}}        { {{- range $value2 := $value}}{{$value2}}, {{end}} },
-{{end}}      } {
+{{end}}      }{{if .Interp}},
+      interp_{this}{{end}} {
 {{range $value := .ImportFuncs}}  funcs_[{{.Index}}].type0_ = nullptr;
 {{end}}{{range $value := .Funcs}}  funcs_[{{.Index}}].type{{.Type.Index}}_ = &Inst::{{.Identifier}};
 {{end}}}
 
+std::vector<uint64_t> Inst::GetGlobals() const {
+  std::vector<uint64_t> globals({{len .Globals}});
+{{range $index, $value := .Globals}}  std::memcpy(&globals[{{$index}}], &global{{$value.Index}}_, sizeof(global{{$value.Index}}_));
+{{end}}  return globals;
+}
+
+void Inst::SetGlobals(const std::vector<uint64_t>& globals) {
+{{if not .Globals}}  (void)globals;
+{{end}}{{range $index, $value := .Globals}}  std::memcpy(&global{{$value.Index}}_, &globals[{{$index}}], sizeof(global{{$value.Index}}_));
+{{end}}}
+
+}
+`))
+
+var instInterpCppTmpl = template.Must(template.New("inst.interp.cpp").Parse(`// Code generated by go2cpp. DO NOT EDIT.
+
+#include "{{.IncludePath}}inst.h"
+
+#include "{{.IncludePath}}mem.h"
+
+#include <cassert>
+
+namespace {{.Namespace}} {
+
+Mem* Inst::GetMem() {
+  return mem_;
+}
+
+uint64_t Inst::GetGlobal(uint32_t index) {
+  switch (index) {
+{{range $value := .Globals}}  case {{.Index}}:
+    return Interp::From{{.InterpName}}(global{{.Index}}_);
+{{end}}  }
+  assert(((void)("not reached"), false));
+  return 0;
+}
+
+void Inst::SetGlobal(uint32_t index, uint64_t value) {
+  switch (index) {
+{{range $value := .Globals}}  case {{.Index}}:
+    global{{.Index}}_ = Interp::To{{.InterpName}}(value);
+    return;
+{{end}}  }
+  assert(((void)("not reached"), false));
+}
+
+uint64_t Inst::CallFunc(uint32_t index, const uint64_t* args) {
+  switch (index) {
+{{range $value := .ImportFuncs}}  case {{.Index}}:
+    {{.InterpCall}}
+{{end}}  }
+  switch (GetFuncType(index)) {
+{{range $value := .Types}}  case {{.Index}}:
+    {{.InterpCall}}
+{{end}}  }
+  assert(((void)("not reached"), false));
+  return 0;
+}
+
+uint32_t Inst::GetFuncType(uint32_t index) {
+  static const uint32_t types[] = {
+    {{range $value := .FuncTypes}}{{$value}}, {{end}}
+  };
+  return types[index];
+}
+
+Interp::Signature Inst::GetSignature(uint32_t type) {
+  static const Interp::Signature sigs[] = {
+{{range $value := .Types}}    { {{- len .Sig.ParamTypes}}, {{len .Sig.ReturnTypes}}},
+{{end}}  };
+  return sigs[type];
+}
+
+int32_t Inst::GetTableElement(uint32_t index) {
+  if (index >= {{.NumTableElements}}) {
+    return -1;
+  }
+  return static_cast<int32_t>(table_[0][index]);
+}
+
 }
 `))
@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const instancesMainCpp = `#include "go.h"
+
+#include <iostream>
+#include <thread>
+
+int main() {
+  const char* names[] = {"foo", "bar"};
+  int codes[2] = {};
+  std::thread threads[2];
+  for (int i = 0; i < 2; i++) {
+    threads[i] = std::thread([&names, &codes, i]() {
+      go2cpp_test::Go go;
+      go.Global().ToObject().Set("name", go2cpp_test::Value{names[i]});
+      codes[i] = go.Run(std::vector<std::string>{"test", names[i]});
+    });
+  }
+  for (std::thread& t : threads) {
+    t.join();
+  }
+  std::cout << "exit: " << codes[0] << " " << codes[1] << std::endl;
+  return 0;
+}
+`
+
+func TestMultipleInstances(t *testing.T) {
+	out := runCppProgram(t, "./testdata/instances", instancesMainCpp)
+	got := strings.Split(strings.TrimSpace(out), "\n")
+	sort.Strings(got)
+	want := []string{"bar: ok", "exit: 0 0", "foo: ok"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("output: got: %q, want: %q", got, want)
+	}
+}
+
+func TestSharedRuntime(t *testing.T) {
+	p := compileCppProgram(t, "./testdata/instances", &cppProgramOptions{
+		SharedRuntime: true,
+	})
+	defer p.remove()
+
+	for _, name := range []string{"bits.h", "bytes.h", "js.h", "taskqueue.h", "gl.h"} {
+		if _, err := os.Stat(filepath.Join(p.genDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s must not be generated with the program: %v", name, err)
+		}
+	}
+
+	got := strings.Split(strings.TrimSpace(p.run(t, "main", instancesMainCpp)), "\n")
+	sort.Strings(got)
+	want := []string{"bar: ok", "exit: 0 0", "foo: ok"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("output: got: %q, want: %q", got, want)
+	}
+}
+
+// cppProgram is a Go program translated into C++ and compiled into object files, which can be linked with main
+// functions.
+type cppProgram struct {
+	cxx      string
+	dir      string
+	genDir   string
+	wasmFile string
+	objs     []string
+}
+
+// cppProgramOptions represents the options of compileCppProgram.
+type cppProgramOptions struct {
+	// GOOS is the GOOS to build the Go package with. The default is js.
+	GOOS string
+
+	// SharedRuntime specifies whether the runtime is generated separately by GenerateRuntime with the namespace
+	// go2cpp_runtime.
+	SharedRuntime bool
+
+	// CrashHandler is passed to Options.
+	CrashHandler bool
+}
+
+// compileCppProgram builds the Go package for Wasm, translates it with the namespace go2cpp_test and compiles the
+// result. options can be nil. compileCppProgram skips the test in the short mode or when no C++ compiler is available.
+// The caller must call remove.
+func compileCppProgram(t *testing.T, pkg string, options *cppProgramOptions) *cppProgram {
+	if testing.Short() {
+		t.Skip("compiling C++ takes time")
+	}
+	if options == nil {
+		options = &cppProgramOptions{}
+	}
+	cxx := os.Getenv("CXX")
+	if cxx == "" {
+		cxx = "c++"
+	}
+	if _, err := exec.LookPath(cxx); err != nil {
+		t.Skip("C++ compiler is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "gowasm2cpp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	wasmFile := filepath.Join(dir, "main.wasm")
+	cmd := exec.Command("go", "build", "-o", wasmFile, pkg)
+	goos := options.GOOS
+	if goos == "" {
+		goos = "js"
+	}
+	cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+
+	genDir := filepath.Join(dir, "gen")
+	if err := os.MkdirAll(genDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	genOptions := &Options{
+		Interpreter:  true,
+		CrashHandler: options.CrashHandler,
+	}
+	var srcs []string
+	if options.SharedRuntime {
+		runtimeDir := filepath.Join(dir, "runtime")
+		if err := os.MkdirAll(runtimeDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := GenerateRuntime(runtimeDir, "go2cpp_runtime"); err != nil {
+			t.Fatal(err)
+		}
+		rtsrcs, err := filepath.Glob(filepath.Join(runtimeDir, "*.cpp"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, rtsrcs...)
+		// The runtime headers are included as "runtime/*.h" via the include directory dir.
+		genOptions.RuntimeNamespace = "go2cpp_runtime"
+		genOptions.RuntimeInclude = "runtime"
+	}
+	if err := GenerateWithOptions(genDir, "", wasmFile, "go2cpp_test", genOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	gensrcs, err := filepath.Glob(filepath.Join(genDir, "*.cpp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcs = append(srcs, gensrcs...)
+	p := &cppProgram{
+		cxx:      cxx,
+		dir:      dir,
+		genDir:   genDir,
+		wasmFile: wasmFile,
+	}
+	for _, src := range srcs {
+		obj := strings.TrimSuffix(src, ".cpp") + ".o"
+		args := append(p.cxxFlags(), "-c", "-o", obj, src)
+		if out, err := exec.Command(cxx, args...).CombinedOutput(); err != nil {
+			t.Fatalf("compiling C++ failed: %v\n%s", err, out)
+		}
+		p.objs = append(p.objs, obj)
+	}
+	succeeded = true
+	return p
+}
+
+// remove removes the files of the program.
+func (p *cppProgram) remove() {
+	os.RemoveAll(p.dir)
+}
+
+func (p *cppProgram) cxxFlags() []string {
+	return []string{"-std=c++14", "-w", "-O0", "-pthread", "-I" + p.genDir, "-I" + p.dir}
+}
+
+// build links the program with the main function. build returns the path of the executable.
+func (p *cppProgram) build(t *testing.T, name string, mainCpp string) string {
+	mainFile := filepath.Join(p.dir, name+".cpp")
+	if err := ioutil.WriteFile(mainFile, []byte(mainCpp), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(p.dir, name)
+	args := append(p.cxxFlags(), "-o", bin, mainFile)
+	args = append(args, p.objs...)
+	if out, err := exec.Command(p.cxx, args...).CombinedOutput(); err != nil {
+		t.Fatalf("compiling C++ failed: %v\n%s", err, out)
+	}
+	return bin
+}
+
+// run links the program with the main function and runs it. run returns the standard output.
+func (p *cppProgram) run(t *testing.T, name string, mainCpp string) string {
+	out, err := exec.Command(p.build(t, name, mainCpp)).Output()
+	if err != nil {
+		t.Fatalf("running C++ failed: %v\n%s", err, out)
+	}
+	return string(out)
+}
+
+// runCppProgram compiles the Go package with the main function and runs it. runCppProgram returns the standard
+// output.
+func runCppProgram(t *testing.T, pkg string, mainCpp string) string {
+	p := compileCppProgram(t, pkg, nil)
+	defer p.remove()
+	return p.run(t, "main", mainCpp)
+}
@@ -0,0 +1,1073 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+func writeInterp(dir string, incpath string, namespace string, rt runtimeLib) error {
+	{
+		f, err := os.Create(filepath.Join(dir, "interp.h"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err := interpHTmpl.Execute(f, struct {
+			IncludeGuard string
+			IncludePath  string
+			Namespace    string
+		}{
+			IncludeGuard: includeGuard(namespace) + "_INTERP_H",
+			IncludePath:  incpath,
+			Namespace:    namespace,
+		}); err != nil {
+			return err
+		}
+	}
+	{
+		f, err := os.Create(filepath.Join(dir, "interp.cpp"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err := interpCppTmpl.Execute(f, struct {
+			IncludePath string
+			Namespace   string
+			RuntimeLib  runtimeLib
+		}{
+			IncludePath: incpath,
+			Namespace:   namespace,
+			RuntimeLib:  rt,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interpBody returns the C++ function body that executes the original Wasm bytecode with the interpreter.
+func (f *wasmFunc) interpBody() []string {
+	var numLocals int
+	for _, e := range f.Wasm.Body.Locals {
+		numLocals += int(e.Count)
+	}
+
+	var body []string
+	body = append(body, "  // This function is executed by the interpreter as the translator cannot convert this.")
+
+	var code bytes.Buffer
+	for i, b := range f.Wasm.Body.Code {
+		if i%16 == 0 {
+			if i > 0 {
+				code.WriteString("\n")
+			}
+			code.WriteString("    ")
+		} else {
+			code.WriteString(" ")
+		}
+		fmt.Fprintf(&code, "%d,", b)
+	}
+	body = append(body, "  static const uint8_t code[] = {")
+	body = append(body, strings.Split(code.String(), "\n")...)
+	body = append(body, "  };")
+	body = append(body, fmt.Sprintf("  static const Interp::Func func = {code, sizeof(code), %d, %d};", f.Type.Index, numLocals))
+
+	var args []string
+	for i, t := range f.Wasm.Sig.ParamTypes {
+		args = append(args, fmt.Sprintf("Interp::From%s(local%d_)", wasmTypeToReturnType(t).interpName(), i))
+	}
+	argsVar := "nullptr"
+	if len(args) > 0 {
+		body = append(body, fmt.Sprintf("  uint64_t args[] = {%s};", strings.Join(args, ", ")))
+		argsVar = "args"
+	}
+
+	call := fmt.Sprintf("interp_.Call(func, %s)", argsVar)
+	switch ts := f.Wasm.Sig.ReturnTypes; len(ts) {
+	case 0:
+		body = append(body, fmt.Sprintf("  %s;", call))
+	default:
+		body = append(body, fmt.Sprintf("  return Interp::To%s(%s);", wasmTypeToReturnType(ts[0]).interpName(), call))
+	}
+	return body
+}
+
+// interpName returns the suffix of the conversion functions of the interpreter, like Interp::FromI32.
+func (r returnType) interpName() string {
+	switch r {
+	case returnTypeI32:
+		return "I32"
+	case returnTypeI64:
+		return "I64"
+	case returnTypeF32:
+		return "F32"
+	case returnTypeF64:
+		return "F64"
+	default:
+		panic("not reached")
+	}
+}
+
+// InterpName returns the suffix of the interpreter's conversion functions for the global variable.
+func (g *wasmGlobal) InterpName() string {
+	return wasmTypeToReturnType(g.Type).interpName()
+}
+
+// interpCall returns the C++ statement to call the function from the interpreter.
+// The arguments are passed as args, and the result is returned as uint64_t.
+func interpCall(callee string, sig *wasm.FunctionSig) (string, error) {
+	var args []string
+	for i, t := range sig.ParamTypes {
+		args = append(args, fmt.Sprintf("Interp::To%s(args[%d])", wasmTypeToReturnType(t).interpName(), i))
+	}
+	call := fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", "))
+	switch ts := sig.ReturnTypes; len(ts) {
+	case 0:
+		return fmt.Sprintf("%s;\n    return 0;", call), nil
+	case 1:
+		return fmt.Sprintf("return Interp::From%s(%s);", wasmTypeToReturnType(ts[0]).interpName(), call), nil
+	default:
+		return "", fmt.Errorf("the number of return values must be 0 or 1 but %d", len(ts))
+	}
+}
+
+// InterpCall returns the C++ statement to call the imported function from the interpreter.
+func (f *wasmFunc) InterpCall() (string, error) {
+	return interpCall("import_->"+f.Identifier(), f.Wasm.Sig)
+}
+
+// InterpCall returns the C++ statement to call the function of the type from the interpreter.
+func (t *wasmType) InterpCall() (string, error) {
+	return interpCall(fmt.Sprintf("(this->*funcs_[index].type%d_)", t.Index), t.Sig)
+}
+
+var interpHTmpl = template.Must(template.New("interp.h").Parse(`// Code generated by go2cpp. DO NOT EDIT.
+
+#ifndef {{.IncludeGuard}}
+#define {{.IncludeGuard}}
+
+#include <cstdint>
+#include <cstring>
+#include <unordered_map>
+
+namespace {{.Namespace}} {
+
+class Mem;
+
+// Interp is a small WebAssembly interpreter.
+// Interp executes the functions that the translator cannot convert to C++.
+//
+// All the values are represented as uint64_t. 32bit values are stored in the lower bits.
+class Interp {
+public:
+  struct Signature {
+    int32_t num_params;
+    int32_t num_results;
+  };
+
+  struct Func {
+    const uint8_t* code;
+    int32_t code_size;
+    uint32_t type;
+    int32_t num_locals;
+  };
+
+  // Env is the environment that the interpreted functions access.
+  class Env {
+  public:
+    virtual ~Env();
+    virtual Mem* GetMem() = 0;
+    virtual uint64_t GetGlobal(uint32_t index) = 0;
+    virtual void SetGlobal(uint32_t index, uint64_t value) = 0;
+    virtual uint64_t CallFunc(uint32_t index, const uint64_t* args) = 0;
+    virtual uint32_t GetFuncType(uint32_t index) = 0;
+    virtual Signature GetSignature(uint32_t type) = 0;
+
+    // GetTableElement returns -1 if the index is out of range.
+    virtual int32_t GetTableElement(uint32_t index) = 0;
+  };
+
+  explicit Interp(Env* env);
+  uint64_t Call(const Func& func, const uint64_t* args);
+
+  static uint64_t FromI32(int32_t v) {
+    return static_cast<uint32_t>(v);
+  }
+
+  static uint64_t FromI64(int64_t v) {
+    return static_cast<uint64_t>(v);
+  }
+
+  static uint64_t FromF32(float v) {
+    uint32_t r;
+    std::memcpy(&r, &v, sizeof(r));
+    return r;
+  }
+
+  static uint64_t FromF64(double v) {
+    uint64_t r;
+    std::memcpy(&r, &v, sizeof(r));
+    return r;
+  }
+
+  static int32_t ToI32(uint64_t v) {
+    return static_cast<int32_t>(static_cast<uint32_t>(v));
+  }
+
+  static int64_t ToI64(uint64_t v) {
+    return static_cast<int64_t>(v);
+  }
+
+  static float ToF32(uint64_t v) {
+    uint32_t bits = static_cast<uint32_t>(v);
+    float r;
+    std::memcpy(&r, &bits, sizeof(r));
+    return r;
+  }
+
+  static double ToF64(uint64_t v) {
+    double r;
+    std::memcpy(&r, &v, sizeof(r));
+    return r;
+  }
+
+private:
+  // Blocks is the positions of the matching else and end instructions of the blocks.
+  struct Blocks {
+    std::unordered_map<int32_t, int32_t> elses;
+    std::unordered_map<int32_t, int32_t> ends;
+  };
+
+  Interp(const Interp&) = delete;
+  Interp& operator=(const Interp&) = delete;
+
+  const Blocks& GetBlocks(const Func& func);
+
+  Env* env_;
+  std::unordered_map<const uint8_t*, Blocks> blocks_;
+};
+
+}
+
+#endif  // {{.IncludeGuard}}
+`))
+
+var interpCppTmpl = template.Must(template.New("interp.cpp").Parse(`// Code generated by go2cpp. DO NOT EDIT.
+
+#include "{{.IncludePath}}interp.h"
+
+#include "{{.RuntimeLib.IncludePath}}bits.h"
+#include "{{.IncludePath}}mem.h"
+
+#include <algorithm>
+#include <cassert>
+#include <cmath>
+#include <iostream>
+#include <limits>
+#include <string>
+#include <vector>
+
+namespace {{.Namespace}} {
+
+namespace {
+
+void error(const std::string& msg) {
+  std::cerr << msg << std::endl;
+  assert(false);
+  std::exit(1);
+}
+
+uint32_t ReadU32(const uint8_t* code, int32_t* pc) {
+  uint32_t result = 0;
+  int shift = 0;
+  for (;;) {
+    uint8_t b = code[(*pc)++];
+    result |= static_cast<uint32_t>(b & 0x7f) << shift;
+    shift += 7;
+    if (!(b & 0x80)) {
+      return result;
+    }
+  }
+}
+
+int64_t ReadS64(const uint8_t* code, int32_t* pc) {
+  uint64_t result = 0;
+  int shift = 0;
+  uint8_t b;
+  do {
+    b = code[(*pc)++];
+    result |= static_cast<uint64_t>(b & 0x7f) << shift;
+    shift += 7;
+  } while (b & 0x80);
+  if (shift < 64 && (b & 0x40)) {
+    result |= ~static_cast<uint64_t>(0) << shift;
+  }
+  return static_cast<int64_t>(result);
+}
+
+int32_t ReadS32(const uint8_t* code, int32_t* pc) {
+  return static_cast<int32_t>(ReadS64(code, pc));
+}
+
+void SkipImmediates(const uint8_t* code, int32_t* pc, uint8_t op) {
+  switch (op) {
+  case 0x02: // block
+  case 0x03: // loop
+  case 0x04: // if
+  case 0x3f: // memory.size
+  case 0x40: // memory.grow
+    (*pc)++;
+    break;
+  case 0x0c: // br
+  case 0x0d: // br_if
+  case 0x10: // call
+  case 0x20: // local.get
+  case 0x21: // local.set
+  case 0x22: // local.tee
+  case 0x23: // global.get
+  case 0x24: // global.set
+    ReadU32(code, pc);
+    break;
+  case 0x0e: { // br_table
+    uint32_t n = ReadU32(code, pc);
+    for (uint32_t i = 0; i < n + 1; i++) {
+      ReadU32(code, pc);
+    }
+    break;
+  }
+  case 0x11: // call_indirect
+    ReadU32(code, pc);
+    (*pc)++;
+    break;
+  case 0x41: // i32.const
+  case 0x42: // i64.const
+    ReadS64(code, pc);
+    break;
+  case 0x43: // f32.const
+    *pc += 4;
+    break;
+  case 0x44: // f64.const
+    *pc += 8;
+    break;
+  case 0xfc: {
+    uint32_t sub = ReadU32(code, pc);
+    switch (sub) {
+    case 8: // memory.init
+    case 10: // memory.copy
+      ReadU32(code, pc);
+      ReadU32(code, pc);
+      break;
+    case 9: // data.drop
+    case 11: // memory.fill
+      ReadU32(code, pc);
+      break;
+    }
+    break;
+  }
+  default:
+    if (0x28 <= op && op <= 0x3e) {
+      // Alignment and offset of load and store instructions.
+      ReadU32(code, pc);
+      ReadU32(code, pc);
+    }
+    break;
+  }
+}
+
+template<typename To, typename From>
+To TruncSat(From x) {
+  if (std::isnan(x)) {
+    return 0;
+  }
+  if (x <= static_cast<From>(std::numeric_limits<To>::min())) {
+    return std::numeric_limits<To>::min();
+  }
+  if (x >= static_cast<From>(std::numeric_limits<To>::max())) {
+    return std::numeric_limits<To>::max();
+  }
+  return static_cast<To>(x);
+}
+
+struct Label {
+  // cont is the position to continue when branching to this label.
+  int32_t cont;
+  size_t height;
+  int32_t arity;
+};
+
+}
+
+Interp::Env::~Env() = default;
+
+Interp::Interp(Env* env)
+    : env_{env} {
+}
+
+const Interp::Blocks& Interp::GetBlocks(const Func& func) {
+  auto it = blocks_.find(func.code);
+  if (it != blocks_.end()) {
+    return it->second;
+  }
+
+  Blocks& blocks = blocks_[func.code];
+  std::vector<int32_t> starts;
+  int32_t pc = 0;
+  while (pc < func.code_size) {
+    int32_t start = pc;
+    uint8_t op = func.code[pc++];
+    SkipImmediates(func.code, &pc, op);
+    switch (op) {
+    case 0x02: // block
+    case 0x03: // loop
+    case 0x04: // if
+      starts.push_back(start);
+      break;
+    case 0x05: // else
+      blocks.elses[starts.back()] = start;
+      break;
+    case 0x0b: // end
+      if (!starts.empty()) {
+        blocks.ends[starts.back()] = start;
+        starts.pop_back();
+      }
+      break;
+    }
+  }
+  return blocks;
+}
+
+uint64_t Interp::Call(const Func& func, const uint64_t* args) {
+  const Signature sig = env_->GetSignature(func.type);
+  const Blocks& blocks = GetBlocks(func);
+  const uint8_t* code = func.code;
+  Mem* mem = env_->GetMem();
+
+  std::vector<uint64_t> locals(sig.num_params + func.num_locals);
+  std::copy(args, args + sig.num_params, locals.begin());
+
+  std::vector<uint64_t> stack;
+  std::vector<Label> labels;
+  labels.push_back(Label{func.code_size, 0, sig.num_results});
+
+  auto pop = [&stack]() -> uint64_t {
+    uint64_t v = stack.back();
+    stack.pop_back();
+    return v;
+  };
+  auto push = [&stack](uint64_t v) {
+    stack.push_back(v);
+  };
+
+  // branch branches to the label at the given depth, and returns false when the function should return.
+  int32_t pc = 0;
+  auto branch = [&](uint32_t depth) -> bool {
+    Label l = labels[labels.size() - 1 - depth];
+    if (l.arity > 0) {
+      uint64_t v = stack.back();
+      stack.resize(l.height);
+      stack.push_back(v);
+    } else {
+      stack.resize(l.height);
+    }
+    labels.resize(labels.size() - 1 - depth);
+    pc = l.cont;
+    return !labels.empty();
+  };
+
+  auto ret = [&]() -> uint64_t {
+    if (sig.num_results > 0) {
+      return stack.back();
+    }
+    return 0;
+  };
+
+  for (;;) {
+    // The last end instruction of the function body might be omitted.
+    if (pc >= func.code_size) {
+      return ret();
+    }
+    int32_t start = pc;
+    uint8_t op = code[pc++];
+    switch (op) {
+    case 0x00: // unreachable
+      error("unreachable");
+      break;
+    case 0x01: // nop
+      break;
+    case 0x02: { // block
+      uint8_t bt = code[pc++];
+      labels.push_back(Label{blocks.ends.at(start) + 1, stack.size(), bt == 0x40 ? 0 : 1});
+      break;
+    }
+    case 0x03: // loop
+      pc++;
+      // Branching to a loop restarts the loop.
+      labels.push_back(Label{start, stack.size(), 0});
+      break;
+    case 0x04: { // if
+      uint8_t bt = code[pc++];
+      int32_t end = blocks.ends.at(start);
+      if (ToI32(pop())) {
+        labels.push_back(Label{end + 1, stack.size(), bt == 0x40 ? 0 : 1});
+        break;
+      }
+      auto it = blocks.elses.find(start);
+      if (it != blocks.elses.end()) {
+        labels.push_back(Label{end + 1, stack.size(), bt == 0x40 ? 0 : 1});
+        pc = it->second + 1;
+        break;
+      }
+      pc = end + 1;
+      break;
+    }
+    case 0x05: // else
+      // The end of the then clause.
+      branch(0);
+      break;
+    case 0x0b: // end
+      labels.pop_back();
+      if (labels.empty()) {
+        return ret();
+      }
+      break;
+    case 0x0c: // br
+      if (!branch(ReadU32(code, &pc))) {
+        return ret();
+      }
+      break;
+    case 0x0d: { // br_if
+      uint32_t depth = ReadU32(code, &pc);
+      if (ToI32(pop())) {
+        if (!branch(depth)) {
+          return ret();
+        }
+      }
+      break;
+    }
+    case 0x0e: { // br_table
+      uint32_t n = ReadU32(code, &pc);
+      uint32_t idx = static_cast<uint32_t>(ToI32(pop()));
+      uint32_t depth = 0;
+      for (uint32_t i = 0; i < n + 1; i++) {
+        uint32_t d = ReadU32(code, &pc);
+        if (i == idx || i == n) {
+          depth = d;
+          if (i == idx) {
+            break;
+          }
+        }
+      }
+      if (!branch(depth)) {
+        return ret();
+      }
+      break;
+    }
+    case 0x0f: // return
+      return ret();
+
+    case 0x10: // call
+    case 0x11: { // call_indirect
+      uint32_t idx;
+      Signature callee;
+      if (op == 0x10) {
+        idx = ReadU32(code, &pc);
+        callee = env_->GetSignature(env_->GetFuncType(idx));
+      } else {
+        uint32_t type = ReadU32(code, &pc);
+        pc++;
+        int32_t elem = env_->GetTableElement(static_cast<uint32_t>(ToI32(pop())));
+        if (elem < 0) {
+          error("call_indirect: undefined element");
+        }
+        idx = static_cast<uint32_t>(elem);
+        if (env_->GetFuncType(idx) != type) {
+          error("call_indirect: signature mismatch");
+        }
+        callee = env_->GetSignature(type);
+      }
+      std::vector<uint64_t> callee_args(stack.end() - callee.num_params, stack.end());
+      stack.resize(stack.size() - callee.num_params);
+      uint64_t result = env_->CallFunc(idx, callee_args.data());
+      if (callee.num_results > 0) {
+        push(result);
+      }
+      break;
+    }
+
+    case 0x1a: // drop
+      pop();
+      break;
+    case 0x1b: { // select
+      int32_t cond = ToI32(pop());
+      uint64_t arg1 = pop();
+      uint64_t arg0 = pop();
+      push(cond ? arg0 : arg1);
+      break;
+    }
+
+    case 0x20: // local.get
+      push(locals[ReadU32(code, &pc)]);
+      break;
+    case 0x21: // local.set
+      locals[ReadU32(code, &pc)] = pop();
+      break;
+    case 0x22: // local.tee
+      locals[ReadU32(code, &pc)] = stack.back();
+      break;
+    case 0x23: // global.get
+      push(env_->GetGlobal(ReadU32(code, &pc)));
+      break;
+    case 0x24: // global.set
+      env_->SetGlobal(ReadU32(code, &pc), pop());
+      break;
+
+    case 0x28: case 0x29: case 0x2a: case 0x2b: case 0x2c: case 0x2d: case 0x2e: case 0x2f:
+    case 0x30: case 0x31: case 0x32: case 0x33: case 0x34: case 0x35: {
+      ReadU32(code, &pc);
+      uint32_t offset = ReadU32(code, &pc);
+      int32_t addr = static_cast<int32_t>(static_cast<uint32_t>(ToI32(pop())) + offset);
+      switch (op) {
+      case 0x28: push(FromI32(mem->LoadInt32(addr))); break;
+      case 0x29: push(FromI64(mem->LoadInt64(addr))); break;
+      case 0x2a: push(FromF32(mem->LoadFloat32(addr))); break;
+      case 0x2b: push(FromF64(mem->LoadFloat64(addr))); break;
+      case 0x2c: push(FromI32(mem->LoadInt8(addr))); break;
+      case 0x2d: push(FromI32(mem->LoadUint8(addr))); break;
+      case 0x2e: push(FromI32(mem->LoadInt16(addr))); break;
+      case 0x2f: push(FromI32(mem->LoadUint16(addr))); break;
+      case 0x30: push(FromI64(mem->LoadInt8(addr))); break;
+      case 0x31: push(FromI64(mem->LoadUint8(addr))); break;
+      case 0x32: push(FromI64(mem->LoadInt16(addr))); break;
+      case 0x33: push(FromI64(mem->LoadUint16(addr))); break;
+      case 0x34: push(FromI64(mem->LoadInt32(addr))); break;
+      case 0x35: push(FromI64(mem->LoadUint32(addr))); break;
+      }
+      break;
+    }
+    case 0x36: case 0x37: case 0x38: case 0x39: case 0x3a: case 0x3b: case 0x3c: case 0x3d: case 0x3e: {
+      ReadU32(code, &pc);
+      uint32_t offset = ReadU32(code, &pc);
+      uint64_t v = pop();
+      int32_t addr = static_cast<int32_t>(static_cast<uint32_t>(ToI32(pop())) + offset);
+      switch (op) {
+      case 0x36: mem->StoreInt32(addr, ToI32(v)); break;
+      case 0x37: mem->StoreInt64(addr, ToI64(v)); break;
+      case 0x38: mem->StoreFloat32(addr, ToF32(v)); break;
+      case 0x39: mem->StoreFloat64(addr, ToF64(v)); break;
+      case 0x3a: mem->StoreInt8(addr, static_cast<int8_t>(v)); break;
+      case 0x3b: mem->StoreInt16(addr, static_cast<int16_t>(v)); break;
+      case 0x3c: mem->StoreInt8(addr, static_cast<int8_t>(v)); break;
+      case 0x3d: mem->StoreInt16(addr, static_cast<int16_t>(v)); break;
+      case 0x3e: mem->StoreInt32(addr, static_cast<int32_t>(v)); break;
+      }
+      break;
+    }
+    case 0x3f: // memory.size
+      pc++;
+      push(FromI32(mem->GetSize()));
+      break;
+    case 0x40: // memory.grow
+      pc++;
+      push(FromI32(mem->Grow(ToI32(pop()))));
+      break;
+
+    case 0x41: // i32.const
+      push(FromI32(ReadS32(code, &pc)));
+      break;
+    case 0x42: // i64.const
+      push(FromI64(ReadS64(code, &pc)));
+      break;
+    case 0x43: { // f32.const
+      uint32_t bits;
+      std::memcpy(&bits, code + pc, sizeof(bits));
+      pc += 4;
+      push(bits);
+      break;
+    }
+    case 0x44: { // f64.const
+      uint64_t bits;
+      std::memcpy(&bits, code + pc, sizeof(bits));
+      pc += 8;
+      push(bits);
+      break;
+    }
+
+    case 0x45: // i32.eqz
+      push(FromI32(ToI32(pop()) == 0));
+      break;
+    case 0x46: case 0x47: case 0x48: case 0x49: case 0x4a: case 0x4b: case 0x4c: case 0x4d: case 0x4e: case 0x4f: {
+      int32_t arg1 = ToI32(pop());
+      int32_t arg0 = ToI32(pop());
+      uint32_t uarg1 = static_cast<uint32_t>(arg1);
+      uint32_t uarg0 = static_cast<uint32_t>(arg0);
+      bool r = false;
+      switch (op) {
+      case 0x46: r = arg0 == arg1; break;
+      case 0x47: r = arg0 != arg1; break;
+      case 0x48: r = arg0 < arg1; break;
+      case 0x49: r = uarg0 < uarg1; break;
+      case 0x4a: r = arg0 > arg1; break;
+      case 0x4b: r = uarg0 > uarg1; break;
+      case 0x4c: r = arg0 <= arg1; break;
+      case 0x4d: r = uarg0 <= uarg1; break;
+      case 0x4e: r = arg0 >= arg1; break;
+      case 0x4f: r = uarg0 >= uarg1; break;
+      }
+      push(FromI32(r));
+      break;
+    }
+    case 0x50: // i64.eqz
+      push(FromI32(ToI64(pop()) == 0));
+      break;
+    case 0x51: case 0x52: case 0x53: case 0x54: case 0x55: case 0x56: case 0x57: case 0x58: case 0x59: case 0x5a: {
+      int64_t arg1 = ToI64(pop());
+      int64_t arg0 = ToI64(pop());
+      uint64_t uarg1 = static_cast<uint64_t>(arg1);
+      uint64_t uarg0 = static_cast<uint64_t>(arg0);
+      bool r = false;
+      switch (op) {
+      case 0x51: r = arg0 == arg1; break;
+      case 0x52: r = arg0 != arg1; break;
+      case 0x53: r = arg0 < arg1; break;
+      case 0x54: r = uarg0 < uarg1; break;
+      case 0x55: r = arg0 > arg1; break;
+      case 0x56: r = uarg0 > uarg1; break;
+      case 0x57: r = arg0 <= arg1; break;
+      case 0x58: r = uarg0 <= uarg1; break;
+      case 0x59: r = arg0 >= arg1; break;
+      case 0x5a: r = uarg0 >= uarg1; break;
+      }
+      push(FromI32(r));
+      break;
+    }
+    case 0x5b: case 0x5c: case 0x5d: case 0x5e: case 0x5f: case 0x60: {
+      float arg1 = ToF32(pop());
+      float arg0 = ToF32(pop());
+      bool r = false;
+      switch (op) {
+      case 0x5b: r = arg0 == arg1; break;
+      case 0x5c: r = arg0 != arg1; break;
+      case 0x5d: r = arg0 < arg1; break;
+      case 0x5e: r = arg0 > arg1; break;
+      case 0x5f: r = arg0 <= arg1; break;
+      case 0x60: r = arg0 >= arg1; break;
+      }
+      push(FromI32(r));
+      break;
+    }
+    case 0x61: case 0x62: case 0x63: case 0x64: case 0x65: case 0x66: {
+      double arg1 = ToF64(pop());
+      double arg0 = ToF64(pop());
+      bool r = false;
+      switch (op) {
+      case 0x61: r = arg0 == arg1; break;
+      case 0x62: r = arg0 != arg1; break;
+      case 0x63: r = arg0 < arg1; break;
+      case 0x64: r = arg0 > arg1; break;
+      case 0x65: r = arg0 <= arg1; break;
+      case 0x66: r = arg0 >= arg1; break;
+      }
+      push(FromI32(r));
+      break;
+    }
+
+    case 0x67: { // i32.clz
+      uint32_t v = static_cast<uint32_t>(pop());
+      push(FromI32(v ? __builtin_clz(v) : 32));
+      break;
+    }
+    case 0x68: { // i32.ctz
+      uint32_t v = static_cast<uint32_t>(pop());
+      push(FromI32(v ? __builtin_ctz(v) : 32));
+      break;
+    }
+    case 0x69: // i32.popcnt
+      push(FromI32(__builtin_popcount(static_cast<uint32_t>(pop()))));
+      break;
+    case 0x6a: case 0x6b: case 0x6c: case 0x6d: case 0x6e: case 0x6f: case 0x70:
+    case 0x71: case 0x72: case 0x73: case 0x74: case 0x75: case 0x76: case 0x77: case 0x78: {
+      int32_t arg1 = ToI32(pop());
+      int32_t arg0 = ToI32(pop());
+      uint32_t uarg1 = static_cast<uint32_t>(arg1);
+      uint32_t uarg0 = static_cast<uint32_t>(arg0);
+      uint32_t r = 0;
+      switch (op) {
+      case 0x6a: r = uarg0 + uarg1; break;
+      case 0x6b: r = uarg0 - uarg1; break;
+      case 0x6c: r = uarg0 * uarg1; break;
+      case 0x6d: r = static_cast<uint32_t>(arg0 / arg1); break;
+      case 0x6e: r = uarg0 / uarg1; break;
+      case 0x6f: r = static_cast<uint32_t>(arg0 % arg1); break;
+      case 0x70: r = uarg0 % uarg1; break;
+      case 0x71: r = uarg0 & uarg1; break;
+      case 0x72: r = uarg0 | uarg1; break;
+      case 0x73: r = uarg0 ^ uarg1; break;
+      case 0x74: r = uarg0 << (uarg1 & 31); break;
+      case 0x75: r = static_cast<uint32_t>(arg0 >> (uarg1 & 31)); break;
+      case 0x76: r = uarg0 >> (uarg1 & 31); break;
+      case 0x77: r = Bits::RotateLeft(uarg0, arg1); break;
+      case 0x78: r = Bits::RotateLeft(uarg0, -arg1); break;
+      }
+      push(r);
+      break;
+    }
+    case 0x79: { // i64.clz
+      uint64_t v = pop();
+      push(FromI64(v ? __builtin_clzll(v) : 64));
+      break;
+    }
+    case 0x7a: { // i64.ctz
+      uint64_t v = pop();
+      push(FromI64(v ? __builtin_ctzll(v) : 64));
+      break;
+    }
+    case 0x7b: // i64.popcnt
+      push(FromI64(__builtin_popcountll(pop())));
+      break;
+    case 0x7c: case 0x7d: case 0x7e: case 0x7f: case 0x80: case 0x81: case 0x82:
+    case 0x83: case 0x84: case 0x85: case 0x86: case 0x87: case 0x88: case 0x89: case 0x8a: {
+      int64_t arg1 = ToI64(pop());
+      int64_t arg0 = ToI64(pop());
+      uint64_t uarg1 = static_cast<uint64_t>(arg1);
+      uint64_t uarg0 = static_cast<uint64_t>(arg0);
+      uint64_t r = 0;
+      switch (op) {
+      case 0x7c: r = uarg0 + uarg1; break;
+      case 0x7d: r = uarg0 - uarg1; break;
+      case 0x7e: r = uarg0 * uarg1; break;
+      case 0x7f: r = static_cast<uint64_t>(arg0 / arg1); break;
+      case 0x80: r = uarg0 / uarg1; break;
+      case 0x81: r = static_cast<uint64_t>(arg0 % arg1); break;
+      case 0x82: r = uarg0 % uarg1; break;
+      case 0x83: r = uarg0 & uarg1; break;
+      case 0x84: r = uarg0 | uarg1; break;
+      case 0x85: r = uarg0 ^ uarg1; break;
+      case 0x86: r = uarg0 << (uarg1 & 63); break;
+      case 0x87: r = static_cast<uint64_t>(arg0 >> (uarg1 & 63)); break;
+      case 0x88: r = uarg0 >> (uarg1 & 63); break;
+      case 0x89: r = Bits::RotateLeft(uarg0, static_cast<int32_t>(arg1)); break;
+      case 0x8a: r = Bits::RotateLeft(uarg0, -static_cast<int32_t>(arg1)); break;
+      }
+      push(r);
+      break;
+    }
+
+    case 0x8b: case 0x8c: case 0x8d: case 0x8e: case 0x8f: case 0x90: case 0x91: {
+      float arg = ToF32(pop());
+      float r = 0;
+      switch (op) {
+      case 0x8b: r = std::abs(arg); break;
+      case 0x8c: r = -arg; break;
+      case 0x8d: r = std::ceil(arg); break;
+      case 0x8e: r = std::floor(arg); break;
+      case 0x8f: r = std::trunc(arg); break;
+      case 0x90: r = Math::Round(arg); break;
+      case 0x91: r = std::sqrt(arg); break;
+      }
+      push(FromF32(r));
+      break;
+    }
+    case 0x92: case 0x93: case 0x94: case 0x95: case 0x96: case 0x97: case 0x98: {
+      float arg1 = ToF32(pop());
+      float arg0 = ToF32(pop());
+      float r = 0;
+      switch (op) {
+      case 0x92: r = arg0 + arg1; break;
+      case 0x93: r = arg0 - arg1; break;
+      case 0x94: r = arg0 * arg1; break;
+      case 0x95: r = arg0 / arg1; break;
+      case 0x96: r = std::min(arg0, arg1); break;
+      case 0x97: r = std::max(arg0, arg1); break;
+      case 0x98: r = std::copysign(arg0, arg1); break;
+      }
+      push(FromF32(r));
+      break;
+    }
+    case 0x99: case 0x9a: case 0x9b: case 0x9c: case 0x9d: case 0x9e: case 0x9f: {
+      double arg = ToF64(pop());
+      double r = 0;
+      switch (op) {
+      case 0x99: r = std::abs(arg); break;
+      case 0x9a: r = -arg; break;
+      case 0x9b: r = std::ceil(arg); break;
+      case 0x9c: r = std::floor(arg); break;
+      case 0x9d: r = std::trunc(arg); break;
+      case 0x9e: r = Math::Round(arg); break;
+      case 0x9f: r = std::sqrt(arg); break;
+      }
+      push(FromF64(r));
+      break;
+    }
+    case 0xa0: case 0xa1: case 0xa2: case 0xa3: case 0xa4: case 0xa5: case 0xa6: {
+      double arg1 = ToF64(pop());
+      double arg0 = ToF64(pop());
+      double r = 0;
+      switch (op) {
+      case 0xa0: r = arg0 + arg1; break;
+      case 0xa1: r = arg0 - arg1; break;
+      case 0xa2: r = arg0 * arg1; break;
+      case 0xa3: r = arg0 / arg1; break;
+      case 0xa4: r = std::min(arg0, arg1); break;
+      case 0xa5: r = std::max(arg0, arg1); break;
+      case 0xa6: r = std::copysign(arg0, arg1); break;
+      }
+      push(FromF64(r));
+      break;
+    }
+
+    case 0xa7: // i32.wrap_i64
+      push(FromI32(static_cast<int32_t>(ToI64(pop()))));
+      break;
+    case 0xa8: // i32.trunc_f32_s
+      push(FromI32(static_cast<int32_t>(std::trunc(ToF32(pop())))));
+      break;
+    case 0xa9: // i32.trunc_f32_u
+      push(FromI32(static_cast<int32_t>(static_cast<uint32_t>(std::trunc(ToF32(pop()))))));
+      break;
+    case 0xaa: // i32.trunc_f64_s
+      push(FromI32(static_cast<int32_t>(std::trunc(ToF64(pop())))));
+      break;
+    case 0xab: // i32.trunc_f64_u
+      push(FromI32(static_cast<int32_t>(static_cast<uint32_t>(std::trunc(ToF64(pop()))))));
+      break;
+    case 0xac: // i64.extend_i32_s
+      push(FromI64(static_cast<int64_t>(ToI32(pop()))));
+      break;
+    case 0xad: // i64.extend_i32_u
+      push(FromI64(static_cast<int64_t>(static_cast<uint32_t>(pop()))));
+      break;
+    case 0xae: // i64.trunc_f32_s
+      push(FromI64(static_cast<int64_t>(std::trunc(ToF32(pop())))));
+      break;
+    case 0xaf: // i64.trunc_f32_u
+      push(static_cast<uint64_t>(std::trunc(ToF32(pop()))));
+      break;
+    case 0xb0: // i64.trunc_f64_s
+      push(FromI64(static_cast<int64_t>(std::trunc(ToF64(pop())))));
+      break;
+    case 0xb1: // i64.trunc_f64_u
+      push(static_cast<uint64_t>(std::trunc(ToF64(pop()))));
+      break;
+    case 0xb2: // f32.convert_i32_s
+      push(FromF32(static_cast<float>(ToI32(pop()))));
+      break;
+    case 0xb3: // f32.convert_i32_u
+      push(FromF32(static_cast<float>(static_cast<uint32_t>(pop()))));
+      break;
+    case 0xb4: // f32.convert_i64_s
+      push(FromF32(static_cast<float>(ToI64(pop()))));
+      break;
+    case 0xb5: // f32.convert_i64_u
+      push(FromF32(static_cast<float>(pop())));
+      break;
+    case 0xb6: // f32.demote_f64
+      push(FromF32(static_cast<float>(ToF64(pop()))));
+      break;
+    case 0xb7: // f64.convert_i32_s
+      push(FromF64(static_cast<double>(ToI32(pop()))));
+      break;
+    case 0xb8: // f64.convert_i32_u
+      push(FromF64(static_cast<double>(static_cast<uint32_t>(pop()))));
+      break;
+    case 0xb9: // f64.convert_i64_s
+      push(FromF64(static_cast<double>(ToI64(pop()))));
+      break;
+    case 0xba: // f64.convert_i64_u
+      push(FromF64(static_cast<double>(pop())));
+      break;
+    case 0xbb: // f64.promote_f32
+      push(FromF64(static_cast<double>(ToF32(pop()))));
+      break;
+    case 0xbc: // i32.reinterpret_f32
+    case 0xbd: // i64.reinterpret_f64
+    case 0xbe: // f32.reinterpret_i32
+    case 0xbf: // f64.reinterpret_i64
+      // The values are already represented as bits.
+      break;
+
+    case 0xc0: // i32.extend8_s
+      push(FromI32(static_cast<int8_t>(pop())));
+      break;
+    case 0xc1: // i32.extend16_s
+      push(FromI32(static_cast<int16_t>(pop())));
+      break;
+    case 0xc2: // i64.extend8_s
+      push(FromI64(static_cast<int8_t>(pop())));
+      break;
+    case 0xc3: // i64.extend16_s
+      push(FromI64(static_cast<int16_t>(pop())));
+      break;
+    case 0xc4: // i64.extend32_s
+      push(FromI64(static_cast<int32_t>(pop())));
+      break;
+
+    case 0xfc: {
+      uint32_t sub = ReadU32(code, &pc);
+      switch (sub) {
+      case 0: // i32.trunc_sat_f32_s
+        push(FromI32(TruncSat<int32_t>(ToF32(pop()))));
+        break;
+      case 1: // i32.trunc_sat_f32_u
+        push(TruncSat<uint32_t>(ToF32(pop())));
+        break;
+      case 2: // i32.trunc_sat_f64_s
+        push(FromI32(TruncSat<int32_t>(ToF64(pop()))));
+        break;
+      case 3: // i32.trunc_sat_f64_u
+        push(TruncSat<uint32_t>(ToF64(pop())));
+        break;
+      case 4: // i64.trunc_sat_f32_s
+        push(FromI64(TruncSat<int64_t>(ToF32(pop()))));
+        break;
+      case 5: // i64.trunc_sat_f32_u
+        push(TruncSat<uint64_t>(ToF32(pop())));
+        break;
+      case 6: // i64.trunc_sat_f64_s
+        push(FromI64(TruncSat<int64_t>(ToF64(pop()))));
+        break;
+      case 7: // i64.trunc_sat_f64_u
+        push(TruncSat<uint64_t>(ToF64(pop())));
+        break;
+      case 10: { // memory.copy
+        ReadU32(code, &pc);
+        ReadU32(code, &pc);
+        int32_t n = ToI32(pop());
+        int32_t src = ToI32(pop());
+        int32_t dst = ToI32(pop());
+        mem->Memmove(dst, src, n);
+        break;
+      }
+      case 11: { // memory.fill
+        ReadU32(code, &pc);
+        int32_t n = ToI32(pop());
+        uint8_t v = static_cast<uint8_t>(pop());
+        int32_t dst = ToI32(pop());
+        mem->Memset(dst, v, n);
+        break;
+      }
+      default:
+        error("unexpected operator: 0xfc " + std::to_string(sub));
+        break;
+      }
+      break;
+    }
+
+    default:
+      error("unexpected operator: " + std::to_string(op));
+      break;
+    }
+  }
+}
+
+}
+`))
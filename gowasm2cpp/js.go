@@ -57,6 +57,7 @@ var jsHTmpl = template.Must(template.New("js.h").Parse(`// Code generated by go2
 
 #include <deque>
 #include <dirent.h>
+#include <exception>
 #include <functional>
 #include <iostream>
 #include <map>
@@ -98,7 +99,11 @@ public:
   };
 
   static Value Null();
-  static Value Global();
+
+  // MakeGlobal creates a new global object with its own host objects like fs and process. Each Go has its own
+  // global object.
+  static Value MakeGlobal();
+
   static Value ReflectGet(Value target, const std::string& key);
   static void ReflectSet(Value target, const std::string& key, Value value);
   static void ReflectDelete(Value target, const std::string& key);
@@ -138,8 +143,6 @@ public:
   std::string Inspect() const;
 
 private:
-  static Value MakeGlobal();
-
   explicit Value(Type type);
   Value(Type type, double num);
 
@@ -159,6 +162,10 @@ public:
   virtual void Set(const std::string& key, Value value);
   virtual void Delete(const std::string& key);
 
+  // Keys returns the keys of the properties whose values are always the same objects. Keys is used to find objects
+  // by their paths from the global object.
+  virtual std::vector<std::string> Keys() const;
+
   virtual bool IsFunction() const { return false; }
   virtual bool IsConstructor() const { return false; }
   virtual bool IsBytes() const { return false; }
@@ -225,6 +232,7 @@ public:
   Value Get(const std::string& key) override;
   void Set(const std::string& key, Value value) override;
   void Delete(const std::string& key) override;
+  std::vector<std::string> Keys() const override;
   std::string ToString() const override;
   std::string Inspect() const override;
 
@@ -259,6 +267,20 @@ private:
   Object::Func fn_;
 };
 
+// Exception is thrown from a function to throw a JavaScript exception. Go receives the value as a js.Error, like a
+// Node.js function that throws an error with an error code.
+class Exception : public std::exception {
+public:
+  explicit Exception(Value value);
+
+  Value GetValue() const;
+  const char* what() const noexcept override;
+
+private:
+  Value value_;
+  std::string message_;
+};
+
 }
 
 #endif  // {{.IncludeGuard}}
@@ -270,6 +292,7 @@ var jsCppTmpl = template.Must(template.New("js.cpp").Parse(`// Code generated by
 
 #include <algorithm>
 #include <cassert>
+#include <cmath>
 #include <cstring>
 #include <cstdlib>
 #include <ctime>
@@ -280,7 +303,6 @@ var jsCppTmpl = template.Must(template.New("js.cpp").Parse(`// Code generated by
 #include <sys/stat.h>
 #include <tuple>
 #include <unistd.h>
-#include <utime.h>
 
 namespace {{.Namespace}} {
 
@@ -1065,6 +1087,39 @@ public:
           return Value{};
         })};
     }
+    if (key == "chmod") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          std::string path = args[0].ToString();
+          mode_t mode = static_cast<mode_t>(args[1].ToNumber());
+          Value callback = args[2];
+          Value errval = Value::Null();
+          if (chmod(path.c_str(), mode)) {
+            errval = Value{std::make_shared<Errno>(errno)};
+          }
+          Value::ReflectApply(callback, Value{}, {errval});
+          return Value{};
+        })};
+    }
+    if (key == "chown") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          std::string path = args[0].ToString();
+          Value callback = args[3];
+          Value errval = Value::Null();
+#ifndef _WIN32
+          uid_t uid = static_cast<uid_t>(args[1].ToNumber());
+          gid_t gid = static_cast<gid_t>(args[2].ToNumber());
+          if (chown(path.c_str(), uid, gid)) {
+            errval = Value{std::make_shared<Errno>(errno)};
+          }
+#else
+          errval = Value{std::make_shared<Enosys>("chown")};
+#endif
+          Value::ReflectApply(callback, Value{}, {errval});
+          return Value{};
+        })};
+    }
     if (key == "close") {
       return Value{std::make_shared<Function>(
         [](Value self, std::vector<Value> args) -> Value {
@@ -1078,6 +1133,43 @@ public:
           return Value{};
         })};
     }
+    if (key == "fchmod") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          int fd = static_cast<int>(args[0].ToNumber());
+          mode_t mode = static_cast<mode_t>(args[1].ToNumber());
+          Value callback = args[2];
+          Value errval = Value::Null();
+#ifndef _WIN32
+          if (fchmod(fd, mode)) {
+            errval = Value{std::make_shared<Errno>(errno)};
+          }
+#else
+          errval = Value{std::make_shared<Enosys>("fchmod")};
+#endif
+          Value::ReflectApply(callback, Value{}, {errval});
+          return Value{};
+        })};
+    }
+    if (key == "fchown") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          int fd = static_cast<int>(args[0].ToNumber());
+          Value callback = args[3];
+          Value errval = Value::Null();
+#ifndef _WIN32
+          uid_t uid = static_cast<uid_t>(args[1].ToNumber());
+          gid_t gid = static_cast<gid_t>(args[2].ToNumber());
+          if (fchown(fd, uid, gid)) {
+            errval = Value{std::make_shared<Errno>(errno)};
+          }
+#else
+          errval = Value{std::make_shared<Enosys>("fchown")};
+#endif
+          Value::ReflectApply(callback, Value{}, {errval});
+          return Value{};
+        })};
+    }
     if (key == "fstat") {
       return Value{std::make_shared<Function>(
         [this](Value self, std::vector<Value> args) -> Value {
@@ -1092,6 +1184,23 @@ public:
           return Value{};
         })};
     }
+    if (key == "fsync") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          int fd = static_cast<int>(args[0].ToNumber());
+          Value callback = args[1];
+          Value errval = Value::Null();
+#ifndef _WIN32
+          if (fsync(fd)) {
+            errval = Value{std::make_shared<Errno>(errno)};
+          }
+#else
+          errval = Value{std::make_shared<Enosys>("fsync")};
+#endif
+          Value::ReflectApply(callback, Value{}, {errval});
+          return Value{};
+        })};
+    }
     if (key == "ftruncate") {
       return Value{std::make_shared<Function>(
         [](Value self, std::vector<Value> args) -> Value {
@@ -1106,6 +1215,43 @@ public:
           return Value{};
         })};
     }
+    if (key == "lchown") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          std::string path = args[0].ToString();
+          Value callback = args[3];
+          Value errval = Value::Null();
+#ifndef _WIN32
+          uid_t uid = static_cast<uid_t>(args[1].ToNumber());
+          gid_t gid = static_cast<gid_t>(args[2].ToNumber());
+          if (lchown(path.c_str(), uid, gid)) {
+            errval = Value{std::make_shared<Errno>(errno)};
+          }
+#else
+          errval = Value{std::make_shared<Enosys>("lchown")};
+#endif
+          Value::ReflectApply(callback, Value{}, {errval});
+          return Value{};
+        })};
+    }
+    if (key == "link") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          std::string path = args[0].ToString();
+          std::string link = args[1].ToString();
+          Value callback = args[2];
+          Value errval = Value::Null();
+#ifndef _WIN32
+          if (::link(path.c_str(), link.c_str())) {
+            errval = Value{std::make_shared<Errno>(errno)};
+          }
+#else
+          errval = Value{std::make_shared<Enosys>("link")};
+#endif
+          Value::ReflectApply(callback, Value{}, {errval});
+          return Value{};
+        })};
+    }
     if (key == "lstat") {
       // Unfortunately, lstat might not be defined in some platforms.
 #if 0
@@ -1215,6 +1361,29 @@ public:
           return Value{};
         })};
     }
+    if (key == "readlink") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          std::string path = args[0].ToString();
+          Value callback = args[1];
+#ifndef _WIN32
+          std::vector<char> buf(PATH_MAX);
+          ssize_t n;
+          // readlink truncates the result silently. Retry with a larger buffer in this case.
+          while ((n = readlink(path.c_str(), buf.data(), buf.size())) == static_cast<ssize_t>(buf.size())) {
+            buf.resize(buf.size() * 2);
+          }
+          if (n == -1) {
+            Value::ReflectApply(callback, Value{}, {Value{std::make_shared<Errno>(errno)}});
+            return Value{};
+          }
+          Value::ReflectApply(callback, Value{}, {Value::Null(), Value{std::string{buf.data(), static_cast<size_t>(n)}}});
+#else
+          Value::ReflectApply(callback, Value{}, {Value{std::make_shared<Enosys>("readlink")}});
+#endif
+          return Value{};
+        })};
+    }
     if (key == "rename") {
       return Value{std::make_shared<Function>(
         [](Value self, std::vector<Value> args) -> Value {
@@ -1256,6 +1425,24 @@ public:
           return Value{};
         })};
     }
+    if (key == "symlink") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          std::string path = args[0].ToString();
+          std::string link = args[1].ToString();
+          Value callback = args[2];
+          Value errval = Value::Null();
+#ifndef _WIN32
+          if (::symlink(path.c_str(), link.c_str())) {
+            errval = Value{std::make_shared<Errno>(errno)};
+          }
+#else
+          errval = Value{std::make_shared<Enosys>("symlink")};
+#endif
+          Value::ReflectApply(callback, Value{}, {errval});
+          return Value{};
+        })};
+    }
     if (key == "unlink") {
       return Value{std::make_shared<Function>(
         [](Value self, std::vector<Value> args) -> Value {
@@ -1270,19 +1457,20 @@ public:
         })};
     }
     if (key == "utimes") {
-      // Unfortunately, utime(s) might not be defined in some platforms.
-#if 0
+      // Unfortunately, utimensat might not be defined in some platforms.
+#if defined(__linux__)
       return Value{std::make_shared<Function>(
         [](Value self, std::vector<Value> args) -> Value {
           std::string path = args[0].ToString();
-          time_t atime = static_cast<time_t>(args[1].ToNumber());
-          time_t mtime = static_cast<time_t>(args[2].ToNumber());
+          // The times are in seconds, as in Node.js.
+          double atime = args[1].ToNumber();
+          double mtime = args[2].ToNumber();
           Value callback = args[3];
           Value errval = Value::Null();
-          struct utimbuf times;
-          times.actime = atime;
-          times.modtime = mtime;
-          if (utime(path.c_str(), &times)) {
+          struct timespec times[2];
+          times[0] = SecondsToTimespec(atime);
+          times[1] = SecondsToTimespec(mtime);
+          if (utimensat(AT_FDCWD, path.c_str(), times, 0)) {
             errval = Value{std::make_shared<Errno>(errno)};
           }
           Value::ReflectApply(callback, Value{}, {errval});
@@ -1295,6 +1483,10 @@ public:
     return Value{};
   }
 
+  std::vector<std::string> Keys() const override {
+    return {"constants"};
+  }
+
   std::string ToString() const override {
     return "fs";
   }
@@ -1314,13 +1506,13 @@ private:
     dict->Set("blocks", Value{static_cast<double>(statbuf->st_blocks)});
 
 #if defined(__APPLE__)
-    dict->Set("atimMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_atimespec))});
-    dict->Set("mtimMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_mtimespec))});
-    dict->Set("ctimMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_ctimespec))});
+    dict->Set("atimeMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_atimespec))});
+    dict->Set("mtimeMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_mtimespec))});
+    dict->Set("ctimeMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_ctimespec))});
 #else
-    dict->Set("atimMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_atim))});
-    dict->Set("mtimMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_mtim))});
-    dict->Set("ctimMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_ctim))});
+    dict->Set("atimeMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_atim))});
+    dict->Set("mtimeMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_mtim))});
+    dict->Set("ctimeMs", Value{static_cast<double>(TimespecToMillisecond(&statbuf->st_ctim))});
 #endif
 
     bool dir = statbuf->st_mode & S_IFDIR;
@@ -1336,6 +1528,14 @@ private:
         static_cast<int64_t>(t->tv_nsec) / 1000000ll;
   }
 
+  static struct timespec SecondsToTimespec(double seconds) {
+    double sec = std::floor(seconds);
+    struct timespec t;
+    t.tv_sec = static_cast<time_t>(sec);
+    t.tv_nsec = static_cast<long>((seconds - sec) * 1e9);
+    return t;
+  }
+
   Value constants_;
 };
 
@@ -1343,22 +1543,87 @@ class Process : public Object {
 public:
   Value Get(const std::string& key) override {
     if (key == "pid") {
-      return Value{-1.0};
+      return Value{static_cast<double>(getpid())};
     }
     if (key == "ppid") {
+#ifndef _WIN32
+      return Value{static_cast<double>(getppid())};
+#else
       return Value{-1.0};
+#endif
     }
     if (key == "cwd") {
       return Value{std::make_shared<Function>(
         [](Value self, std::vector<Value> args) -> Value {
           char path[PATH_MAX];
           if (!getcwd(path, PATH_MAX)) {
-            Panic(std::string("getcwd failed: ") + std::strerror(errno));
-            return Value{};
+            throw Exception{Value{std::make_shared<Errno>(errno)}};
           }
           return Value{path};
         })};
     }
+    if (key == "chdir") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          std::string path = args[0].ToString();
+          if (chdir(path.c_str())) {
+            throw Exception{Value{std::make_shared<Errno>(errno)}};
+          }
+          return Value{};
+        })};
+    }
+    if (key == "umask") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          mode_t mask = static_cast<mode_t>(args[0].ToNumber());
+          return Value{static_cast<double>(umask(mask))};
+        })};
+    }
+#ifndef _WIN32
+    if (key == "getuid") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          return Value{static_cast<double>(getuid())};
+        })};
+    }
+    if (key == "getgid") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          return Value{static_cast<double>(getgid())};
+        })};
+    }
+    if (key == "geteuid") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          return Value{static_cast<double>(geteuid())};
+        })};
+    }
+    if (key == "getegid") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          return Value{static_cast<double>(getegid())};
+        })};
+    }
+    if (key == "getgroups") {
+      return Value{std::make_shared<Function>(
+        [](Value self, std::vector<Value> args) -> Value {
+          int n = getgroups(0, nullptr);
+          if (n < 0) {
+            throw Exception{Value{std::make_shared<Errno>(errno)}};
+          }
+          std::vector<gid_t> groups(n);
+          n = getgroups(n, groups.data());
+          if (n < 0) {
+            throw Exception{Value{std::make_shared<Errno>(errno)}};
+          }
+          std::vector<Value> values;
+          for (int i = 0; i < n; i++) {
+            values.push_back(Value{static_cast<double>(groups[i])});
+          }
+          return Value{values};
+        })};
+    }
+#endif
     Panic(key + " on process is not implemented");
     return Value{};
   }
@@ -1399,6 +1664,19 @@ Writer::Writer(std::ostream& out)
     : out_{out} {
 }
 
+Exception::Exception(Value value)
+    : value_{value},
+      message_{value.Inspect()} {
+}
+
+Value Exception::GetValue() const {
+  return value_;
+}
+
+const char* Exception::what() const noexcept {
+  return message_.c_str();
+}
+
 void Writer::Write(BytesSpan bytes) {
   buf_.insert(buf_.end(), bytes.begin(), bytes.end());
   for (;;) {
@@ -1650,6 +1928,10 @@ BytesSpan Object::ToBytes() {
   return BytesSpan{};
 }
 
+std::vector<std::string> Object::Keys() const {
+  return {};
+}
+
 std::string Object::Inspect() const {
   return ToString();
 }
@@ -1781,6 +2063,14 @@ void DictionaryValues::Delete(const std::string& key) {
   dict_.erase(key);
 }
 
+std::vector<std::string> DictionaryValues::Keys() const {
+  std::vector<std::string> keys;
+  for (auto& kv : dict_) {
+    keys.push_back(kv.first);
+  }
+  return keys;
+}
+
 std::string DictionaryValues::ToString() const {
   return "DictionaryValues";
 }
@@ -1805,11 +2095,6 @@ Value Function::Invoke(Value self, std::vector<Value> args) {
   return fn_(Value{}, args);
 }
 
-Value Value::Global() {
-  static Value global = MakeGlobal();
-  return global;
-}
-
 Value Value::MakeGlobal() {
   std::shared_ptr<Constructor> arr = std::make_shared<Constructor>("Array",
     [](Value self, std::vector<Value> args) -> Value {
@@ -1917,14 +2202,14 @@ Value Value::MakeGlobal() {
       return Value{std::make_shared<Date>()};
     });
 
+  // TODO: Use cryptographically strong random values instead of std::random_device.
+  std::shared_ptr<std::random_device> rd = std::make_shared<std::random_device>();
   Value getRandomValues{std::make_shared<Function>(
-    [](Value self, std::vector<Value> args) -> Value {
+    [rd](Value self, std::vector<Value> args) -> Value {
       BytesSpan bs = args[0].ToBytes();
-      // TODO: Use cryptographically strong random values instead of std::random_device.
-      static std::random_device rd;
       std::uniform_int_distribution<uint8_t> dist(0, 255);
       for (size_t i = 0; i < bs.size(); i++) {
-        bs[i] = dist(rd);
+        bs[i] = dist(*rd);
       }
       return Value{};
     })};
@@ -1932,16 +2217,16 @@ Value Value::MakeGlobal() {
     {"getRandomValues", getRandomValues},
   });
 
-  static Value& writeObjectsToStdout = *new Value(std::make_shared<Function>(
+  Value writeObjectsToStdout{std::make_shared<Function>(
     [](Value self, std::vector<Value> args) -> Value {
       WriteObjects(std::cout, args);
       return Value{};
-    }));
-  static Value& writeObjectsToStderr = *new Value(std::make_shared<Function>(
+    })};
+  Value writeObjectsToStderr{std::make_shared<Function>(
     [](Value self, std::vector<Value> args) -> Value {
       WriteObjects(std::cerr, args);
       return Value{};
-    }));
+    })};
   std::shared_ptr<DictionaryValues> console = std::make_shared<DictionaryValues>(std::map<std::string, Value>{
     {"error", writeObjectsToStderr},
     {"debug", writeObjectsToStderr},
@@ -1956,8 +2241,60 @@ Value Value::MakeGlobal() {
       return Value{};
     });
 
-  static std::shared_ptr<FS> fs = std::make_shared<FS>();
-  static std::shared_ptr<Process> process = std::make_shared<Process>();
+  std::shared_ptr<FS> fs = std::make_shared<FS>();
+  std::shared_ptr<Process> process = std::make_shared<Process>();
+
+  // resolve resolves the paths into an absolute path as Node.js's path.resolve does. syscall.Open uses this.
+  Value resolve{std::make_shared<Function>(
+    [](Value self, std::vector<Value> args) -> Value {
+      std::string path;
+      for (auto it = args.rbegin(); it != args.rend(); it++) {
+        std::string p = it->ToString();
+        if (p.empty()) {
+          continue;
+        }
+        path = path.empty() ? p : p + "/" + path;
+        if (p[0] == '/') {
+          break;
+        }
+      }
+      if (path.empty() || path[0] != '/') {
+        char cwd[PATH_MAX];
+        if (!getcwd(cwd, PATH_MAX)) {
+          throw Exception{Value{std::make_shared<Errno>(errno)}};
+        }
+        path = path.empty() ? std::string{cwd} : std::string{cwd} + "/" + path;
+      }
+
+      std::vector<std::string> elems;
+      size_t start = 0;
+      while (start <= path.size()) {
+        size_t end = path.find('/', start);
+        if (end == std::string::npos) {
+          end = path.size();
+        }
+        std::string elem = path.substr(start, end - start);
+        if (elem == "..") {
+          if (!elems.empty()) {
+            elems.pop_back();
+          }
+        } else if (!elem.empty() && elem != ".") {
+          elems.push_back(elem);
+        }
+        start = end + 1;
+      }
+      std::string result;
+      for (const std::string& elem : elems) {
+        result += "/" + elem;
+      }
+      if (result.empty()) {
+        result = "/";
+      }
+      return Value{result};
+    })};
+  std::shared_ptr<DictionaryValues> path = std::make_shared<DictionaryValues>(std::map<std::string, Value>{
+    {"resolve", resolve},
+  });
 
   std::shared_ptr<DictionaryValues> global = std::make_shared<DictionaryValues>(std::map<std::string, Value>{
     {"Array", Value{arr}},
@@ -1970,6 +2307,7 @@ Value Value::MakeGlobal() {
     {"crypto", Value{crypto}},
     {"fetch", Value{fetch}},
     {"fs", Value{fs}},
+    {"path", Value{path}},
     {"process", Value{process}},
   });
 
@@ -13,7 +13,7 @@ type wasmData struct {
 	Data   []byte
 }
 
-func writeMem(dir string, incpath string, namespace string, initPageNum int, data []wasmData) error {
+func writeMem(dir string, incpath string, namespace string, rt runtimeLib, initPageNum int, data []wasmData) error {
 	const pageSize = 64 * 1024
 
 	{
@@ -27,11 +27,13 @@ func writeMem(dir string, incpath string, namespace string, initPageNum int, dat
 			IncludeGuard string
 			IncludePath  string
 			Namespace    string
+			RuntimeLib   runtimeLib
 			PageSize     int
 		}{
 			IncludeGuard: includeGuard(namespace) + "_MEM_H",
 			IncludePath:  incpath,
 			Namespace:    namespace,
+			RuntimeLib:   rt,
 			PageSize:     pageSize,
 		}); err != nil {
 			return err
@@ -73,14 +75,17 @@ var memHTmpl = template.Must(template.New("mem.h").Parse(`// Code generated by g
 #ifndef {{.IncludeGuard}}
 #define {{.IncludeGuard}}
 
-#include "{{.IncludePath}}bytes.h"
+#include "{{.RuntimeLib.IncludePath}}bytes.h"
 
 #include <cstdint>
 #include <string>
 #include <vector>
 
 namespace {{.Namespace}} {
-
+{{if .RuntimeLib.Using}}
+// The runtime is generated separately. All the files of the program include this header directly or indirectly.
+using namespace {{.RuntimeLib.Namespace}};
+{{end}}
 class Mem {
 public:
   static constexpr int32_t kPageSize = {{.PageSize}};
@@ -5,9 +5,7 @@ package gowasm2cpp
 import (
 	"fmt"
 	"math"
-	"os"
 	"regexp"
-	"runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
@@ -228,6 +226,22 @@ func (b *blockStack) FlushExprsIfNeeded(keyword string) []string {
 		return nil
 	}
 
+	stmts, _ := flushExprs(sv)
+	return stmts
+}
+
+// FlushAllExprs flushes all the exprs in the current block to stack variables.
+// FlushAllExprs returns the statements and the names of the stack variables.
+//
+// The exprs must be flushed when entering a nested block, as the nested block might have side effects on the exprs.
+func (b *blockStack) FlushAllExprs() ([]string, []string) {
+	if len(b.blocks) == 0 {
+		return nil, nil
+	}
+	return flushExprs(b.blocks[len(b.blocks)-1].stackvars)
+}
+
+func flushExprs(sv *stackvar.StackVars) ([]string, []string) {
 	type exprTyp struct {
 		expr string
 		typ  stackvar.Type
@@ -247,12 +261,26 @@ func (b *blockStack) FlushExprsIfNeeded(keyword string) []string {
 	}
 
 	var stmts []string
+	var vars []string
 	for _, exprTyp := range exprTyps {
-		stmt := fmt.Sprintf("%s %s = %s;", exprTyp.typ.Cpp(), sv.PushLhs(exprTyp.typ), exprTyp.expr)
+		v := sv.PushLhs(exprTyp.typ)
+		stmt := fmt.Sprintf("%s %s = %s;", exprTyp.typ.Cpp(), v, exprTyp.expr)
 		stmts = append(stmts, stmt)
+		vars = append(vars, v)
 	}
 
-	return stmts
+	return stmts, vars
+}
+
+// skipInstr pops the arguments of the non-polymorphic instruction and pushes a dummy result.
+// skipInstr is used to continue the translation after an unsupported instruction.
+func (b *blockStack) skipInstr(instr disasm.Instr) {
+	for range instr.Op.Args {
+		b.PopExpr()
+	}
+	if t := instr.Op.Returns; t != wasm.ValueType(wasm.BlockTypeEmpty) {
+		b.PushExpr("0", wasmTypeToReturnType(t).stackVarType())
+	}
 }
 
 func (b *blockStack) IsStackVarEmpty() bool {
@@ -281,24 +309,87 @@ func (f *wasmFunc) localVariableType(idx int) returnType {
 }
 
 func (f *wasmFunc) bodyToCpp() ([]string, error) {
-	defer func() {
-		if err := recover(); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			debug.PrintStack()
-			panic(err)
+	body, _, err := f.translateBody(false)
+	return body, err
+}
+
+// diagnose walks the whole function body and returns all the constructs that cannot be converted.
+func (f *wasmFunc) diagnose() []*Diagnostic {
+	_, diags, err := f.translateBody(true)
+	if err != nil {
+		if d, ok := err.(*Diagnostic); ok {
+			return append(diags, d)
 		}
-	}()
+		return append(diags, f.newDiagnostic(-1, "", err.Error()))
+	}
+	return diags
+}
 
+// translateBody converts the function body to C++.
+//
+// If collect is false, translateBody returns the first unsupported construct as an error.
+// If collect is true, translateBody continues as far as possible and returns all the unsupported constructs as diagnostics.
+// The returned body is meaningless when there is a diagnostic.
+func (f *wasmFunc) translateBody(collect bool) (body []string, diags []*Diagnostic, err error) {
 	sig := f.Wasm.Sig
 	funcs := f.Funcs
 	types := f.Types
 
 	dis, err := disasm.NewDisassembly(f.Wasm, f.Mod)
 	if err != nil {
-		return nil, err
+		es := invalidOpcodes(f.Wasm.Body.Code)
+		if len(es) == 0 {
+			return nil, nil, f.newDiagnostic(-1, "", err.Error())
+		}
+		for _, e := range es {
+			d := f.newDiagnostic(e.Offset, e.Name, "not supported by the disassembler")
+			if !collect {
+				return nil, nil, d
+			}
+			diags = append(diags, d)
+		}
+		return nil, diags, nil
+	}
+
+	var offsets []int
+	diagnostic := func(idx int, reason string) *Diagnostic {
+		if offsets == nil {
+			// The offsets are calculated only when needed.
+			offs, err := instrOffsets(f.Wasm.Body.Code)
+			if err != nil || len(offs) != len(dis.Code) {
+				return f.newDiagnostic(-1, dis.Code[idx].Op.Name, reason)
+			}
+			offsets = offs
+		}
+		return f.newDiagnostic(offsets[idx], dis.Code[idx].Op.Name, reason)
+	}
+
+	var current int
+	defer func() {
+		if r := recover(); r != nil {
+			d := diagnostic(current, fmt.Sprintf("internal error: %v", r))
+			if collect {
+				body = nil
+				diags = append(diags, d)
+				err = nil
+				return
+			}
+			body = nil
+			err = d
+		}
+	}()
+
+	// unsupported records an unsupported construct at the current instruction.
+	// unsupported returns a non-nil error when the translation cannot be continued.
+	unsupported := func(reason string) error {
+		d := diagnostic(current, reason)
+		if !collect {
+			return d
+		}
+		diags = append(diags, d)
+		return nil
 	}
 
-	var body []string
 	blockStack := &blockStack{}
 	var tmpidx int
 
@@ -330,39 +421,116 @@ func (f *wasmFunc) bodyToCpp() ([]string, error) {
 		}
 	}
 
+	// blockResults maps a block to its result type. This is used only in the collecting mode, as such blocks are not
+	// supported yet.
+	blockResults := map[int]wasm.BlockType{}
+
 	// Some stack variables must not be merged when they are used across multiple blocks.
 	nomerge := map[string]struct{}{}
 
-	for _, instr := range dis.Code {
+	// flushExprsForBlock evaluates the exprs remaining on the stack before entering a nested block.
+	flushExprsForBlock := func() {
+		stmts, vars := blockStack.FlushAllExprs()
+		for _, s := range stmts {
+			appendBody(s)
+		}
+		for _, v := range vars {
+			nomerge[v] = struct{}{}
+		}
+	}
+
+	// resumeLabels maps a label to the first resume point (PC_B) that jumps to the label.
+	// The first br_table on local 0 (PC_B) in a Go function jumps to the resume points.
+	var resumeLabels map[int]int
+
+	// annotations is the comments of the instructions whose C++ statements are not emitted yet.
+	var annotations []string
+	// mark is the length of the body before the current instruction.
+	var mark int
+	var annotationOffsets []int
+	if f.Annotate {
+		if offs, err := instrOffsets(f.Wasm.Body.Code); err == nil && len(offs) == len(dis.Code) {
+			annotationOffsets = offs
+		}
+	}
+	annotate := func(idx int) {
+		offset := -1
+		if annotationOffsets != nil {
+			offset = annotationOffsets[idx]
+		}
+		annotations = append(annotations, annotation(offset, dis.Code[idx]))
+	}
+	// flushAnnotations inserts the pending annotations before the statements emitted after mark.
+	flushAnnotations := func() {
+		if len(annotations) == 0 || len(body) == mark {
+			return
+		}
+		l := body[mark]
+		indent := l[:len(l)-len(strings.TrimLeft(l, " "))]
+		lines := make([]string, 0, len(annotations)+len(body)-mark)
+		for _, a := range annotations {
+			lines = append(lines, indent+a)
+		}
+		lines = append(lines, body[mark:]...)
+		body = append(body[:mark], lines...)
+		annotations = nil
+	}
+
+	for i, instr := range dis.Code {
+		current = i
+		if f.Annotate {
+			if i > 0 {
+				annotate(i - 1)
+				flushAnnotations()
+			}
+			mark = len(body)
+		}
 		switch instr.Op.Code {
 		case operators.Unreachable:
 			appendBody(`assert(((void)("not reached"), false));`)
 		case operators.Nop:
 			// Do nothing
 		case operators.Block:
+			flushExprsForBlock()
 			var ret string
 			if t := instr.Immediates[0]; t != wasm.BlockTypeEmpty {
-				return nil, fmt.Errorf("br with a returning value is not implemented yet")
+				if err := unsupported("block with a returning value is not implemented yet"); err != nil {
+					return nil, diags, err
+				}
+				blockResults[blockStack.PushBlock(blockTypeBlock, ret)] = t.(wasm.BlockType)
+				break
 			}
 			blockStack.PushBlock(blockTypeBlock, ret)
 		case operators.Loop:
+			flushExprsForBlock()
 			var ret string
 			if t := instr.Immediates[0]; t != wasm.BlockTypeEmpty {
-				return nil, fmt.Errorf("br with a returning value is not implemented yet")
+				if err := unsupported("loop with a returning value is not implemented yet"); err != nil {
+					return nil, diags, err
+				}
+				blockResults[blockStack.PushBlock(blockTypeLoop, ret)] = t.(wasm.BlockType)
+				break
 			}
 			l := blockStack.PushBlock(blockTypeLoop, ret)
 			appendBody("label%d:;", l)
 		case operators.If:
 			cond, _ := blockStack.PopExpr()
+			flushExprsForBlock()
 			var ret string
 			if t := instr.Immediates[0]; t != wasm.BlockTypeEmpty {
-				return nil, fmt.Errorf("br with a returning value is not implemented yet")
+				if err := unsupported("if with a returning value is not implemented yet"); err != nil {
+					return nil, diags, err
+				}
+				blockResults[blockStack.PushBlock(blockTypeIf, ret)] = t.(wasm.BlockType)
+				break
 			}
 			appendBody("if (%s) {", optimizeCondition(cond))
 			blockStack.PushBlock(blockTypeIf, ret)
 		case operators.Else:
 			if _, _, ret := blockStack.PeepBlock(); ret != "" {
-				return nil, fmt.Errorf("br with a returning value is not implemented yet")
+				if err := unsupported("br with a returning value is not implemented yet"); err != nil {
+					return nil, diags, err
+				}
 			}
 			blockStack.UnindentTemporarily()
 			// TODO: Treat the stack correctly especially when 'if' returns some values.
@@ -370,24 +538,39 @@ func (f *wasmFunc) bodyToCpp() ([]string, error) {
 			blockStack.IndentTemporarily()
 		case operators.End:
 			if _, _, ret := blockStack.PeepBlock(); ret != "" {
-				return nil, fmt.Errorf("br with a returning value is not implemented yet")
+				if err := unsupported("br with a returning value is not implemented yet"); err != nil {
+					return nil, diags, err
+				}
 			}
 			idx, btype, _ := blockStack.PopBlock()
+			if t, ok := blockResults[idx]; ok {
+				// Only in the collecting mode. Push a dummy result to continue.
+				blockStack.PushExpr("0", wasmTypeToReturnType(wasm.ValueType(t)).stackVarType())
+			}
 			if btype == blockTypeIf {
 				appendBody("}")
 			}
 			if btype != blockTypeLoop {
 				appendBody("label%d:;", idx)
+				if pcB, ok := resumeLabels[idx]; ok {
+					if p, ok := f.sourcePos(pcB); ok {
+						appendBody("// %s", p)
+					}
+				}
 			}
 		case operators.Br:
 			if _, _, ret := blockStack.PeepBlock(); ret != "" {
-				return nil, fmt.Errorf("br with a returning value is not implemented yet")
+				if err := unsupported("br with a returning value is not implemented yet"); err != nil {
+					return nil, diags, err
+				}
 			}
 			level := instr.Immediates[0].(uint32)
 			appendBody(gotoOrReturn(int(level)))
 		case operators.BrIf:
 			if _, _, ret := blockStack.PeepBlock(); ret != "" {
-				return nil, fmt.Errorf("br_if with a returning value is not implemented yet")
+				if err := unsupported("br_if with a returning value is not implemented yet"); err != nil {
+					return nil, diags, err
+				}
 			}
 			level := instr.Immediates[0].(uint32)
 			expr, _ := blockStack.PopExpr()
@@ -398,15 +581,28 @@ func (f *wasmFunc) bodyToCpp() ([]string, error) {
 			appendBody("}")
 		case operators.BrTable:
 			if _, _, ret := blockStack.PeepBlock(); ret != "" {
-				return nil, fmt.Errorf("br_table with a returning value is not implemented yet")
+				if err := unsupported("br_table with a returning value is not implemented yet"); err != nil {
+					return nil, diags, err
+				}
 			}
 			expr, _ := blockStack.PopExpr()
 			appendBody("switch (%s) {", expr)
 			len := int(instr.Immediates[0].(uint32))
+			recordResumeLabels := resumeLabels == nil && expr == "local0_"
+			if recordResumeLabels {
+				resumeLabels = map[int]int{}
+			}
 			for i := 0; i < len; i++ {
 				level := int(instr.Immediates[1+i].(uint32))
 				gt := gotoOrReturn(int(level))
 				appendBody("case %d: %s", i, gt)
+				if recordResumeLabels {
+					if l, _, ok := blockStack.PeepBlockLevel(level); ok {
+						if _, ok := resumeLabels[l]; !ok {
+							resumeLabels[l] = i
+						}
+					}
+				}
 			}
 			level := int(instr.Immediates[len+1].(uint32))
 			appendBody("default: %s", gotoOrReturn(int(level)))
@@ -432,7 +628,13 @@ func (f *wasmFunc) bodyToCpp() ([]string, error) {
 			var ret string
 			if n := len(f.Wasm.Sig.ReturnTypes); n > 0 {
 				if n > 1 {
-					return nil, fmt.Errorf("call: unexpected num of return types: %d", n)
+					if err := unsupported(fmt.Sprintf("unexpected num of return types: %d", n)); err != nil {
+						return nil, diags, err
+					}
+					for _, t := range f.Wasm.Sig.ReturnTypes {
+						blockStack.PushExpr("0", wasmTypeToReturnType(t).stackVarType())
+					}
+					break
 				}
 				t := wasmTypeToReturnType(f.Wasm.Sig.ReturnTypes[0])
 				ret = fmt.Sprintf("%s %s = ", t.Cpp(), blockStack.PushLhs(t.stackVarType()))
@@ -442,7 +644,7 @@ func (f *wasmFunc) bodyToCpp() ([]string, error) {
 			if f.Import {
 				imp = "import_->"
 			}
-			appendBody("%s%s%s(%s);", ret, imp, identifierFromString(f.Wasm.Name), strings.Join(args, ", "))
+			appendBody("%s%s%s(%s);", ret, imp, f.Identifier(), strings.Join(args, ", "))
 		case operators.CallIndirect:
 			idx, _ := blockStack.PopExpr()
 			typeid := instr.Immediates[0].(uint32)
@@ -457,7 +659,13 @@ func (f *wasmFunc) bodyToCpp() ([]string, error) {
 			var ret string
 			if n := len(t.Sig.ReturnTypes); n > 0 {
 				if n > 1 {
-					return nil, fmt.Errorf("call-indirect: unexpected num of return types: %d", n)
+					if err := unsupported(fmt.Sprintf("unexpected num of return types: %d", n)); err != nil {
+						return nil, diags, err
+					}
+					for _, t := range t.Sig.ReturnTypes {
+						blockStack.PushExpr("0", wasmTypeToReturnType(t).stackVarType())
+					}
+					break
 				}
 				t := wasmTypeToReturnType(t.Sig.ReturnTypes[0])
 				ret = fmt.Sprintf("%s %s = ", t.Cpp(), blockStack.PushLhs(t.stackVarType()))
@@ -659,6 +867,9 @@ func (f *wasmFunc) bodyToCpp() ([]string, error) {
 			if offset != 0 {
 				off = fmt.Sprintf(" + %d", offset)
 			}
+			if p, ok := f.callSourcePos(idx); ok {
+				appendBody("// %s", p)
+			}
 			appendBody("mem_->StoreInt64((%s)%s, %s);", addr, off, idx)
 		case operators.F32Store:
 			for _, expr := range blockStack.FlushExprsIfNeeded("mem_->") {
@@ -920,7 +1131,8 @@ func (f *wasmFunc) bodyToCpp() ([]string, error) {
 			v := fmt.Sprintf("stack0_%d_", tmpidx)
 			tmpidx++
 			appendBody("uint32_t %s = static_cast<uint32_t>(%s);", v, arg)
-			blockStack.PushExpr(fmt.Sprintf("static_cast<int32_t>(%s ? __builtin_clzl(%s) : 32)", v, v), stackvar.I32)
+			// __builtin_clzl counts the leading zeros of unsigned long, which is 64 bits on LP64. Use the unsigned int version.
+			blockStack.PushExpr(fmt.Sprintf("static_cast<int32_t>(%s ? __builtin_clz(%s) : 32)", v, v), stackvar.I32)
 		case operators.I32Ctz:
 			arg, _ := blockStack.PopExpr()
 			v := fmt.Sprintf("stack0_%d_", tmpidx)
@@ -1230,20 +1442,33 @@ func (f *wasmFunc) bodyToCpp() ([]string, error) {
 			expr, _ := blockStack.PopExpr()
 			blockStack.PushExpr(fmt.Sprintf("static_cast<double>(%s)", expr), stackvar.F64)
 
-		case operators.I32ReinterpretF32:
-			return nil, fmt.Errorf("I32ReinterpretF32 is not implemented yet")
-		case operators.I64ReinterpretF64:
-			return nil, fmt.Errorf("I64ReinterpretF64 is not implemented yet")
-		case operators.F32ReinterpretI32:
-			return nil, fmt.Errorf("F32ReinterpretI32 is not implemented yet")
-		case operators.F64ReinterpretI64:
-			return nil, fmt.Errorf("F64ReinterpretI64 is not implemented yet")
+		case operators.I32ReinterpretF32, operators.I64ReinterpretF64, operators.F32ReinterpretI32, operators.F64ReinterpretI64:
+			if err := unsupported("not implemented yet"); err != nil {
+				return nil, diags, err
+			}
+			blockStack.skipInstr(instr)
 
 		default:
-			return nil, fmt.Errorf("unexpected operator: %v", instr.Op)
+			if instr.Op.Polymorphic {
+				if err := unsupported("unexpected operator"); err != nil {
+					return nil, diags, err
+				}
+				// The stack effect of the operator is unknown. Stop here with the diagnostics collected so far.
+				return nil, diags, nil
+			}
+			if err := unsupported("unexpected operator"); err != nil {
+				return nil, diags, err
+			}
+			blockStack.skipInstr(instr)
 		}
 	}
 
+	if f.Annotate && len(dis.Code) > 0 {
+		annotate(len(dis.Code) - 1)
+		flushAnnotations()
+		mark = len(body)
+	}
+
 	switch len(sig.ReturnTypes) {
 	case 0:
 		// Do nothing.
@@ -1259,14 +1484,27 @@ func (f *wasmFunc) bodyToCpp() ([]string, error) {
 			appendBody(`return 0;`)
 		}
 	default:
-		return nil, fmt.Errorf("unexpected num of return types: %d", len(sig.ReturnTypes))
+		return nil, diags, f.newDiagnostic(-1, "", fmt.Sprintf("unexpected num of return types: %d", len(sig.ReturnTypes)))
+	}
+
+	if f.Annotate {
+		flushAnnotations()
+		// The rest of the instructions don't emit any statements.
+		for _, a := range annotations {
+			body = append(body, "  "+a)
+		}
+	}
+
+	if len(diags) > 0 {
+		return nil, diags, nil
 	}
 
 	body = aggregateStackVars(body, nomerge)
-	body = optimizeGoto(body)
+	// optimizeGoto sees adjacent lines. Skip comments like source positions and annotations.
+	body = ignoringComments(body, optimizeGoto)
 	body = removeUnusedLabels(body)
 
-	return body, nil
+	return body, nil, nil
 }
 
 var (
@@ -1309,9 +1547,13 @@ func aggregateStackVars(body []string, nomerge map[string]struct{}) []string {
 		}
 
 		if _, ok := nomerge[m[3]]; ok {
-			nomergelines = append(nomergelines, body[i])
+			// Declare the variable first and keep the initialization as an assignment.
+			nomergelines = append(nomergelines, fmt.Sprintf("  %s;", m[1]))
 			varmap[m[3]] = m[3]
-			body[i] = ""
+			body[i] = strings.Replace(body[i], m[1], m[3], 1)
+			if strings.TrimSpace(body[i]) == m[3]+";" {
+				body[i] = ""
+			}
 			continue
 		}
 
@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"bytes"
+	"debug/gosym"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// funcValueOffset is the offset between PC_F and the function index without imports.
+// See cmd/link/internal/wasm/asm.go.
+const funcValueOffset = 0x1000
+
+// sourcePos is a position in a Go source file.
+type sourcePos struct {
+	File string
+	Line int
+}
+
+func (p sourcePos) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// pcInfo is the information at a resume point.
+type pcInfo struct {
+	// SPDelta is the size of the stack frame at the resume point. SPDelta is -1 when the size is unknown.
+	SPDelta int
+
+	// Pos is the source position. Pos.File is empty when the position is unknown.
+	Pos sourcePos
+}
+
+// maxPCB is the maximum number of resume points in a function.
+const maxPCB = 1 << 16
+
+// pcLineTable maps PCs of Go functions to source positions.
+//
+// On Wasm, a PC is PC_F << 16 | PC_B, where PC_F is funcValueOffset plus the function index without imports,
+// and PC_B is the index of a resume point in the function.
+type pcLineTable struct {
+	// old is used for the formats before Go 1.18, where the function table has PCs.
+	old *gosym.Table
+
+	// The rest are used for the formats since Go 1.18, where the function table has PC_Fs.
+	minLC   uint32
+	funcs   map[uint32]uint32 // PC_F -> offset of _func
+	functab []byte
+	cutab   []byte
+	filetab []byte
+	pctab   []byte
+}
+
+var pclntabMagics = [][]byte{
+	{0xfb, 0xff, 0xff, 0xff}, // Go 1.2
+	{0xfa, 0xff, 0xff, 0xff}, // Go 1.16
+	{0xf0, 0xff, 0xff, 0xff}, // Go 1.18
+	{0xf1, 0xff, 0xff, 0xff}, // Go 1.20
+}
+
+// findPCLNTab finds runtime.pclntab from the initial memory.
+// findPCLNTab returns nil when the table is not found e.g., when the module is not compiled from Go.
+func findPCLNTab(data []wasmData) []byte {
+	var mem []byte
+	for _, d := range data {
+		if n := d.Offset + len(d.Data); len(mem) < n {
+			mem = append(mem, make([]byte, n-len(mem))...)
+		}
+		copy(mem[d.Offset:], d.Data)
+	}
+
+	for _, m := range pclntabMagics {
+		// The header is followed by padding, the minimum instruction size (1 on Wasm) and the pointer size (8 on Wasm).
+		magic := append(append([]byte{}, m...), 0, 0, 1, 8)
+		if i := bytes.Index(mem, magic); i >= 0 {
+			return mem[i:]
+		}
+	}
+	return nil
+}
+
+// newPCLineTable parses runtime.pclntab in the initial memory.
+// newPCLineTable returns nil without an error when the table is not found.
+func newPCLineTable(data []wasmData) (*pcLineTable, error) {
+	tab := findPCLNTab(data)
+	if tab == nil {
+		return nil, nil
+	}
+
+	switch binary.LittleEndian.Uint32(tab) {
+	case 0xfffffffb, 0xfffffffa:
+		t, err := gosym.NewTable(nil, gosym.NewLineTable(tab, 0))
+		if err != nil {
+			return nil, err
+		}
+		return &pcLineTable{
+			old: t,
+		}, nil
+	}
+
+	const headerSize = 8 + 8*8
+	if len(tab) < headerSize {
+		return nil, fmt.Errorf("pclntab: too short header")
+	}
+	word := func(i int) int {
+		return int(binary.LittleEndian.Uint64(tab[8+8*i:]))
+	}
+	nfunc := word(0)
+	textStart := uint32(word(2))
+	// word(3) is the offset of the function name table.
+	cuOffset := word(4)
+	filetabOffset := word(5)
+	pctabOffset := word(6)
+	pclnOffset := word(7)
+	for _, o := range []int{cuOffset, filetabOffset, pctabOffset, pclnOffset} {
+		if o > len(tab) {
+			return nil, fmt.Errorf("pclntab: offset out of range: %d", o)
+		}
+	}
+
+	t := &pcLineTable{
+		minLC:   uint32(tab[6]),
+		funcs:   map[uint32]uint32{},
+		functab: tab[pclnOffset:],
+		cutab:   tab[cuOffset:],
+		filetab: tab[filetabOffset:],
+		pctab:   tab[pctabOffset:],
+	}
+	if len(t.functab) < nfunc*8 {
+		return nil, fmt.Errorf("pclntab: too short function table")
+	}
+	for i := 0; i < nfunc; i++ {
+		entry := binary.LittleEndian.Uint32(t.functab[8*i:])
+		off := binary.LittleEndian.Uint32(t.functab[8*i+4:])
+		t.funcs[textStart+entry] = off
+	}
+	return t, nil
+}
+
+// funcPCs returns the information for each resume point (PC_B) in the function at funcIndex.
+// funcIndex is the function index without imports.
+// funcPCs returns nil when the function is not a Go function.
+func (t *pcLineTable) funcPCs(funcIndex int) []pcInfo {
+	pcF := uint32(funcValueOffset + funcIndex)
+
+	if t.old != nil {
+		// gosym doesn't provide the frame sizes.
+		entry := uint64(pcF) << 16
+		var pcs []pcInfo
+		for pcB := 0; pcB < maxPCB; pcB++ {
+			file, line, f := t.old.PCToLine(entry | uint64(pcB))
+			if f == nil || f.Entry != entry || file == "" {
+				break
+			}
+			pcs = append(pcs, pcInfo{
+				SPDelta: -1,
+				Pos:     sourcePos{File: file, Line: line},
+			})
+		}
+		return pcs
+	}
+
+	off, ok := t.funcs[pcF]
+	if !ok {
+		return nil
+	}
+	// The fields of _func are: entryOff, nameOff, args, deferreturn, pcsp, pcfile, pcln, npcdata, cuOffset, ...
+	if int(off)+9*4 > len(t.functab) {
+		return nil
+	}
+	field := func(i int) uint32 {
+		return binary.LittleEndian.Uint32(t.functab[int(off)+4*i:])
+	}
+	sps := t.pcValues(field(4))
+	files := t.pcValues(field(5))
+	lines := t.pcValues(field(6))
+	cu := int(field(8))
+
+	pcs := make([]pcInfo, len(lines))
+	for i := range pcs {
+		pcs[i].SPDelta = -1
+		if i < len(sps) {
+			pcs[i].SPDelta = int(sps[i])
+		}
+		if i < len(files) {
+			pcs[i].Pos = sourcePos{
+				File: t.fileName(cu, int(files[i])),
+				Line: int(lines[i]),
+			}
+		}
+	}
+	return pcs
+}
+
+// fileName returns the file name of the file number in the compilation unit.
+func (t *pcLineTable) fileName(cu int, fileno int) string {
+	i := 4 * (cu + fileno)
+	if fileno < 0 || i+4 > len(t.cutab) {
+		return ""
+	}
+	off := int(binary.LittleEndian.Uint32(t.cutab[i:]))
+	if off >= len(t.filetab) {
+		return ""
+	}
+	file := t.filetab[off:]
+	if n := bytes.IndexByte(file, 0); n >= 0 {
+		file = file[:n]
+	}
+	return string(file)
+}
+
+// pcValues decodes the pc-value table at off and returns the values for each PC_B.
+func (t *pcLineTable) pcValues(off uint32) []int32 {
+	if off == 0 || int(off) >= len(t.pctab) {
+		return nil
+	}
+	p := t.pctab[off:]
+	var vals []int32
+	val := int32(-1)
+	for first := true; ; first = false {
+		uvdelta, n := binary.Uvarint(p)
+		if n <= 0 || uvdelta == 0 && !first {
+			return vals
+		}
+		p = p[n:]
+		if uvdelta&1 != 0 {
+			uvdelta = ^(uvdelta >> 1)
+		} else {
+			uvdelta >>= 1
+		}
+		val += int32(uvdelta)
+
+		pcdelta, n := binary.Uvarint(p)
+		if n <= 0 {
+			return vals
+		}
+		p = p[n:]
+		for i := uint64(0); i < pcdelta*uint64(t.minLC) && len(vals) < maxPCB; i++ {
+			vals = append(vals, val)
+		}
+	}
+}
+
+// sourcePos returns the source position of the resume point pcB in the function.
+func (f *wasmFunc) sourcePos(pcB int) (sourcePos, bool) {
+	if pcB < 0 || pcB >= len(f.PCs) || f.PCs[pcB].Pos.File == "" {
+		return sourcePos{}, false
+	}
+	return f.PCs[pcB].Pos, true
+}
+
+// returnAddressRe matches an i64 constant that might be a return address pushed before a call.
+var returnAddressRe = regexp.MustCompile(`^([0-9]+)LL$`)
+
+// callSourcePos returns the source position of the call whose return address is expr.
+// A Go function stores the return address PC_F << 16 | PC_B before calling a function.
+func (f *wasmFunc) callSourcePos(expr string) (sourcePos, bool) {
+	if f.PCs == nil {
+		return sourcePos{}, false
+	}
+	m := returnAddressRe.FindStringSubmatch(expr)
+	if m == nil {
+		return sourcePos{}, false
+	}
+	v, err := strconv.ParseUint(m[1], 10, 64)
+	if err != nil {
+		return sourcePos{}, false
+	}
+	if int(v>>16) != funcValueOffset+f.Index-len(f.Mod.Import.Entries) || v&0xffff == 0 {
+		return sourcePos{}, false
+	}
+	// The call belongs to the previous resume point.
+	return f.sourcePos(int(v&0xffff) - 1)
+}
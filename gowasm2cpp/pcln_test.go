@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"testing"
+)
+
+func TestPCValues(t *testing.T) {
+	tab := &pcLineTable{
+		minLC: 1,
+		// Line 10 for PC_B 0 and 1, and line 12 for PC_B 2.
+		pctab: []byte{0, 22, 2, 4, 1, 0},
+	}
+	got := tab.pcValues(1)
+	want := []int32{10, 10, 12}
+	if len(got) != len(want) {
+		t.Fatalf("pcValues(1): got: %v, want: %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("pcValues(1): got: %v, want: %v", got, want)
+			break
+		}
+	}
+}
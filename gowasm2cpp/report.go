@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// SizeReport attributes the sizes of the original Wasm and the generated C++ to Go packages and symbols.
+type SizeReport struct {
+	Packages []PackageSize `json:"packages"`
+	Symbols  []SymbolSize  `json:"symbols"`
+	Data     DataSize      `json:"data"`
+}
+
+// PackageSize is the total size of the functions in a Go package.
+type PackageSize struct {
+	Package   string `json:"package"`
+	NumFuncs  int    `json:"numFuncs"`
+	WasmBytes int    `json:"wasmBytes"`
+	CppBytes  int    `json:"cppBytes"`
+	CppLines  int    `json:"cppLines"`
+}
+
+// SymbolSize is the size of a function.
+type SymbolSize struct {
+	Name      string `json:"name"`
+	Package   string `json:"package"`
+	WasmBytes int    `json:"wasmBytes"`
+	CppBytes  int    `json:"cppBytes"`
+	CppLines  int    `json:"cppLines"`
+
+	// Unsupported reports whether the function cannot be converted.
+	// The C++ sizes are zero in this case.
+	Unsupported bool `json:"unsupported,omitempty"`
+}
+
+// DataSize is the size of the data segments copied into the initial memory.
+//
+// The data segments don't have symbol names, so they are not attributed to packages.
+type DataSize struct {
+	Segments  []DataSegmentSize `json:"segments"`
+	WasmBytes int               `json:"wasmBytes"`
+	CppBytes  int               `json:"cppBytes"`
+}
+
+// DataSegmentSize is the size of a data segment.
+type DataSegmentSize struct {
+	Offset    int `json:"offset"`
+	WasmBytes int `json:"wasmBytes"`
+}
+
+// packageFromSymbol returns the Go package name of the given symbol name.
+// packageFromSymbol returns an empty string when the symbol doesn't belong to any package.
+func packageFromSymbol(name string) string {
+	// Type arguments of generic instantiations might include import paths (e.g. pkg.F[example.com/x.T]).
+	// The package name never includes a bracket.
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+
+	// The Go linker escapes dots in the last path element (e.g. gopkg.in/yaml%2ev2.Marshal).
+	// Then, the package name ends at the first dot after the last slash.
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	return name[:slash+1+dot]
+}
+
+// Report converts the given Wasm file in memory and reports the sizes of the functions and the data.
+func Report(wasmFile string) (*SizeReport, error) {
+	m, err := loadModule(wasmFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &SizeReport{}
+	pkgs := map[string]*PackageSize{}
+	for i, f := range m.fs {
+		s := SymbolSize{
+			Name:      f.Wasm.Name,
+			Package:   packageFromSymbol(f.Wasm.Name),
+			WasmBytes: len(m.mod.Code.Bodies[i].Code),
+		}
+		var impl string
+		if err := recoverError(func() error {
+			var err error
+			impl, err = f.CppImpl("Inst", "")
+			return err
+		}); err != nil {
+			s.Unsupported = true
+		} else {
+			s.CppBytes = len(impl)
+			s.CppLines = strings.Count(impl, "\n")
+		}
+		r.Symbols = append(r.Symbols, s)
+
+		p, ok := pkgs[s.Package]
+		if !ok {
+			p = &PackageSize{
+				Package: s.Package,
+			}
+			pkgs[s.Package] = p
+		}
+		p.NumFuncs++
+		p.WasmBytes += s.WasmBytes
+		p.CppBytes += s.CppBytes
+		p.CppLines += s.CppLines
+	}
+
+	for _, p := range pkgs {
+		r.Packages = append(r.Packages, *p)
+	}
+	sort.Slice(r.Packages, func(a, b int) bool {
+		if r.Packages[a].CppBytes != r.Packages[b].CppBytes {
+			return r.Packages[a].CppBytes > r.Packages[b].CppBytes
+		}
+		return r.Packages[a].Package < r.Packages[b].Package
+	})
+	sort.Slice(r.Symbols, func(a, b int) bool {
+		if r.Symbols[a].CppBytes != r.Symbols[b].CppBytes {
+			return r.Symbols[a].CppBytes > r.Symbols[b].CppBytes
+		}
+		return r.Symbols[a].Name < r.Symbols[b].Name
+	})
+
+	var flatten []byte
+	for _, d := range m.data {
+		r.Data.Segments = append(r.Data.Segments, DataSegmentSize{
+			Offset:    d.Offset,
+			WasmBytes: len(d.Data),
+		})
+		r.Data.WasmBytes += len(d.Data)
+		flatten = append(flatten, d.Data...)
+	}
+	var buf bytes.Buffer
+	if err := memCppTmpl.Execute(&buf, struct {
+		IncludePath string
+		Namespace   string
+		InitPageNum int
+		Data        []wasmData
+		FlattenData []byte
+	}{
+		Data:        m.data,
+		FlattenData: flatten,
+	}); err != nil {
+		return nil, err
+	}
+	r.Data.CppBytes = buf.Len()
+
+	return r, nil
+}
@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"testing"
+)
+
+func TestPackageFromSymbol(t *testing.T) {
+	cases := []struct {
+		In  string
+		Out string
+	}{
+		{In: "runtime.schedule", Out: "runtime"},
+		{In: "runtime.(*mheap).alloc", Out: "runtime"},
+		{In: "github.com/hajimehoshi/ebiten/v2.(*Image).DrawImage", Out: "github.com/hajimehoshi/ebiten/v2"},
+		{In: "gopkg.in/yaml%2ev2.Marshal", Out: "gopkg.in/yaml%2ev2"},
+		{In: "internal_abi.__Type_.ExportedMethods", Out: "internal_abi"},
+		{In: "slices.Sort[go.shape.int]", Out: "slices"},
+		{In: "example.com/pkg.F[example.com/x.T]", Out: "example.com/pkg"},
+		{In: "example.com/pkg.(*List[example.com/x/y.T]).Push", Out: "example.com/pkg"},
+		{In: "pkg.G[go.shape.struct { F example.com/x.T }]", Out: "pkg"},
+		{In: "memcmp", Out: ""},
+	}
+	for _, c := range cases {
+		if got, want := packageFromSymbol(c.In), c.Out; got != want {
+			t.Errorf("packageFromSymbol(%q): got: %v, want: %v", c.In, got, want)
+		}
+	}
+}
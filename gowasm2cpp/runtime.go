@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// runtimeLib is the location of the runtime files that don't depend on the module: bits, bytes, js, taskqueue and
+// gl.
+type runtimeLib struct {
+	// IncludePath is the include path of the runtime headers.
+	IncludePath string
+
+	// Namespace is the namespace of the runtime.
+	Namespace string
+
+	// Using reports whether the program's namespace needs a using-directive for the runtime's namespace.
+	Using bool
+}
+
+// newRuntimeLib returns the location of the runtime for a program.
+// If options.RuntimeNamespace is empty, the runtime files are generated with the program.
+func newRuntimeLib(incpath string, namespace string, options *Options) runtimeLib {
+	if options.RuntimeNamespace == "" {
+		return runtimeLib{
+			IncludePath: incpath,
+			Namespace:   namespace,
+		}
+	}
+	var rtincpath string
+	if options.RuntimeInclude != "" {
+		rtincpath = filepath.ToSlash(options.RuntimeInclude)
+		if rtincpath[len(rtincpath)-1] != '/' {
+			rtincpath += "/"
+		}
+	}
+	return runtimeLib{
+		IncludePath: rtincpath,
+		Namespace:   options.RuntimeNamespace,
+		Using:       options.RuntimeNamespace != namespace,
+	}
+}
+
+// GenerateRuntime generates the runtime files that don't depend on the module into outDir: bits, bytes, js,
+// taskqueue and gl. The runtime can be built once as a library, and shared by programs generated with
+// Options.RuntimeNamespace.
+//
+// The other files are generated per program. interp is also generated per program, as the interpreter accesses the
+// program's Mem, whose page size and initial data come from the module.
+func GenerateRuntime(outDir string, namespace string) error {
+	var g errgroup.Group
+	for _, w := range []func(dir string, incpath string, namespace string) error{
+		writeBits,
+		writeBytes,
+		writeJS,
+		writeTaskQueue,
+		writeGL,
+	} {
+		w := w
+		g.Go(func() error {
+			return w(outDir, "", namespace)
+		})
+	}
+	return g.Wait()
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"strings"
+	"testing"
+)
+
+const envMainCpp = `#include "go.h"
+
+#include <cstdlib>
+#include <iostream>
+#include <stdexcept>
+#include <string>
+
+int main() {
+  setenv("FOO", "host", 1);
+  {
+    go2cpp_test::Go go;
+    go.Run(std::vector<std::string>{"test", "env"});
+  }
+  {
+    go2cpp_test::Go go;
+    go.Run(std::vector<std::string>{"test", "env"}, {{"FOO", "foo"}, {"BAR", "bar"}, {"EMPTY", ""}});
+  }
+  {
+    go2cpp_test::Go go;
+    std::map<std::string, std::string> env = go2cpp_test::Go::HostEnv();
+    go.Run(std::vector<std::string>{"test", "env"}, {{"FOO", env["FOO"]}});
+  }
+  {
+    go2cpp_test::Go go;
+    try {
+      go.Run(std::vector<std::string>{"test", "env"}, {{"FOO", std::string(8192, 'a')}});
+      std::cout << "no exception" << std::endl;
+    } catch (const std::runtime_error& e) {
+      std::cout << e.what() << std::endl;
+    }
+    // The Go can still run after the failure.
+    go.Run(std::vector<std::string>{"test", "env"}, {{"FOO", "again"}});
+  }
+  return 0;
+}
+`
+
+const statMainCpp = `#include "go.h"
+
+#include <cstdio>
+#include <cstdlib>
+#include <string>
+#include <unistd.h>
+#include <utime.h>
+
+int main() {
+  char path[] = "/tmp/go2cpp-stat-XXXXXX";
+  int fd = mkstemp(path);
+  if (fd < 0) {
+    std::perror("mkstemp");
+    return 1;
+  }
+  close(fd);
+  utimbuf times = {};
+  times.actime = 1000000000;
+  times.modtime = 1234567890;
+  utime(path, &times);
+
+  go2cpp_test::Go go;
+  int code = go.Run(std::vector<std::string>{"test", "stat", path});
+  unlink(path);
+  return code;
+}
+`
+
+const fsMainCpp = `#include "go.h"
+
+int main() {
+  go2cpp_test::Go go;
+  return go.Run(std::vector<std::string>{"test", "fs"});
+}
+`
+
+const processMainCpp = `#include "go.h"
+
+#include <memory>
+#include <string>
+#include <unistd.h>
+#include <vector>
+
+int main() {
+  std::vector<gid_t> groups(getgroups(0, nullptr));
+  groups.resize(getgroups(groups.size(), groups.data()));
+  std::string gs;
+  for (gid_t g : groups) {
+    if (!gs.empty()) {
+      gs += ",";
+    }
+    gs += std::to_string(g);
+  }
+
+  go2cpp_test::Go go;
+  go.Global().ToObject().Set("throwError", go2cpp_test::Value{std::make_shared<go2cpp_test::Function>(
+    [](go2cpp_test::Value self, std::vector<go2cpp_test::Value> args) -> go2cpp_test::Value {
+      throw go2cpp_test::Exception{go2cpp_test::Value{"error from the host"}};
+    })});
+  return go.Run(std::vector<std::string>{
+    "test",
+    "process",
+    std::to_string(getpid()),
+    std::to_string(getppid()),
+    std::to_string(getuid()),
+    std::to_string(geteuid()),
+    gs,
+  });
+}
+`
+
+func TestSystem(t *testing.T) {
+	p := compileCppProgram(t, "./testdata/system", nil)
+	defer p.remove()
+
+	t.Run("Env", func(t *testing.T) {
+		got := strings.TrimSpace(p.run(t, "env", envMainCpp))
+		want := strings.Join([]string{
+			`environ: ""`,
+			`FOO: ""`,
+			// The environment variables are sorted by the keys.
+			`environ: "BAR=bar,EMPTY=,FOO=foo"`,
+			`FOO: "foo"`,
+			`environ: "FOO=host"`,
+			`FOO: "host"`,
+			"Go::Start: total length of command line and environment variables exceeds limit",
+			`environ: "FOO=again"`,
+			`FOO: "again"`,
+		}, "\n")
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+	t.Run("Stat", func(t *testing.T) {
+		got := strings.TrimSpace(p.run(t, "stat", statMainCpp))
+		want := "atime: 1000000000, mtime: 1234567890, modtime: 1234567890"
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+	t.Run("FS", func(t *testing.T) {
+		got := strings.TrimSpace(p.run(t, "fs", fsMainCpp))
+		want := strings.Join([]string{
+			"link again: exist: true",
+			`link: "hello", mode: -rw-r-----, nlink: 2`,
+			`symlink: "a.txt", readlink on a file: true`,
+		}, "\n")
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+	t.Run("Process", func(t *testing.T) {
+		got := strings.TrimSpace(p.run(t, "process", processMainCpp))
+		want := strings.Join([]string{
+			"ids: ok",
+			"chdir: true",
+			"chdir to a missing directory: not exist: true",
+			"call: error from the host",
+			"invoke: error from the host",
+		}, "\n")
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+}
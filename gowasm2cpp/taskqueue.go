@@ -65,13 +65,47 @@ class TaskQueue {
 public:
   using Task = std::function<void()>;
 
+  TaskQueue() = default;
+  ~TaskQueue();
+  TaskQueue(const TaskQueue&) = delete;
+  TaskQueue& operator=(const TaskQueue&) = delete;
+
   void Enqueue(Task task);
   Task Dequeue();
 
+  // TryDequeue dequeues a task without blocking. TryDequeue returns false if there is no task.
+  bool TryDequeue(Task* task);
+
+  // Clear discards all the enqueued tasks.
+  void Clear();
+
+  // Close makes Enqueue discard new tasks until Open is called. The tasks already enqueued are kept.
+  void Close();
+
+  // Open makes Enqueue accept new tasks again after Close.
+  void Open();
+
+  // SetWakeupCallback sets the function called whenever a task is enqueued. The callback is called on the
+  // enqueueing thread.
+  void SetWakeupCallback(std::function<void()> callback);
+
+  // WakeupFd returns the file descriptor that becomes readable when a task is enqueued, or -1 if this is not
+  // supported on the platform. The file descriptor is drained by DrainWakeupFd.
+  int WakeupFd();
+  void DrainWakeupFd();
+
+  // Rewake calls the wakeup callback and makes the wakeup file descriptor readable again if there are enqueued tasks.
+  void Rewake();
+
 private:
+  void WriteWakeupFd();
+
   std::mutex mutex_;
   std::condition_variable cond_;
   std::queue<Task> queue_;
+  std::function<void()> wakeup_callback_;
+  int wakeup_fds_[2] = {-1, -1};
+  bool closed_ = false;
 };
 
 class Timer {
@@ -109,14 +143,39 @@ var taskqueueCppTmpl = template.Must(template.New("taskqueue.cpp").Parse(`// Cod
 #include <chrono>
 #include <memory>
 
+#ifndef _WIN32
+#include <fcntl.h>
+#include <unistd.h>
+#endif
+
 namespace {{.Namespace}} {
 
+TaskQueue::~TaskQueue() {
+#ifndef _WIN32
+  for (int fd : wakeup_fds_) {
+    if (fd != -1) {
+      close(fd);
+    }
+  }
+#endif
+}
+
 void TaskQueue::Enqueue(Task task) {
+  std::function<void()> callback;
   {
     std::lock_guard<std::mutex> lock{mutex_};
+    if (closed_) {
+      // The parameter task is destructed after the lock is released, as in Clear.
+      return;
+    }
     queue_.push(task);
+    callback = wakeup_callback_;
+    WriteWakeupFd();
   }
   cond_.notify_one();
+  if (callback) {
+    callback();
+  }
 }
 
 TaskQueue::Task TaskQueue::Dequeue() {
@@ -127,6 +186,108 @@ TaskQueue::Task TaskQueue::Dequeue() {
   return task;
 }
 
+bool TaskQueue::TryDequeue(Task* task) {
+  std::lock_guard<std::mutex> lock{mutex_};
+  if (queue_.empty()) {
+    return false;
+  }
+  *task = queue_.front();
+  queue_.pop();
+  return true;
+}
+
+void TaskQueue::Clear() {
+  std::queue<Task> queue;
+  {
+    std::lock_guard<std::mutex> lock{mutex_};
+    std::swap(queue, queue_);
+  }
+  // The tasks are destructed outside of the lock, as a task's destructor might enqueue another task.
+}
+
+void TaskQueue::Close() {
+  std::lock_guard<std::mutex> lock{mutex_};
+  closed_ = true;
+}
+
+void TaskQueue::Open() {
+  std::lock_guard<std::mutex> lock{mutex_};
+  closed_ = false;
+}
+
+void TaskQueue::SetWakeupCallback(std::function<void()> callback) {
+  std::lock_guard<std::mutex> lock{mutex_};
+  wakeup_callback_ = std::move(callback);
+}
+
+int TaskQueue::WakeupFd() {
+#ifdef _WIN32
+  return -1;
+#else
+  std::lock_guard<std::mutex> lock{mutex_};
+  if (wakeup_fds_[0] != -1) {
+    return wakeup_fds_[0];
+  }
+  if (pipe(wakeup_fds_) != 0) {
+    wakeup_fds_[0] = -1;
+    wakeup_fds_[1] = -1;
+    return -1;
+  }
+  for (int fd : wakeup_fds_) {
+    fcntl(fd, F_SETFL, fcntl(fd, F_GETFL) | O_NONBLOCK);
+    fcntl(fd, F_SETFD, FD_CLOEXEC);
+  }
+  // Make the file descriptor readable if there are already tasks.
+  if (!queue_.empty()) {
+    WriteWakeupFd();
+  }
+  return wakeup_fds_[0];
+#endif
+}
+
+void TaskQueue::DrainWakeupFd() {
+#ifndef _WIN32
+  int fd = -1;
+  {
+    std::lock_guard<std::mutex> lock{mutex_};
+    fd = wakeup_fds_[0];
+  }
+  if (fd == -1) {
+    return;
+  }
+  char buf[64];
+  while (read(fd, buf, sizeof(buf)) > 0) {
+  }
+#endif
+}
+
+void TaskQueue::Rewake() {
+  std::function<void()> callback;
+  {
+    std::lock_guard<std::mutex> lock{mutex_};
+    if (queue_.empty()) {
+      return;
+    }
+    callback = wakeup_callback_;
+    WriteWakeupFd();
+  }
+  if (callback) {
+    callback();
+  }
+}
+
+void TaskQueue::WriteWakeupFd() {
+  // mutex_ must be locked.
+#ifndef _WIN32
+  if (wakeup_fds_[1] != -1) {
+    char c = 0;
+    // The pipe might be full, but then the file descriptor is already readable.
+    ssize_t n = write(wakeup_fds_[1], &c, 1);
+    (void)n;
+  }
+#endif
+}
+
 Timer::Timer(std::function<void()> func, double interval)
     : thread_{[this, interval](std::function<void()> func) {
         Result result = WaitFor(interval);
@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const shutdownMainCpp = `#include "go.h"
+
+#include <atomic>
+#include <chrono>
+#include <exception>
+#include <iostream>
+#include <thread>
+
+int main() {
+  {
+    go2cpp_test::Go go;
+    go.Start();
+    std::atomic<int> ran{0};
+    for (int i = 0; i < 10; i++) {
+      go.EnqueueTask([&ran]() { ran++; });
+    }
+    std::thread([&go]() { go.Shutdown(); }).join();
+    while (!go.IsExited()) {
+      go.Poll();
+    }
+    std::cout << "start: ran: " << ran << ", shutdown: " << (go.ExitCode() == go2cpp_test::Go::kShutdownExitCode) << std::endl;
+  }
+  {
+    go2cpp_test::Go go;
+    std::thread t([&go]() {
+      // Wait for the program to start, as the Shutdown calls before Run are discarded.
+      for (;;) {
+        try {
+          go.CallFunction("increment").get();
+          break;
+        } catch (const std::exception&) {
+          std::this_thread::sleep_for(std::chrono::milliseconds(1));
+        }
+      }
+      go.Shutdown();
+    });
+    int code = go.Run();
+    t.join();
+    std::cout << "run: shutdown: " << (code == go2cpp_test::Go::kShutdownExitCode) << std::endl;
+  }
+  {
+    go2cpp_test::Go go;
+    go.Shutdown();
+    int code = go.Run(std::vector<std::string>{"test", "exit"});
+    std::cout << "shutdown before run: exit: " << code << std::endl;
+  }
+  return 0;
+}
+`
+
+const wakeupMainCpp = `#include "go.h"
+
+#include <atomic>
+#include <chrono>
+#include <iostream>
+#include <thread>
+
+#include <poll.h>
+
+int main() {
+  go2cpp_test::Go go;
+  go.Start(std::vector<std::string>{"test", "idle"});
+  int fd = go.WakeupFd();
+  std::atomic<int> wakeups{0};
+  go.SetWakeupCallback([&wakeups]() { wakeups++; });
+  for (int i = 0; i < 3; i++) {
+    go.EnqueueTask([]() { std::this_thread::sleep_for(std::chrono::milliseconds(10)); });
+  }
+  wakeups = 0;
+
+  // Each task takes longer than max_duration, so two tasks are left.
+  int n = go.RunPendingTasks(std::chrono::milliseconds(1));
+  struct pollfd pfd = {fd, POLLIN, 0};
+  std::cout << "tasks: " << n << ", readable: " << poll(&pfd, 1, 0) << ", wakeups: " << wakeups << std::endl;
+
+  wakeups = 0;
+  n = go.Poll();
+  pfd.revents = 0;
+  std::cout << "tasks: " << n << ", readable: " << poll(&pfd, 1, 0) << ", wakeups: " << wakeups << std::endl;
+
+  go.Shutdown();
+  while (!go.IsExited()) {
+    go.Poll();
+  }
+  return 0;
+}
+`
+
+const snapshotMainCpp = `#include "go.h"
+
+#include <iostream>
+
+int Increment(go2cpp_test::Go& go) {
+  return static_cast<int>(go.CallFunction("increment").get().ToNumber());
+}
+
+void Stop(go2cpp_test::Go& go) {
+  go.Shutdown();
+  while (!go.IsExited()) {
+    go.Poll();
+  }
+}
+
+int main() {
+  go2cpp_test::Go go;
+  go.Start(std::vector<std::string>{"test", "idle"});
+  Increment(go);
+  Increment(go);
+  std::vector<uint8_t> snapshot = go.Snapshot();
+  std::cout << "after snapshot: " << Increment(go) << std::endl;
+
+  go2cpp_test::Go restored;
+  restored.Restore(snapshot);
+  std::cout << "restored: " << Increment(restored) << std::endl;
+  std::cout << "restored: " << Increment(restored) << std::endl;
+  std::cout << "original: " << Increment(go) << std::endl;
+
+  Stop(restored);
+  Stop(go);
+  return 0;
+}
+`
+
+const callAfterExitMainCpp = `#include "go.h"
+
+#include <iostream>
+#include <stdexcept>
+#include <thread>
+
+void CallOnAnotherThread(go2cpp_test::Go& go, const std::string& name) {
+  std::thread([&go, &name]() {
+    try {
+      go.CallFunction("increment").get();
+      std::cout << name << ": no exception" << std::endl;
+    } catch (const std::runtime_error& e) {
+      std::cout << name << ": " << e.what() << std::endl;
+    }
+  }).join();
+}
+
+int main() {
+  {
+    go2cpp_test::Go go;
+    go.Run(std::vector<std::string>{"test", "exit"});
+    CallOnAnotherThread(go, "after exit");
+  }
+  {
+    go2cpp_test::Go go;
+    go.Start(std::vector<std::string>{"test", "idle"});
+    go.Shutdown();
+    CallOnAnotherThread(go, "after shutdown");
+    while (!go.IsExited()) {
+      go.Poll();
+    }
+    CallOnAnotherThread(go, "after release");
+  }
+  return 0;
+}
+`
+
+func TestTasks(t *testing.T) {
+	p := compileCppProgram(t, "./testdata/tasks", nil)
+	defer p.remove()
+
+	t.Run("Shutdown", func(t *testing.T) {
+		got := strings.TrimSpace(p.run(t, "shutdown", shutdownMainCpp))
+		want := strings.Join([]string{
+			"start: ran: 0, shutdown: 1",
+			"run: shutdown: 1",
+			"exit",
+			"shutdown before run: exit: 0",
+		}, "\n")
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+	t.Run("Wakeup", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("the wakeup file descriptor is not supported on Windows")
+		}
+		got := strings.TrimSpace(p.run(t, "wakeup", wakeupMainCpp))
+		want := strings.Join([]string{
+			"tasks: 1, readable: 1, wakeups: 1",
+			"tasks: 2, readable: 0, wakeups: 0",
+		}, "\n")
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+	t.Run("Snapshot", func(t *testing.T) {
+		got := strings.TrimSpace(p.run(t, "snapshot", snapshotMainCpp))
+		want := strings.Join([]string{
+			"after snapshot: 3",
+			"restored: 3",
+			"restored: 4",
+			"original: 4",
+		}, "\n")
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+	t.Run("CallAfterExit", func(t *testing.T) {
+		got := strings.TrimSpace(p.run(t, "callafterexit", callAfterExitMainCpp))
+		want := strings.Join([]string{
+			"exit",
+			"after exit: Go program has already exited",
+			"after shutdown: Go program has already exited",
+			"after release: Go program has already exited",
+		}, "\n")
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+}
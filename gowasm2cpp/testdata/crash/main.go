@@ -0,0 +1,21 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This program calls the host function crash from crashInGo when the host calls the function run.
+package main
+
+import (
+	"syscall/js"
+)
+
+//go:noinline
+func crashInGo() {
+	js.Global().Call("crash")
+}
+
+func main() {
+	js.Global().Set("run", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		crashInGo()
+		return nil
+	}))
+	select {}
+}
@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This program exports functions with //go:wasmexport and imports functions from the host with //go:wasmimport.
+// The host functions are called only by the export callHost.
+package main
+
+import (
+	"fmt"
+)
+
+//go:wasmimport env double
+func double(x int32) int32
+
+//go:wasmimport my.module add-one
+func addOne(x int32) int32
+
+//go:wasmexport add
+func add(a, b int32) int32 {
+	return a + b
+}
+
+//go:wasmexport callHost
+func callHost(x int32) int32 {
+	return addOne(double(x))
+}
+
+func main() {
+	fmt.Println("ready")
+	select {}
+}
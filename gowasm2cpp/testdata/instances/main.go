@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This program checks that its global object is not shared with the other programs running in the same process.
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall/js"
+	"time"
+)
+
+func main() {
+	name := js.Global().Get("name").String()
+	if name != os.Args[1] {
+		fmt.Printf("%s: name: got: %s, want: %s\n", os.Args[1], name, os.Args[1])
+		os.Exit(1)
+	}
+	for i := 0; i < 100; i++ {
+		js.Global().Set("counter", i)
+		time.Sleep(time.Millisecond)
+		if got := js.Global().Get("counter").Int(); got != i {
+			fmt.Printf("%s: counter: got: %d, want: %d\n", name, got, i)
+			os.Exit(1)
+		}
+	}
+	if _, err := os.Getwd(); err != nil {
+		fmt.Printf("%s: %v\n", name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: ok\n", name)
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This program prints the results of the system features that the host provides. The first argument selects the
+// feature: "env" prints the environment variables, "stat" prints the times of the file at the second argument, "fs"
+// operates files in a temporary directory, and "process" compares the process's IDs with the arguments pid, ppid, uid,
+// euid and groups, changes the directory, and calls the host function throwError.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"syscall/js"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("no mode")
+		os.Exit(1)
+	}
+	switch os.Args[1] {
+	case "env":
+		fmt.Printf("environ: %q\n", strings.Join(os.Environ(), ","))
+		fmt.Printf("FOO: %q\n", os.Getenv("FOO"))
+	case "stat":
+		fi, err := os.Stat(os.Args[2])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		st := fi.Sys().(*syscall.Stat_t)
+		fmt.Printf("atime: %d, mtime: %d, modtime: %d\n", st.Atime, st.Mtime, fi.ModTime().Unix())
+	case "fs":
+		if err := testFS(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "process":
+		if err := testProcess(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("unknown mode: %s\n", os.Args[1])
+		os.Exit(1)
+	}
+}
+
+func testFS() error {
+	dir, err := ioutil.TempDir("", "go2cpp-fs-")
+	if err != nil {
+		return err
+	}
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	c := filepath.Join(dir, "c.txt")
+	defer os.Remove(dir)
+	defer os.Remove(a)
+	defer os.Remove(b)
+	defer os.Remove(c)
+
+	f, err := os.Create(a)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte("hello")); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		return err
+	}
+	if err := f.Chown(os.Getuid(), os.Getgid()); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(a, 0640); err != nil {
+		return err
+	}
+	if err := os.Chown(a, os.Getuid(), os.Getgid()); err != nil {
+		return err
+	}
+	if err := os.Lchown(a, os.Getuid(), os.Getgid()); err != nil {
+		return err
+	}
+
+	if err := os.Link(a, b); err != nil {
+		return err
+	}
+	fmt.Printf("link again: exist: %t\n", os.IsExist(os.Link(a, b)))
+	content, err := ioutil.ReadFile(b)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(b)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("link: %q, mode: %v, nlink: %d\n", content, fi.Mode(), fi.Sys().(*syscall.Stat_t).Nlink)
+
+	if err := os.Symlink("a.txt", c); err != nil {
+		return err
+	}
+	target, err := os.Readlink(c)
+	if err != nil {
+		return err
+	}
+	_, err = os.Readlink(a)
+	fmt.Printf("symlink: %q, readlink on a file: %t\n", target, err != nil)
+	return nil
+}
+
+func testProcess(args []string) error {
+	groups, err := os.Getgroups()
+	if err != nil {
+		return err
+	}
+	var gs []string
+	for _, g := range groups {
+		gs = append(gs, strconv.Itoa(g))
+	}
+	ids := []string{
+		strconv.Itoa(os.Getpid()),
+		strconv.Itoa(os.Getppid()),
+		strconv.Itoa(os.Getuid()),
+		strconv.Itoa(os.Geteuid()),
+		strings.Join(gs, ","),
+	}
+	if got, want := strings.Join(ids, " "), strings.Join(args, " "); got != want {
+		fmt.Printf("ids: got: %q, want: %q\n", got, want)
+	} else {
+		fmt.Println("ids: ok")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "go2cpp-process-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dir)
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	newWd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("chdir: %t\n", filepath.Base(newWd) == filepath.Base(dir))
+	err = os.Chdir(filepath.Join(dir, "missing"))
+	fmt.Printf("chdir to a missing directory: not exist: %t\n", os.IsNotExist(err))
+	if err := os.Chdir(wd); err != nil {
+		return err
+	}
+
+	fmt.Printf("call: %s\n", catch(func() {
+		js.Global().Call("throwError")
+	}))
+	fmt.Printf("invoke: %s\n", catch(func() {
+		js.Global().Get("throwError").Invoke()
+	}))
+	return nil
+}
+
+// catch calls f and returns the JavaScript value thrown in f.
+func catch(f func()) (thrown string) {
+	defer func() {
+		if r := recover(); r != nil {
+			thrown = r.(js.Error).Value.String()
+		}
+	}()
+	f()
+	return "no exception"
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This program keeps running with a timer until the host stops it. With the argument "idle", the program runs
+// without a timer, and with "exit", the program exits immediately. The host can call the function increment, which
+// increments the counter and returns it.
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall/js"
+	"time"
+)
+
+func main() {
+	counter := 0
+	js.Global().Set("increment", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		counter++
+		return counter
+	}))
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "exit":
+			fmt.Println("exit")
+			return
+		case "idle":
+			select {}
+		}
+	}
+	go func() {
+		for {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	select {}
+}
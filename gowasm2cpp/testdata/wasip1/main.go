@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// This program is built with GOOS=wasip1 and prints the results of the WASI functions. The first argument selects
+// the feature: "args" prints the arguments, "env" prints the environment variable FOO, "exit" exits with the code at
+// the second argument, "fs" writes, reads and lists files in a temporary directory, and "getwd" prints the working
+// directory and lists the files there.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("no mode")
+		os.Exit(1)
+	}
+	switch os.Args[1] {
+	case "args":
+		fmt.Printf("args: %q\n", os.Args[2:])
+	case "env":
+		fmt.Printf("FOO: %q\n", os.Getenv("FOO"))
+	case "exit":
+		code, err := strconv.Atoi(os.Args[2])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(code)
+	case "fs":
+		if err := testFS(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "getwd":
+		wd, err := os.Getwd()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("wd: %s\n", wd)
+		entries, err := os.ReadDir(".")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, e := range entries {
+			fmt.Printf("entry: %s\n", e.Name())
+		}
+	default:
+		fmt.Printf("unknown mode: %s\n", os.Args[1])
+		os.Exit(1)
+	}
+}
+
+func testFS() error {
+	dir, err := ioutil.TempDir("", "go2cpp-wasip1-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"b.txt", "a.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("hello, "+name), 0644); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "c"), 0755); err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("read: %q\n", content)
+	_, err = os.Open(filepath.Join(dir, "missing"))
+	fmt.Printf("open a missing file: not exist: %t\n", os.IsNotExist(err))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		fmt.Printf("entry: %s, dir: %t\n", e.Name(), e.IsDir())
+	}
+	return nil
+}
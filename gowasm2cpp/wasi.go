@@ -0,0 +1,1342 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// wasiModuleName is the import module name of WASI preview1.
+const wasiModuleName = "wasi_snapshot_preview1"
+
+var wasiImportFuncBodies = map[string]string{
+	// args_get(argv: Pointer<Pointer<u8>>, argv_buf: Pointer<u8>) -> errno
+	"args_get": `  wasi_->StoreStrings(wasi_->args_, local0_, local1_);
+  return kErrnoSuccess;`,
+
+	// args_sizes_get() -> (size, size, errno)
+	"args_sizes_get": `  wasi_->StoreStringSizes(wasi_->args_, local0_, local1_);
+  return kErrnoSuccess;`,
+
+	// environ_get(environ: Pointer<Pointer<u8>>, environ_buf: Pointer<u8>) -> errno
+	"environ_get": `  wasi_->StoreStrings(wasi_->env_, local0_, local1_);
+  return kErrnoSuccess;`,
+
+	// environ_sizes_get() -> (size, size, errno)
+	"environ_sizes_get": `  wasi_->StoreStringSizes(wasi_->env_, local0_, local1_);
+  return kErrnoSuccess;`,
+
+	// clock_res_get(id: clockid) -> (timestamp, errno)
+	"clock_res_get": `  clockid_t id;
+  if (!ToClockId(local0_, &id)) {
+    return kErrnoInval;
+  }
+  struct timespec ts;
+  if (::clock_getres(id, &ts) != 0) {
+    return ToErrno(errno);
+  }
+  wasi_->mem_->StoreInt64(local1_, ToNanoseconds(ts));
+  return kErrnoSuccess;`,
+
+	// clock_time_get(id: clockid, precision: timestamp) -> (timestamp, errno)
+	"clock_time_get": `  clockid_t id;
+  if (!ToClockId(local0_, &id)) {
+    return kErrnoInval;
+  }
+  struct timespec ts;
+  if (::clock_gettime(id, &ts) != 0) {
+    return ToErrno(errno);
+  }
+  wasi_->mem_->StoreInt64(local2_, ToNanoseconds(ts));
+  return kErrnoSuccess;`,
+
+	// fd_advise(fd: fd, offset: filesize, len: filesize, advice: advice) -> errno
+	"fd_advise": `  // The advice is just ignored.
+  if (!wasi_->GetFile(local0_)) {
+    return kErrnoBadf;
+  }
+  return kErrnoSuccess;`,
+
+	// fd_allocate(fd: fd, offset: filesize, len: filesize) -> errno
+	"fd_allocate": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  struct stat st;
+  if (::fstat(file->host_fd, &st) != 0) {
+    return ToErrno(errno);
+  }
+  if (st.st_size < local1_ + local2_ && ::ftruncate(file->host_fd, local1_ + local2_) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// fd_close(fd: fd) -> errno
+	"fd_close": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  int32_t result = kErrnoSuccess;
+  if (file->host_fd > 2 && ::close(file->host_fd) != 0) {
+    result = ToErrno(errno);
+  }
+  wasi_->files_.erase(local0_);
+  return result;`,
+
+	// fd_datasync(fd: fd) -> errno
+	"fd_datasync": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  if (::fsync(file->host_fd) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// fd_fdstat_get(fd: fd) -> (fdstat, errno)
+	"fd_fdstat_get": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  wasi_->mem_->StoreInt64(local1_, 0);
+  wasi_->mem_->StoreInt8(local1_, file->filetype);
+  wasi_->mem_->StoreInt16(local1_ + 2, file->flags);
+  // The rights are not checked.
+  wasi_->mem_->StoreInt64(local1_ + 8, kAllRights);
+  wasi_->mem_->StoreInt64(local1_ + 16, kAllRights);
+  return kErrnoSuccess;`,
+
+	// fd_fdstat_set_flags(fd: fd, flags: fdflags) -> errno
+	"fd_fdstat_set_flags": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  // Only the append flag is applied to the host file. Especially, the standard I/O must not be non-blocking, as
+  // this affects the other processes sharing them. Blocking operations are valid for the module anyway.
+  if (file->host_fd > 2) {
+    int flags = ::fcntl(file->host_fd, F_GETFL);
+    if (flags < 0) {
+      return ToErrno(errno);
+    }
+    if (local1_ & kFdflagAppend) {
+      flags |= O_APPEND;
+    } else {
+      flags &= ~O_APPEND;
+    }
+    if (::fcntl(file->host_fd, F_SETFL, flags) != 0) {
+      return ToErrno(errno);
+    }
+  }
+  file->flags = static_cast<uint16_t>(local1_);
+  return kErrnoSuccess;`,
+
+	// fd_fdstat_set_rights(fd: fd, fs_rights_base: rights, fs_rights_inheriting: rights) -> errno
+	"fd_fdstat_set_rights": `  // The rights are not checked.
+  if (!wasi_->GetFile(local0_)) {
+    return kErrnoBadf;
+  }
+  return kErrnoSuccess;`,
+
+	// fd_filestat_get(fd: fd) -> (filestat, errno)
+	"fd_filestat_get": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  struct stat st;
+  if (::fstat(file->host_fd, &st) != 0) {
+    return ToErrno(errno);
+  }
+  wasi_->StoreFilestat(local1_, st);
+  return kErrnoSuccess;`,
+
+	// fd_filestat_set_size(fd: fd, size: filesize) -> errno
+	"fd_filestat_set_size": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  if (::ftruncate(file->host_fd, local1_) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// fd_filestat_set_times(fd: fd, atim: timestamp, mtim: timestamp, fst_flags: fstflags) -> errno
+	"fd_filestat_set_times": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  struct timespec times[2];
+  ToUtimeTimespecs(local1_, local2_, local3_, times);
+  if (::futimens(file->host_fd, times) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// fd_pread(fd: fd, iovs: iovec_array, offset: filesize) -> (size, errno)
+	"fd_pread": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  int64_t total = 0;
+  for (const struct iovec& iov : wasi_->LoadIOVecs(local1_, local2_)) {
+    ssize_t n = ::pread(file->host_fd, iov.iov_base, iov.iov_len, local3_ + total);
+    if (n < 0) {
+      if (total == 0) {
+        return ToErrno(errno);
+      }
+      break;
+    }
+    total += n;
+    if (static_cast<size_t>(n) < iov.iov_len) {
+      break;
+    }
+  }
+  wasi_->mem_->StoreInt32(local4_, static_cast<int32_t>(total));
+  return kErrnoSuccess;`,
+
+	// fd_prestat_get(fd: fd) -> (prestat, errno)
+	"fd_prestat_get": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file || file->preopen.empty()) {
+    return kErrnoBadf;
+  }
+  wasi_->mem_->StoreInt32(local1_, 0);
+  wasi_->mem_->StoreInt8(local1_, kPreopentypeDir);
+  wasi_->mem_->StoreInt32(local1_ + 4, static_cast<int32_t>(file->preopen.size()));
+  return kErrnoSuccess;`,
+
+	// fd_prestat_dir_name(fd: fd, path: Pointer<u8>, path_len: size) -> errno
+	"fd_prestat_dir_name": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file || file->preopen.empty()) {
+    return kErrnoBadf;
+  }
+  wasi_->StoreString(local1_, file->preopen.substr(0, local2_));
+  return kErrnoSuccess;`,
+
+	// fd_pwrite(fd: fd, iovs: ciovec_array, offset: filesize) -> (size, errno)
+	"fd_pwrite": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  int64_t total = 0;
+  for (const struct iovec& iov : wasi_->LoadIOVecs(local1_, local2_)) {
+    ssize_t n = ::pwrite(file->host_fd, iov.iov_base, iov.iov_len, local3_ + total);
+    if (n < 0) {
+      if (total == 0) {
+        return ToErrno(errno);
+      }
+      break;
+    }
+    total += n;
+    if (static_cast<size_t>(n) < iov.iov_len) {
+      break;
+    }
+  }
+  wasi_->mem_->StoreInt32(local4_, static_cast<int32_t>(total));
+  return kErrnoSuccess;`,
+
+	// fd_read(fd: fd, iovs: iovec_array) -> (size, errno)
+	"fd_read": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  std::vector<struct iovec> iovs = wasi_->LoadIOVecs(local1_, local2_);
+  ssize_t n = ::readv(file->host_fd, iovs.data(), static_cast<int>(iovs.size()));
+  if (n < 0) {
+    return ToErrno(errno);
+  }
+  wasi_->mem_->StoreInt32(local3_, static_cast<int32_t>(n));
+  return kErrnoSuccess;`,
+
+	// fd_readdir(fd: fd, buf: Pointer<u8>, buf_len: size, cookie: dircookie) -> (size, errno)
+	"fd_readdir": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  // The directory stream is opened for each call, and the cookie is the index of the next entry.
+  int fd = ::dup(file->host_fd);
+  if (fd < 0) {
+    return ToErrno(errno);
+  }
+  DIR* dir = ::fdopendir(fd);
+  if (!dir) {
+    int err = errno;
+    ::close(fd);
+    return ToErrno(err);
+  }
+  ::rewinddir(dir);
+
+  int32_t used = 0;
+  int64_t index = 0;
+  while (used < local2_) {
+    struct dirent* ent = ::readdir(dir);
+    if (!ent) {
+      break;
+    }
+    index++;
+    if (index <= local3_) {
+      continue;
+    }
+
+    // dirent: d_next (u64), d_ino (u64), d_namlen (u32), d_type (u8) and the name.
+    std::string name = ent->d_name;
+    std::string entry(24, '\0');
+    uint64_t next = static_cast<uint64_t>(index);
+    uint64_t ino = static_cast<uint64_t>(ent->d_ino);
+    uint32_t namlen = static_cast<uint32_t>(name.size());
+    std::memcpy(&entry[0], &next, sizeof(next));
+    std::memcpy(&entry[8], &ino, sizeof(ino));
+    std::memcpy(&entry[16], &namlen, sizeof(namlen));
+    entry[20] = static_cast<char>(ToFiletypeFromDirent(ent->d_type));
+    entry += name;
+
+    // The last entry might be truncated. This tells the module that the buffer is full.
+    entry = entry.substr(0, local2_ - used);
+    wasi_->StoreString(local1_ + used, entry);
+    used += static_cast<int32_t>(entry.size());
+  }
+  ::closedir(dir);
+  wasi_->mem_->StoreInt32(local4_, used);
+  return kErrnoSuccess;`,
+
+	// fd_renumber(fd: fd, to: fd) -> errno
+	"fd_renumber": `  WASI::File* from = wasi_->GetFile(local0_);
+  WASI::File* to = wasi_->GetFile(local1_);
+  if (!from || !to) {
+    return kErrnoBadf;
+  }
+  if (local0_ == local1_) {
+    return kErrnoSuccess;
+  }
+  if (to->host_fd > 2) {
+    ::close(to->host_fd);
+  }
+  wasi_->files_[local1_] = *from;
+  wasi_->files_.erase(local0_);
+  return kErrnoSuccess;`,
+
+	// fd_seek(fd: fd, offset: filedelta, whence: whence) -> (filesize, errno)
+	"fd_seek": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  int whence = 0;
+  switch (local2_) {
+  case kWhenceSet:
+    whence = SEEK_SET;
+    break;
+  case kWhenceCur:
+    whence = SEEK_CUR;
+    break;
+  case kWhenceEnd:
+    whence = SEEK_END;
+    break;
+  default:
+    return kErrnoInval;
+  }
+  off_t offset = ::lseek(file->host_fd, local1_, whence);
+  if (offset < 0) {
+    return ToErrno(errno);
+  }
+  wasi_->mem_->StoreInt64(local3_, offset);
+  return kErrnoSuccess;`,
+
+	// fd_sync(fd: fd) -> errno
+	"fd_sync": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  if (::fsync(file->host_fd) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// fd_tell(fd: fd) -> (filesize, errno)
+	"fd_tell": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  off_t offset = ::lseek(file->host_fd, 0, SEEK_CUR);
+  if (offset < 0) {
+    return ToErrno(errno);
+  }
+  wasi_->mem_->StoreInt64(local1_, offset);
+  return kErrnoSuccess;`,
+
+	// fd_write(fd: fd, iovs: ciovec_array) -> (size, errno)
+	"fd_write": `  WASI::File* file = wasi_->GetFile(local0_);
+  if (!file) {
+    return kErrnoBadf;
+  }
+  std::vector<struct iovec> iovs = wasi_->LoadIOVecs(local1_, local2_);
+  ssize_t n = ::writev(file->host_fd, iovs.data(), static_cast<int>(iovs.size()));
+  if (n < 0) {
+    return ToErrno(errno);
+  }
+  wasi_->mem_->StoreInt32(local3_, static_cast<int32_t>(n));
+  return kErrnoSuccess;`,
+
+	// path_create_directory(fd: fd, path: string) -> errno
+	"path_create_directory": `  WASI::File* dir = wasi_->GetFile(local0_);
+  if (!dir) {
+    return kErrnoBadf;
+  }
+  if (::mkdirat(dir->host_fd, wasi_->LoadString(local1_, local2_).c_str(), 0777) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// path_filestat_get(fd: fd, flags: lookupflags, path: string) -> (filestat, errno)
+	"path_filestat_get": `  WASI::File* dir = wasi_->GetFile(local0_);
+  if (!dir) {
+    return kErrnoBadf;
+  }
+  int flags = (local1_ & kLookupflagSymlinkFollow) ? 0 : AT_SYMLINK_NOFOLLOW;
+  struct stat st;
+  if (::fstatat(dir->host_fd, wasi_->LoadString(local2_, local3_).c_str(), &st, flags) != 0) {
+    return ToErrno(errno);
+  }
+  wasi_->StoreFilestat(local4_, st);
+  return kErrnoSuccess;`,
+
+	// path_filestat_set_times(fd: fd, flags: lookupflags, path: string, atim: timestamp, mtim: timestamp, fst_flags: fstflags) -> errno
+	"path_filestat_set_times": `  WASI::File* dir = wasi_->GetFile(local0_);
+  if (!dir) {
+    return kErrnoBadf;
+  }
+  int flags = (local1_ & kLookupflagSymlinkFollow) ? 0 : AT_SYMLINK_NOFOLLOW;
+  struct timespec times[2];
+  ToUtimeTimespecs(local4_, local5_, local6_, times);
+  if (::utimensat(dir->host_fd, wasi_->LoadString(local2_, local3_).c_str(), times, flags) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// path_link(old_fd: fd, old_flags: lookupflags, old_path: string, new_fd: fd, new_path: string) -> errno
+	"path_link": `  WASI::File* old_dir = wasi_->GetFile(local0_);
+  WASI::File* new_dir = wasi_->GetFile(local4_);
+  if (!old_dir || !new_dir) {
+    return kErrnoBadf;
+  }
+  int flags = (local1_ & kLookupflagSymlinkFollow) ? AT_SYMLINK_FOLLOW : 0;
+  if (::linkat(old_dir->host_fd, wasi_->LoadString(local2_, local3_).c_str(),
+               new_dir->host_fd, wasi_->LoadString(local5_, local6_).c_str(), flags) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// path_open(fd: fd, dirflags: lookupflags, path: string, oflags: oflags, fs_rights_base: rights, fs_rights_inheriting: rights, fdflags: fdflags) -> (fd, errno)
+	"path_open": `  WASI::File* dir = wasi_->GetFile(local0_);
+  if (!dir) {
+    return kErrnoBadf;
+  }
+
+  // The access mode is determined by the requested rights.
+  bool read = (local5_ & (kRightFdRead | kRightFdReaddir)) != 0;
+  bool write = (local5_ & kRightFdWrite) != 0;
+  int flags = O_CLOEXEC;
+  if (read && write) {
+    flags |= O_RDWR;
+  } else if (write) {
+    flags |= O_WRONLY;
+  } else {
+    flags |= O_RDONLY;
+  }
+  if (local4_ & kOflagCreat) {
+    flags |= O_CREAT;
+  }
+  if (local4_ & kOflagDirectory) {
+    flags |= O_DIRECTORY;
+  }
+  if (local4_ & kOflagExcl) {
+    flags |= O_EXCL;
+  }
+  if (local4_ & kOflagTrunc) {
+    flags |= O_TRUNC;
+  }
+  if (local7_ & kFdflagAppend) {
+    flags |= O_APPEND;
+  }
+  if (local7_ & kFdflagDsync) {
+    flags |= O_DSYNC;
+  }
+  if (local7_ & kFdflagSync) {
+    flags |= O_SYNC;
+  }
+  if (!(local1_ & kLookupflagSymlinkFollow)) {
+    flags |= O_NOFOLLOW;
+  }
+
+  int fd = ::openat(dir->host_fd, wasi_->LoadString(local2_, local3_).c_str(), flags, 0666);
+  if (fd < 0) {
+    return ToErrno(errno);
+  }
+  struct stat st;
+  if (::fstat(fd, &st) != 0) {
+    int err = errno;
+    ::close(fd);
+    return ToErrno(err);
+  }
+  WASI::File file;
+  file.host_fd = fd;
+  file.filetype = ToFiletype(st.st_mode);
+  file.flags = static_cast<uint16_t>(local7_);
+  wasi_->mem_->StoreInt32(local8_, wasi_->AddFile(file));
+  return kErrnoSuccess;`,
+
+	// path_readlink(fd: fd, path: string, buf: Pointer<u8>, buf_len: size) -> (size, errno)
+	"path_readlink": `  WASI::File* dir = wasi_->GetFile(local0_);
+  if (!dir) {
+    return kErrnoBadf;
+  }
+  std::vector<char> buf(local4_);
+  ssize_t n = ::readlinkat(dir->host_fd, wasi_->LoadString(local1_, local2_).c_str(), buf.data(), buf.size());
+  if (n < 0) {
+    return ToErrno(errno);
+  }
+  wasi_->StoreString(local3_, std::string(buf.data(), n));
+  wasi_->mem_->StoreInt32(local5_, static_cast<int32_t>(n));
+  return kErrnoSuccess;`,
+
+	// path_remove_directory(fd: fd, path: string) -> errno
+	"path_remove_directory": `  WASI::File* dir = wasi_->GetFile(local0_);
+  if (!dir) {
+    return kErrnoBadf;
+  }
+  if (::unlinkat(dir->host_fd, wasi_->LoadString(local1_, local2_).c_str(), AT_REMOVEDIR) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// path_rename(fd: fd, old_path: string, new_fd: fd, new_path: string) -> errno
+	"path_rename": `  WASI::File* old_dir = wasi_->GetFile(local0_);
+  WASI::File* new_dir = wasi_->GetFile(local3_);
+  if (!old_dir || !new_dir) {
+    return kErrnoBadf;
+  }
+  if (::renameat(old_dir->host_fd, wasi_->LoadString(local1_, local2_).c_str(),
+                 new_dir->host_fd, wasi_->LoadString(local4_, local5_).c_str()) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// path_symlink(old_path: string, fd: fd, new_path: string) -> errno
+	"path_symlink": `  WASI::File* dir = wasi_->GetFile(local2_);
+  if (!dir) {
+    return kErrnoBadf;
+  }
+  if (::symlinkat(wasi_->LoadString(local0_, local1_).c_str(), dir->host_fd, wasi_->LoadString(local3_, local4_).c_str()) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// path_unlink_file(fd: fd, path: string) -> errno
+	"path_unlink_file": `  WASI::File* dir = wasi_->GetFile(local0_);
+  if (!dir) {
+    return kErrnoBadf;
+  }
+  if (::unlinkat(dir->host_fd, wasi_->LoadString(local1_, local2_).c_str(), 0) != 0) {
+    return ToErrno(errno);
+  }
+  return kErrnoSuccess;`,
+
+	// poll_oneoff(in: ConstPointer<subscription>, out: Pointer<event>, nsubscriptions: size) -> (size, errno)
+	"poll_oneoff": `  if (local2_ <= 0) {
+    return kErrnoInval;
+  }
+  return wasi_->PollOneoff(local0_, local1_, local2_, local3_);`,
+
+	// proc_exit(rval: exitcode)
+	"proc_exit": `  throw WASI::ProcExit{local0_};`,
+
+	// proc_raise(sig: signal) -> errno
+	"proc_raise": `  return kErrnoNosys;`,
+
+	// random_get(buf: Pointer<u8>, buf_len: size) -> errno
+	"random_get": `  std::uniform_int_distribution<int> dist(0, 255);
+  BytesSpan bytes = wasi_->mem_->LoadSliceDirectly(local0_, local1_);
+  for (int32_t i = 0; i < local1_; i++) {
+    bytes[i] = static_cast<uint8_t>(dist(wasi_->random_device_));
+  }
+  return kErrnoSuccess;`,
+
+	// sched_yield() -> errno
+	"sched_yield": `  std::this_thread::yield();
+  return kErrnoSuccess;`,
+
+	// sock_accept(fd: fd, flags: fdflags) -> (fd, errno)
+	"sock_accept": `  return kErrnoNosys;`,
+
+	// sock_recv(fd: fd, ri_data: iovec_array, ri_flags: riflags) -> (size, roflags, errno)
+	"sock_recv": `  return kErrnoNosys;`,
+
+	// sock_send(fd: fd, si_data: ciovec_array, si_flags: siflags) -> (size, errno)
+	"sock_send": `  return kErrnoNosys;`,
+
+	// sock_shutdown(fd: fd, how: sdflags) -> errno
+	"sock_shutdown": `  return kErrnoNosys;`,
+}
+
+// wasiStartExport returns the export to call at the beginning: _start for commands and _initialize for reactors.
+func wasiStartExport(exports []*wasmExport) string {
+	var name string
+	for _, e := range exports {
+		switch e.Name {
+		case "_start":
+			return e.Name
+		case "_initialize":
+			name = e.Name
+		}
+	}
+	return name
+}
+
+func writeWASI(dir string, incpath string, namespace string, importFuncs []*wasmFunc, exports []*wasmExport, goWASIP1 bool, crashHandler bool) error {
+	{
+		f, err := os.Create(filepath.Join(dir, "wasi.h"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err := wasiHTmpl.Execute(f, struct {
+			IncludeGuard string
+			IncludePath  string
+			Namespace    string
+			ImportFuncs  []*wasmFunc
+		}{
+			IncludeGuard: includeGuard(namespace) + "_WASI_H",
+			IncludePath:  incpath,
+			Namespace:    namespace,
+			ImportFuncs:  importFuncs,
+		}); err != nil {
+			return err
+		}
+	}
+	{
+		f, err := os.Create(filepath.Join(dir, "wasi.cpp"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err := wasiCppTmpl.Execute(f, struct {
+			IncludePath  string
+			Namespace    string
+			ImportFuncs  []*wasmFunc
+			Start        string
+			GoWASIP1     bool
+			CrashHandler bool
+		}{
+			IncludePath:  incpath,
+			Namespace:    namespace,
+			ImportFuncs:  importFuncs,
+			Start:        wasiStartExport(exports),
+			GoWASIP1:     goWASIP1,
+			CrashHandler: crashHandler,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var wasiHTmpl = template.Must(template.New("wasi.h").Parse(`// Code generated by go2cpp. DO NOT EDIT.
+
+#ifndef {{.IncludeGuard}}
+#define {{.IncludeGuard}}
+
+#include "{{.IncludePath}}host.h"
+#include "{{.IncludePath}}inst.h"
+#include "{{.IncludePath}}mem.h"
+
+#include <sys/stat.h>
+#include <sys/uio.h>
+
+#include <cstdint>
+#include <map>
+#include <memory>
+#include <random>
+#include <string>
+#include <utility>
+#include <vector>
+
+namespace {{.Namespace}} {
+
+// WASI runs a module that imports the WASI preview1 functions (wasi_snapshot_preview1).
+//
+// The files are the host's files. The paths are resolved by the host relative to the preopened directories and the
+// rights are not checked, so the module can access any files that the process can access.
+class WASI {
+public:
+  WASI();
+
+  // The host must outlive the WASI.
+  explicit WASI(IHost* host);
+
+  ~WASI();
+
+  // Preopen makes the host directory available to the module as guest_path.
+  // If Preopen is never called, the host root directory is preopened as /.
+  void Preopen(const std::string& guest_path, const std::string& host_path);
+
+  // Run runs the module and returns the exit code.
+  int Run();
+  int Run(int argc, char** argv);
+  int Run(const std::vector<std::string>& args);
+  int Run(const std::vector<std::string>& args, const std::vector<std::string>& env);
+
+private:
+  class Import : public IImport {
+  public:
+    explicit Import(WASI* wasi);
+
+{{range $value := .ImportFuncs}}{{$value.CppDecl "    " false true}}
+
+{{end}}  private:
+    WASI* wasi_;
+  };
+
+  struct File {
+    int host_fd = -1;
+    uint8_t filetype = 0;
+    uint16_t flags = 0;
+
+    // preopen is the guest path of a preopened directory, or empty.
+    std::string preopen;
+  };
+
+  // ProcExit is thrown at proc_exit to unwind the module's stack.
+  struct ProcExit {
+    int32_t code;
+  };
+
+  WASI(const WASI&) = delete;
+  WASI& operator=(const WASI&) = delete;
+
+  File* GetFile(int32_t fd);
+  int32_t AddFile(const File& file);
+  void CloseFiles();
+
+  std::string LoadString(int32_t ptr, int32_t len) const;
+  void StoreString(int32_t ptr, const std::string& str);
+  void StoreStrings(const std::vector<std::string>& strs, int32_t ptrs, int32_t buf);
+  void StoreStringSizes(const std::vector<std::string>& strs, int32_t num_ptr, int32_t size_ptr);
+  std::vector<struct iovec> LoadIOVecs(int32_t iovs, int32_t len);
+  void StoreFilestat(int32_t ptr, const struct stat& st);
+  int32_t PollOneoff(int32_t in, int32_t out, int32_t nsubscriptions, int32_t nevents_ptr);
+  IHost* Host();
+
+  Import import_;
+  IHost* host_ = nullptr;
+  std::unique_ptr<Inst> inst_;
+  std::unique_ptr<Mem> mem_;
+  std::vector<std::string> args_;
+  std::vector<std::string> env_;
+  std::vector<std::pair<std::string, std::string>> preopens_;
+  std::map<int32_t, File> files_;
+  // TODO: Use cryptographically strong random values instead of std::random_device.
+  std::random_device random_device_;
+};
+
+// Main runs the module with the process's arguments and environment variables, and returns the exit code.
+// Main can be used as the main function:
+//
+//   int main(int argc, char** argv) {
+//     return {{.Namespace}}::Main(argc, argv);
+//   }
+int Main(int argc, char** argv);
+
+}
+
+#endif  // {{.IncludeGuard}}
+`))
+
+var wasiCppTmpl = template.Must(template.New("wasi.cpp").Parse(`// Code generated by go2cpp. DO NOT EDIT.
+
+#include "{{.IncludePath}}wasi.h"
+{{if .CrashHandler}}
+#include "{{.IncludePath}}crash.h"
+{{end}}
+#include <dirent.h>
+#include <fcntl.h>
+#include <poll.h>
+#include <time.h>
+#include <unistd.h>
+
+#include <algorithm>
+#include <cerrno>
+#include <chrono>
+#include <climits>
+#include <cstdlib>
+#include <cstring>
+#include <iostream>
+#include <random>
+#include <thread>
+
+extern char** environ;
+
+namespace {{.Namespace}} {
+
+namespace {
+
+constexpr int32_t kErrnoSuccess = 0;
+constexpr int32_t kErrnoBadf = 8;
+constexpr int32_t kErrnoInval = 28;
+constexpr int32_t kErrnoIo = 29;
+constexpr int32_t kErrnoNosys = 52;
+
+constexpr uint8_t kFiletypeUnknown = 0;
+constexpr uint8_t kFiletypeBlockDevice = 1;
+constexpr uint8_t kFiletypeCharacterDevice = 2;
+constexpr uint8_t kFiletypeDirectory = 3;
+constexpr uint8_t kFiletypeRegularFile = 4;
+constexpr uint8_t kFiletypeSocketStream = 6;
+constexpr uint8_t kFiletypeSymbolicLink = 7;
+
+constexpr int32_t kFdflagAppend = 1 << 0;
+constexpr int32_t kFdflagDsync = 1 << 1;
+constexpr int32_t kFdflagSync = 1 << 4;
+
+constexpr int32_t kOflagCreat = 1 << 0;
+constexpr int32_t kOflagDirectory = 1 << 1;
+constexpr int32_t kOflagExcl = 1 << 2;
+constexpr int32_t kOflagTrunc = 1 << 3;
+
+constexpr int32_t kLookupflagSymlinkFollow = 1 << 0;
+
+constexpr int64_t kRightFdRead = 1 << 1;
+constexpr int64_t kRightFdWrite = 1 << 6;
+constexpr int64_t kRightFdReaddir = 1 << 14;
+// Some modules don't accept the upper 32 bits.
+constexpr int64_t kAllRights = (1 << 29) - 1;
+
+constexpr int32_t kFstflagAtim = 1 << 0;
+constexpr int32_t kFstflagAtimNow = 1 << 1;
+constexpr int32_t kFstflagMtim = 1 << 2;
+constexpr int32_t kFstflagMtimNow = 1 << 3;
+
+constexpr int32_t kWhenceSet = 0;
+constexpr int32_t kWhenceCur = 1;
+constexpr int32_t kWhenceEnd = 2;
+
+constexpr uint8_t kPreopentypeDir = 0;
+
+constexpr uint8_t kEventtypeClock = 0;
+constexpr uint8_t kEventtypeFdRead = 1;
+constexpr uint8_t kEventtypeFdWrite = 2;
+
+constexpr uint16_t kSubclockflagAbstime = 1 << 0;
+constexpr uint16_t kEventrwflagFdReadwriteHangup = 1 << 0;
+
+int32_t ToErrno(int err) {
+  switch (err) {
+  case E2BIG:
+    return 1;
+  case EACCES:
+    return 2;
+  case EADDRINUSE:
+    return 3;
+  case EADDRNOTAVAIL:
+    return 4;
+  case EAFNOSUPPORT:
+    return 5;
+  case EAGAIN:
+    return 6;
+  case EALREADY:
+    return 7;
+  case EBADF:
+    return 8;
+  case EBUSY:
+    return 10;
+  case ECANCELED:
+    return 11;
+  case ECHILD:
+    return 12;
+  case ECONNABORTED:
+    return 13;
+  case ECONNREFUSED:
+    return 14;
+  case ECONNRESET:
+    return 15;
+  case EDEADLK:
+    return 16;
+  case EDQUOT:
+    return 19;
+  case EEXIST:
+    return 20;
+  case EFAULT:
+    return 21;
+  case EFBIG:
+    return 22;
+  case EINTR:
+    return 27;
+  case EINVAL:
+    return 28;
+  case EIO:
+    return 29;
+  case EISDIR:
+    return 31;
+  case ELOOP:
+    return 32;
+  case EMFILE:
+    return 33;
+  case EMLINK:
+    return 34;
+  case ENAMETOOLONG:
+    return 37;
+  case ENFILE:
+    return 41;
+  case ENODEV:
+    return 43;
+  case ENOENT:
+    return 44;
+  case ENOMEM:
+    return 48;
+  case ENOSPC:
+    return 51;
+  case ENOSYS:
+    return 52;
+  case ENOTDIR:
+    return 54;
+  case ENOTEMPTY:
+    return 55;
+  case ENOTSUP:
+    return 58;
+  case ENOTTY:
+    return 59;
+  case ENXIO:
+    return 60;
+  case EOVERFLOW:
+    return 61;
+  case EPERM:
+    return 63;
+  case EPIPE:
+    return 64;
+  case ERANGE:
+    return 68;
+  case EROFS:
+    return 69;
+  case ESPIPE:
+    return 70;
+  case ETIMEDOUT:
+    return 73;
+  case ETXTBSY:
+    return 74;
+  case EXDEV:
+    return 75;
+  default:
+    return kErrnoIo;
+  }
+}
+
+uint8_t ToFiletype(mode_t mode) {
+  switch (mode & S_IFMT) {
+  case S_IFBLK:
+    return kFiletypeBlockDevice;
+  case S_IFCHR:
+    return kFiletypeCharacterDevice;
+  case S_IFDIR:
+    return kFiletypeDirectory;
+  case S_IFREG:
+    return kFiletypeRegularFile;
+  case S_IFSOCK:
+    return kFiletypeSocketStream;
+  case S_IFLNK:
+    return kFiletypeSymbolicLink;
+  default:
+    return kFiletypeUnknown;
+  }
+}
+
+// Helper functions used only by some import bodies are inline not to be warned as unused.
+inline uint8_t ToFiletypeFromDirent(unsigned char type) {
+  switch (type) {
+  case DT_BLK:
+    return kFiletypeBlockDevice;
+  case DT_CHR:
+    return kFiletypeCharacterDevice;
+  case DT_DIR:
+    return kFiletypeDirectory;
+  case DT_REG:
+    return kFiletypeRegularFile;
+  case DT_SOCK:
+    return kFiletypeSocketStream;
+  case DT_LNK:
+    return kFiletypeSymbolicLink;
+  default:
+    return kFiletypeUnknown;
+  }
+}
+
+bool ToClockId(int32_t id, clockid_t* result) {
+  switch (id) {
+  case 0:
+    *result = CLOCK_REALTIME;
+    return true;
+  case 1:
+    *result = CLOCK_MONOTONIC;
+    return true;
+  case 2:
+    *result = CLOCK_PROCESS_CPUTIME_ID;
+    return true;
+  case 3:
+    *result = CLOCK_THREAD_CPUTIME_ID;
+    return true;
+  default:
+    return false;
+  }
+}
+
+int64_t ToNanoseconds(const struct timespec& ts) {
+  return static_cast<int64_t>(ts.tv_sec) * 1000000000 + ts.tv_nsec;
+}
+
+struct timespec ToTimespec(int64_t ns) {
+  struct timespec ts;
+  ts.tv_sec = static_cast<time_t>(ns / 1000000000);
+  ts.tv_nsec = static_cast<long>(ns % 1000000000);
+  return ts;
+}
+
+inline void ToUtimeTimespecs(int64_t atim, int64_t mtim, int32_t fst_flags, struct timespec* times) {
+  times[0].tv_sec = 0;
+  times[0].tv_nsec = UTIME_OMIT;
+  if (fst_flags & kFstflagAtimNow) {
+    times[0].tv_nsec = UTIME_NOW;
+  } else if (fst_flags & kFstflagAtim) {
+    times[0] = ToTimespec(atim);
+  }
+  times[1].tv_sec = 0;
+  times[1].tv_nsec = UTIME_OMIT;
+  if (fst_flags & kFstflagMtimNow) {
+    times[1].tv_nsec = UTIME_NOW;
+  } else if (fst_flags & kFstflagMtim) {
+    times[1] = ToTimespec(mtim);
+  }
+}
+
+int64_t MonotonicNowInNanoseconds() {
+  return std::chrono::duration_cast<std::chrono::nanoseconds>(
+      std::chrono::steady_clock::now().time_since_epoch()).count();
+}
+
+}
+
+WASI::WASI()
+    : WASI{nullptr} {
+}
+
+WASI::WASI(IHost* host)
+    : import_{this},
+      host_{host} {
+}
+
+WASI::~WASI() {
+  CloseFiles();
+}
+
+void WASI::Preopen(const std::string& guest_path, const std::string& host_path) {
+  preopens_.push_back(std::make_pair(guest_path, host_path));
+}
+
+int WASI::Run() {
+  return Run(std::vector<std::string>{}, std::vector<std::string>{});
+}
+
+int WASI::Run(int argc, char** argv) {
+  std::vector<std::string> args(argv, argv + argc);
+  return Run(args, std::vector<std::string>{});
+}
+
+int WASI::Run(const std::vector<std::string>& args) {
+  return Run(args, std::vector<std::string>{});
+}
+
+int WASI::Run(const std::vector<std::string>& args, const std::vector<std::string>& env) {
+  CloseFiles();
+  args_ = args;
+  env_ = env;
+
+  for (int fd = 0; fd <= 2; fd++) {
+    File file;
+    file.host_fd = fd;
+    struct stat st;
+    file.filetype = ::fstat(fd, &st) == 0 ? ToFiletype(st.st_mode) : kFiletypeCharacterDevice;
+    files_[fd] = file;
+  }
+
+  std::vector<std::pair<std::string, std::string>> preopens = preopens_;
+  if (preopens.empty()) {
+    preopens.push_back(std::make_pair("/", "/"));
+  }
+  for (auto& p : preopens) {
+    int fd = ::open(p.second.c_str(), O_RDONLY | O_DIRECTORY | O_CLOEXEC);
+    if (fd < 0) {
+      std::cerr << "WASI: opening " << p.second << " failed: " << std::strerror(errno) << std::endl;
+      continue;
+    }
+    File file;
+    file.host_fd = fd;
+    file.filetype = kFiletypeDirectory;
+    file.preopen = p.first;
+    AddFile(file);
+  }
+
+  mem_ = std::make_unique<Mem>();
+  inst_ = std::make_unique<Inst>(mem_.get(), &import_);
+  if (host_) {
+    host_->mem_ = mem_.get();
+  }
+
+{{if .CrashHandler}}  InstallCrashHandler(inst_.get(), mem_.get());
+
+{{end}}  int32_t code = 0;
+  try {
+{{if .CrashHandler}}    CrashHandlerScope crash_handler_scope{inst_.get(), mem_.get()};
+{{end}}{{if .Start}}    inst_->{{.Start}}();
+{{end}}  } catch (const ProcExit& e) {
+    code = e.code;
+  }
+{{if .CrashHandler}}
+  UninstallCrashHandler(inst_.get());
+{{end}}
+  CloseFiles();
+  return static_cast<int>(code);
+}
+
+WASI::File* WASI::GetFile(int32_t fd) {
+  auto it = files_.find(fd);
+  if (it == files_.end()) {
+    return nullptr;
+  }
+  return &it->second;
+}
+
+int32_t WASI::AddFile(const File& file) {
+  int32_t fd = 3;
+  while (files_.find(fd) != files_.end()) {
+    fd++;
+  }
+  files_[fd] = file;
+  return fd;
+}
+
+void WASI::CloseFiles() {
+  for (auto& f : files_) {
+    if (f.second.host_fd > 2) {
+      ::close(f.second.host_fd);
+    }
+  }
+  files_.clear();
+}
+
+std::string WASI::LoadString(int32_t ptr, int32_t len) const {
+  BytesSpan bytes = mem_->LoadSliceDirectly(ptr, len);
+  return std::string(bytes.begin(), bytes.end());
+}
+
+void WASI::StoreString(int32_t ptr, const std::string& str) {
+  BytesSpan bytes = mem_->LoadSliceDirectly(ptr, static_cast<int32_t>(str.size()));
+  std::copy(str.begin(), str.end(), bytes.begin());
+}
+
+void WASI::StoreStrings(const std::vector<std::string>& strs, int32_t ptrs, int32_t buf) {
+  for (const std::string& str : strs) {
+    mem_->StoreInt32(ptrs, buf);
+    ptrs += 4;
+    StoreString(buf, str);
+    mem_->StoreInt8(buf + str.size(), 0);
+    buf += str.size() + 1;
+  }
+}
+
+void WASI::StoreStringSizes(const std::vector<std::string>& strs, int32_t num_ptr, int32_t size_ptr) {
+  int32_t size = 0;
+  for (const std::string& str : strs) {
+    size += str.size() + 1;
+  }
+  mem_->StoreInt32(num_ptr, static_cast<int32_t>(strs.size()));
+  mem_->StoreInt32(size_ptr, size);
+}
+
+std::vector<struct iovec> WASI::LoadIOVecs(int32_t iovs, int32_t len) {
+  std::vector<struct iovec> result(len);
+  for (int32_t i = 0; i < len; i++) {
+    BytesSpan bytes = mem_->LoadSliceDirectly(mem_->LoadUint32(iovs + i * 8), mem_->LoadUint32(iovs + i * 8 + 4));
+    result[i].iov_base = bytes.begin();
+    result[i].iov_len = bytes.size();
+  }
+  return result;
+}
+
+void WASI::StoreFilestat(int32_t ptr, const struct stat& st) {
+#ifdef __APPLE__
+  const struct timespec& atim = st.st_atimespec;
+  const struct timespec& mtim = st.st_mtimespec;
+  const struct timespec& ctim = st.st_ctimespec;
+#else
+  const struct timespec& atim = st.st_atim;
+  const struct timespec& mtim = st.st_mtim;
+  const struct timespec& ctim = st.st_ctim;
+#endif
+  mem_->StoreInt64(ptr, static_cast<int64_t>(st.st_dev));
+  mem_->StoreInt64(ptr + 8, static_cast<int64_t>(st.st_ino));
+  mem_->StoreInt64(ptr + 16, 0);
+  mem_->StoreInt8(ptr + 16, ToFiletype(st.st_mode));
+  mem_->StoreInt64(ptr + 24, static_cast<int64_t>(st.st_nlink));
+  mem_->StoreInt64(ptr + 32, static_cast<int64_t>(st.st_size));
+  mem_->StoreInt64(ptr + 40, ToNanoseconds(atim));
+  mem_->StoreInt64(ptr + 48, ToNanoseconds(mtim));
+  mem_->StoreInt64(ptr + 56, ToNanoseconds(ctim));
+}
+
+int32_t WASI::PollOneoff(int32_t in, int32_t out, int32_t nsubscriptions, int32_t nevents_ptr) {
+  struct Event {
+    int64_t userdata;
+    int32_t error;
+    uint8_t type;
+    uint16_t flags;
+  };
+  std::vector<Event> events;
+
+  // Collect the subscriptions. A subscription is 48 bytes: userdata (u64), tag (u8) and the union at 8.
+  int64_t now = MonotonicNowInNanoseconds();
+  int64_t timeout = -1;
+  std::vector<std::pair<int32_t, int64_t>> clocks;
+  std::vector<struct pollfd> pollfds;
+  std::vector<int32_t> pollsubs;
+  for (int32_t i = 0; i < nsubscriptions; i++) {
+    int32_t sub = in + i * 48;
+    int64_t userdata = mem_->LoadInt64(sub);
+    uint8_t tag = mem_->LoadUint8(sub + 8);
+    switch (tag) {
+    case kEventtypeClock: {
+      int64_t t = mem_->LoadInt64(sub + 24);
+      if (mem_->LoadUint16(sub + 40) & kSubclockflagAbstime) {
+        clockid_t id;
+        struct timespec ts;
+        if (!ToClockId(mem_->LoadInt32(sub + 16), &id) || ::clock_gettime(id, &ts) != 0) {
+          events.push_back(Event{userdata, kErrnoInval, tag, 0});
+          continue;
+        }
+        t -= ToNanoseconds(ts);
+      }
+      t = std::max<int64_t>(t, 0);
+      if (timeout < 0 || t < timeout) {
+        timeout = t;
+      }
+      clocks.push_back(std::make_pair(i, now + t));
+      break;
+    }
+    case kEventtypeFdRead:
+    case kEventtypeFdWrite: {
+      File* file = GetFile(mem_->LoadInt32(sub + 16));
+      if (!file) {
+        events.push_back(Event{userdata, kErrnoBadf, tag, 0});
+        continue;
+      }
+      struct pollfd p = {};
+      p.fd = file->host_fd;
+      p.events = tag == kEventtypeFdRead ? POLLIN : POLLOUT;
+      pollfds.push_back(p);
+      pollsubs.push_back(i);
+      break;
+    }
+    default:
+      events.push_back(Event{userdata, kErrnoInval, tag, 0});
+      break;
+    }
+  }
+
+  // Wait for the events.
+  if (!events.empty()) {
+    timeout = 0;
+  }
+  if (!pollfds.empty()) {
+    int ms = timeout < 0 ? -1 : static_cast<int>((timeout + 999999) / 1000000);
+    if (::poll(pollfds.data(), pollfds.size(), ms) < 0 && errno != EINTR) {
+      return ToErrno(errno);
+    }
+    for (size_t i = 0; i < pollfds.size(); i++) {
+      if (!pollfds[i].revents) {
+        continue;
+      }
+      int32_t sub = in + pollsubs[i] * 48;
+      uint16_t flags = (pollfds[i].revents & POLLHUP) ? kEventrwflagFdReadwriteHangup : 0;
+      int32_t error = (pollfds[i].revents & POLLNVAL) ? kErrnoBadf : kErrnoSuccess;
+      events.push_back(Event{mem_->LoadInt64(sub), error, mem_->LoadUint8(sub + 8), flags});
+    }
+  } else if (timeout > 0) {
+    std::this_thread::sleep_for(std::chrono::nanoseconds(timeout));
+  }
+
+  if (!clocks.empty()) {
+    now = MonotonicNowInNanoseconds();
+    bool fired = false;
+    for (auto& c : clocks) {
+      if (c.second <= now) {
+        events.push_back(Event{mem_->LoadInt64(in + c.first * 48), kErrnoSuccess, kEventtypeClock, 0});
+        fired = true;
+      }
+    }
+    // The earliest clock should have fired unless an fd event is available.
+    if (!fired && events.empty()) {
+      auto c = *std::min_element(clocks.begin(), clocks.end(), [](const std::pair<int32_t, int64_t>& a, const std::pair<int32_t, int64_t>& b) {
+        return a.second < b.second;
+      });
+      events.push_back(Event{mem_->LoadInt64(in + c.first * 48), kErrnoSuccess, kEventtypeClock, 0});
+    }
+  }
+
+  // An event is 32 bytes: userdata (u64), error (u16), type (u8) and fd_readwrite at 16.
+  for (size_t i = 0; i < events.size(); i++) {
+    int32_t e = out + static_cast<int32_t>(i) * 32;
+    for (int32_t j = 0; j < 32; j += 8) {
+      mem_->StoreInt64(e + j, 0);
+    }
+    mem_->StoreInt64(e, events[i].userdata);
+    mem_->StoreInt16(e + 8, static_cast<int16_t>(events[i].error));
+    mem_->StoreInt8(e + 10, events[i].type);
+    mem_->StoreInt16(e + 24, events[i].flags);
+  }
+  mem_->StoreInt32(nevents_ptr, static_cast<int32_t>(events.size()));
+  return kErrnoSuccess;
+}
+
+int Main(int argc, char** argv) {
+  std::vector<std::string> args(argv, argv + argc);
+  std::vector<std::string> env;
+  for (char** e = environ; *e; e++) {
+{{if .GoWASIP1}}    if (std::strncmp(*e, "PWD=", 4) == 0) {
+      continue;
+    }
+{{end}}    env.push_back(*e);
+  }
+{{if .GoWASIP1}}
+  // Go's runtime regards PWD as the working directory. Relative paths are resolved against / without this.
+  std::vector<char> cwd(PATH_MAX);
+  if (::getcwd(cwd.data(), cwd.size())) {
+    env.push_back(std::string("PWD=") + cwd.data());
+  }
+{{end}}
+  WASI wasi;
+  return wasi.Run(args, env);
+}
+
+IHost* WASI::Host() {
+  if (!host_) {
+    std::cerr << "WASI::Host: the module imports host functions but no IHost is given" << std::endl;
+    std::abort();
+  }
+  return host_;
+}
+
+WASI::Import::Import(WASI* wasi)
+    : wasi_{wasi} {
+}
+
+{{range $value := .ImportFuncs}}{{$value.CppImpl "WASI::Import" ""}}
+{{end}}
+}
+`))
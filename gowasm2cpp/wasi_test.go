@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gowasm2cpp
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const wasip1MainCpp = `#include "wasi.h"
+
+#include <iostream>
+
+int main() {
+  {
+    go2cpp_test::WASI wasi;
+    std::cout << "exit: " << wasi.Run(std::vector<std::string>{"test", "args", "a", "b c"}) << std::endl;
+  }
+  {
+    go2cpp_test::WASI wasi;
+    std::cout << "exit: " << wasi.Run(std::vector<std::string>{"test", "env"}, std::vector<std::string>{"FOO=bar"}) << std::endl;
+  }
+  {
+    go2cpp_test::WASI wasi;
+    std::cout << "exit: " << wasi.Run(std::vector<std::string>{"test", "exit", "3"}) << std::endl;
+  }
+  {
+    // The WASI can run again after the module exits.
+    go2cpp_test::WASI wasi;
+    wasi.Run(std::vector<std::string>{"test", "exit", "4"});
+    std::cout << "exit: " << wasi.Run(std::vector<std::string>{"test", "fs"}) << std::endl;
+  }
+  return 0;
+}
+`
+
+func TestWASIStartExport(t *testing.T) {
+	cases := []struct {
+		In  []string
+		Out string
+	}{
+		{In: []string{"memory", "_start"}, Out: "_start"},
+		{In: []string{"_initialize", "memory"}, Out: "_initialize"},
+		{In: []string{"_initialize", "_start"}, Out: "_start"},
+		{In: []string{"memory", "add"}, Out: ""},
+	}
+	for _, c := range cases {
+		var exports []*wasmExport
+		for _, n := range c.In {
+			exports = append(exports, &wasmExport{Name: n})
+		}
+		if got, want := wasiStartExport(exports), c.Out; got != want {
+			t.Errorf("wasiStartExport(%v): got: %v, want: %v", c.In, got, want)
+		}
+	}
+}
+
+const wasip1MainMainCpp = `#include "wasi.h"
+
+int main(int argc, char** argv) {
+  return go2cpp_test::Main(argc, argv);
+}
+`
+
+func TestWASIP1(t *testing.T) {
+	p := compileCppProgram(t, "./testdata/wasip1", &cppProgramOptions{
+		GOOS: "wasip1",
+	})
+	defer p.remove()
+
+	t.Run("Run", func(t *testing.T) {
+		got := strings.TrimSpace(p.run(t, "run", wasip1MainCpp))
+		want := strings.Join([]string{
+			`args: ["a" "b c"]`,
+			"exit: 0",
+			`FOO: "bar"`,
+			"exit: 0",
+			"exit: 3",
+			`read: "hello, a.txt"`,
+			"open a missing file: not exist: true",
+			"entry: a.txt, dir: false",
+			"entry: b.txt, dir: false",
+			"entry: c, dir: true",
+			"exit: 0",
+		}, "\n")
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+	t.Run("Detection", func(t *testing.T) {
+		info, err := Inspect(p.wasmFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := info.Target, "wasip1"; got != want {
+			t.Errorf("target: got: %q, want: %q", got, want)
+		}
+
+		// A module importing WASI without the Go build ID is not a Go program.
+		const src = `(module
+  (import "wasi_snapshot_preview1" "proc_exit" (func $proc_exit (param i32)))
+  (memory (export "memory") 1)
+  (func (export "_start")
+    i32.const 0
+    call $proc_exit))
+`
+		wasmFile := filepath.Join(p.dir, "wasi.wat")
+		if err := ioutil.WriteFile(wasmFile, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err = Inspect(wasmFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := info.Target, "wasi"; got != want {
+			t.Errorf("target: got: %q, want: %q", got, want)
+		}
+	})
+
+	t.Run("Main", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "gowasm2cpp-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		// getcwd returns the path without symbolic links.
+		dir, err = filepath.EvalSymlinks(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"y.txt", "x.txt"} {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cmd := exec.Command(p.build(t, "main", wasip1MainMainCpp), "getwd")
+		cmd.Dir = dir
+		// Main replaces PWD with the actual working directory.
+		cmd.Env = []string{"PWD=/nonexistent"}
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("running C++ failed: %v\n%s", err, out)
+		}
+		got := strings.TrimSpace(string(out))
+		want := strings.Join([]string{
+			"wd: " + dir,
+			"entry: x.txt",
+			"entry: y.txt",
+		}, "\n")
+		if got != want {
+			t.Errorf("output: got: %q, want: %q", got, want)
+		}
+	})
+}
@@ -0,0 +1,760 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package difftest compares the generated C++ with a reference interpreter.
+//
+// A Harness runs functions of a Wasm module both in wagon's exec VM and in the C++ program generated by gowasm2cpp
+// and compiled with a system C++ compiler, and compares the results and the memory effects.
+//
+// Before the generation, the module is rewritten so that the functions can be called from the outside:
+// the selected functions are exported, and imported functions are replaced with functions that trap.
+// Each call starts from the initial state of the module. Calls that trap or don't finish in the reference
+// interpreter are skipped, as the generated C++ doesn't check traps.
+//
+// Note that the reference interpreter doesn't follow the specification in some cases: the shift counts are not
+// wrapped, the signed division overflow and the float-to-int conversion overflow don't trap, and nearest rounds
+// halfway cases away from zero. The results of such cases are not reliable.
+package difftest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	wagonexec "github.com/go-interpreter/wagon/exec"
+	"github.com/go-interpreter/wagon/wasm"
+
+	"github.com/hajimehoshi/go2cpp/gowasm2cpp"
+)
+
+const namespace = "difftest"
+
+// Options represents the options for New.
+type Options struct {
+	// Funcs is the function indices to test, including imported functions in the index space.
+	// If Funcs is empty, all the functions defined in the module are tested.
+	Funcs []int
+
+	// Interpreter specifies whether the functions that the translator cannot convert are executed by the embedded
+	// interpreter.
+	Interpreter bool
+
+	// InterpretAll specifies whether all the functions are executed by the embedded interpreter instead of the
+	// translated C++. This is useful to test the interpreter.
+	InterpretAll bool
+
+	// CXX is the C++ compiler. The default value is $CXX or c++.
+	CXX string
+
+	// CXXFlags is the flags for the C++ compiler. The default value is -O2.
+	CXXFlags []string
+
+	// Timeout is the maximum duration of a call in the reference interpreter. The default value is one second.
+	Timeout time.Duration
+}
+
+// Call represents a function call.
+type Call struct {
+	// Func is the function index.
+	Func int
+
+	// Args is the arguments in their bit representations.
+	Args []uint64
+}
+
+func (c Call) String() string {
+	var args []string
+	for _, a := range c.Args {
+		args = append(args, fmt.Sprintf("0x%x", a))
+	}
+	return fmt.Sprintf("func%d(%s)", c.Func, strings.Join(args, ", "))
+}
+
+// Result represents the effects of a function call.
+type Result struct {
+	// Value is the bit representation of the returned value. Value is 0 when the function returns nothing.
+	Value uint64
+
+	// MemPages is the number of the memory pages after the call.
+	MemPages int
+
+	// MemHash is the FNV-1a hash of the whole memory after the call.
+	MemHash uint64
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("value: 0x%x, pages: %d, memory hash: %016x", r.Value, r.MemPages, r.MemHash)
+}
+
+// Mismatch represents a call whose results differ.
+type Mismatch struct {
+	Call Call
+
+	// Want is the result of the reference interpreter.
+	Want Result
+
+	// Got is the result of the generated C++.
+	Got Result
+}
+
+func (m *Mismatch) String() string {
+	return fmt.Sprintf("%s: got: %s, want: %s", m.Call, m.Got, m.Want)
+}
+
+// Harness runs functions of a Wasm module both in the reference interpreter and in the generated C++.
+type Harness struct {
+	mod     []byte
+	sigs    map[int]*wasm.FunctionSig
+	funcs   []int
+	timeout time.Duration
+	dir     string
+	bin     string
+	mu      sync.Mutex
+}
+
+// New generates C++ from the Wasm module and compiles it.
+// The module is given in the binary format. The options can be nil.
+//
+// Close must be called to remove the temporary files.
+func New(module []byte, options *Options) (*Harness, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	mod, err := wasm.DecodeModule(bytes.NewReader(module))
+	if err != nil {
+		return nil, err
+	}
+	funcs := options.Funcs
+	if len(funcs) == 0 {
+		numImports := 0
+		if mod.Import != nil {
+			numImports = len(mod.Import.Entries)
+		}
+		numFuncs := 0
+		if mod.Function != nil {
+			numFuncs = len(mod.Function.Types)
+		}
+		for i := 0; i < numFuncs; i++ {
+			funcs = append(funcs, numImports+i)
+		}
+	}
+	if len(funcs) == 0 {
+		return nil, fmt.Errorf("difftest: no functions to test")
+	}
+
+	if err := rewriteModule(mod, funcs); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := wasm.EncodeModule(&buf, mod); err != nil {
+		return nil, err
+	}
+
+	sigs := map[int]*wasm.FunctionSig{}
+	for _, f := range funcs {
+		sig := &mod.Types.Entries[mod.Function.Types[f]]
+		if len(sig.ReturnTypes) > 1 {
+			return nil, fmt.Errorf("difftest: func%d: multiple return values are not supported", f)
+		}
+		sigs[f] = sig
+	}
+
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = time.Second
+	}
+
+	dir, err := ioutil.TempDir("", "difftest")
+	if err != nil {
+		return nil, err
+	}
+	h := &Harness{
+		mod:     buf.Bytes(),
+		sigs:    sigs,
+		funcs:   funcs,
+		timeout: timeout,
+		dir:     dir,
+		bin:     filepath.Join(dir, "difftest"),
+	}
+	if err := h.build(options); err != nil {
+		h.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// Close removes the temporary files.
+func (h *Harness) Close() error {
+	return os.RemoveAll(h.dir)
+}
+
+// rewriteModule rewrites the module so that the funcs can be called from the outside.
+//
+// The imported functions are replaced with defined functions that trap. As the new functions are placed at the
+// beginning of the function section, the function indices don't change.
+func rewriteModule(mod *wasm.Module, funcs []int) error {
+	var types []uint32
+	if mod.Import != nil {
+		for _, e := range mod.Import.Entries {
+			f, ok := e.Type.(wasm.FuncImport)
+			if !ok {
+				return fmt.Errorf("difftest: importing %s.%s is not supported", e.ModuleName, e.FieldName)
+			}
+			types = append(types, f.Type)
+		}
+		mod.Import.Entries = nil
+	}
+
+	if mod.Function == nil {
+		mod.Function = &wasm.SectionFunctions{}
+		setSection(mod, mod.Function)
+	}
+	if mod.Code == nil {
+		mod.Code = &wasm.SectionCode{}
+		setSection(mod, mod.Code)
+	}
+	var bodies []wasm.FunctionBody
+	for range types {
+		bodies = append(bodies, wasm.FunctionBody{
+			// unreachable. The encoder adds the last end.
+			Code: []byte{0x00},
+		})
+	}
+	mod.Function.Types = append(types, mod.Function.Types...)
+	mod.Code.Bodies = append(bodies, mod.Code.Bodies...)
+
+	for _, f := range funcs {
+		if f < 0 || f >= len(mod.Function.Types) {
+			return fmt.Errorf("difftest: function index out of range: %d", f)
+		}
+	}
+
+	// The exported names are used as C++ identifiers. Replace all the exports to avoid conflicts.
+	if mod.Export == nil {
+		mod.Export = &wasm.SectionExports{}
+		setSection(mod, mod.Export)
+	}
+	mod.Export.Entries = map[string]wasm.ExportEntry{}
+	mod.Export.Names = nil
+	for _, f := range funcs {
+		name := exportName(f)
+		mod.Export.Names = append(mod.Export.Names, name)
+		mod.Export.Entries[name] = wasm.ExportEntry{
+			FieldStr: name,
+			Kind:     wasm.ExternalFunction,
+			Index:    uint32(f),
+		}
+	}
+
+	// The generated C++ doesn't run the start function.
+	if mod.Start != nil {
+		mod.Start = nil
+		for i, s := range mod.Sections {
+			if s.SectionID() == wasm.SectionIDStart {
+				mod.Sections = append(mod.Sections[:i], mod.Sections[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// setSection adds the section to the module in the order of the section IDs.
+func setSection(mod *wasm.Module, section wasm.Section) {
+	id := section.SectionID()
+	for i, s := range mod.Sections {
+		if s.SectionID() == wasm.SectionIDCustom {
+			continue
+		}
+		if s.SectionID() > id {
+			mod.Sections = append(mod.Sections[:i], append([]wasm.Section{section}, mod.Sections[i:]...)...)
+			return
+		}
+	}
+	mod.Sections = append(mod.Sections, section)
+}
+
+func exportName(index int) string {
+	return fmt.Sprintf("difftest_func%d", index)
+}
+
+func (h *Harness) build(options *Options) error {
+	wasmFile := filepath.Join(h.dir, "module.wasm")
+	if err := ioutil.WriteFile(wasmFile, h.mod, 0644); err != nil {
+		return err
+	}
+	genDir := filepath.Join(h.dir, "gen")
+	if err := os.MkdirAll(genDir, 0755); err != nil {
+		return err
+	}
+	if err := gowasm2cpp.GenerateWithOptions(genDir, "", wasmFile, namespace, &gowasm2cpp.Options{
+		Interpreter:  options.Interpreter,
+		InterpretAll: options.InterpretAll,
+	}); err != nil {
+		return err
+	}
+
+	type funcInfo struct {
+		Index  int
+		Export string
+		Params []string
+		Result string
+	}
+	var funcs []funcInfo
+	for _, f := range h.funcs {
+		sig := h.sigs[f]
+		info := funcInfo{
+			Index:  f,
+			Export: exportName(f),
+		}
+		for _, t := range sig.ParamTypes {
+			info.Params = append(info.Params, cppType(t))
+		}
+		if len(sig.ReturnTypes) > 0 {
+			info.Result = cppType(sig.ReturnTypes[0])
+		}
+		funcs = append(funcs, info)
+	}
+
+	mainFile := filepath.Join(h.dir, "main.cpp")
+	f, err := os.Create(mainFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := mainCppTmpl.Execute(f, struct {
+		Namespace string
+		Funcs     []funcInfo
+	}{
+		Namespace: namespace,
+		Funcs:     funcs,
+	}); err != nil {
+		return err
+	}
+
+	// Only the files for the instance are needed. The other files assume a Go program.
+	srcs := []string{mainFile}
+	for _, name := range []string{"bits.cpp", "bytes.cpp", "mem.cpp", "interp.cpp", "inst.*.cpp"} {
+		ms, err := filepath.Glob(filepath.Join(genDir, name))
+		if err != nil {
+			return err
+		}
+		srcs = append(srcs, ms...)
+	}
+
+	cxx := options.CXX
+	if cxx == "" {
+		cxx = os.Getenv("CXX")
+	}
+	if cxx == "" {
+		cxx = "c++"
+	}
+	flags := options.CXXFlags
+	if flags == nil {
+		flags = []string{"-O2"}
+	}
+	args := append([]string{"-std=c++14", "-w", "-I" + genDir, "-o", h.bin}, flags...)
+	args = append(args, srcs...)
+	cmd := exec.Command(cxx, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("difftest: compiling C++ failed: %v\n%s", err, out)
+	}
+	return nil
+}
+
+func cppType(t wasm.ValueType) string {
+	switch t {
+	case wasm.ValueTypeI32:
+		return "int32_t"
+	case wasm.ValueTypeI64:
+		return "int64_t"
+	case wasm.ValueTypeF32:
+		return "float"
+	case wasm.ValueTypeF64:
+		return "double"
+	default:
+		panic("not reached")
+	}
+}
+
+// Funcs returns the function indices to test.
+func (h *Harness) Funcs() []int {
+	return append([]int{}, h.funcs...)
+}
+
+// specialBits is the list of the bit representations that are likely to cause problems.
+var specialBits = map[wasm.ValueType][]uint64{
+	wasm.ValueTypeI32: {0, 1, 2, 0x7f, 0x80, 0xff, 0x7fffffff, 0x80000000, 0xffffffff},
+	wasm.ValueTypeI64: {0, 1, 2, 0x7fffffff, 0x80000000, 0xffffffff, 0x7fffffffffffffff, 0x8000000000000000, 0xffffffffffffffff},
+	wasm.ValueTypeF32: {
+		uint64(math.Float32bits(0)), uint64(math.Float32bits(float32(math.Copysign(0, -1)))),
+		uint64(math.Float32bits(1)), uint64(math.Float32bits(-1.5)), uint64(math.Float32bits(2.5)),
+		uint64(math.Float32bits(float32(math.Inf(1)))), uint64(math.Float32bits(float32(math.Inf(-1)))),
+		0x7fc00000, 0xffc00000, 0x7f800001, 1,
+		uint64(math.Float32bits(2147483648)), uint64(math.Float32bits(-2147483904)),
+	},
+	wasm.ValueTypeF64: {
+		math.Float64bits(0), math.Float64bits(math.Copysign(0, -1)),
+		math.Float64bits(1), math.Float64bits(-1.5), math.Float64bits(2.5),
+		math.Float64bits(math.Inf(1)), math.Float64bits(math.Inf(-1)),
+		0x7ff8000000000000, 0xfff8000000000000, 0x7ff0000000000001, 1,
+		math.Float64bits(9223372036854775808), math.Float64bits(-9223372036854777856),
+	},
+}
+
+// RandomCalls returns n calls with random arguments for each function.
+func (h *Harness) RandomCalls(r *rand.Rand, n int) []Call {
+	var calls []Call
+	for _, f := range h.funcs {
+		for i := 0; i < n; i++ {
+			var args []uint64
+			for _, t := range h.sigs[f].ParamTypes {
+				args = append(args, randomBits(r, t))
+			}
+			calls = append(calls, Call{
+				Func: f,
+				Args: args,
+			})
+		}
+	}
+	return calls
+}
+
+func randomBits(r *rand.Rand, t wasm.ValueType) uint64 {
+	switch r.Intn(4) {
+	case 0:
+		s := specialBits[t]
+		return s[r.Intn(len(s))]
+	case 1:
+		// Small values are likely to be valid addresses and loop counts.
+		v := uint64(r.Intn(256))
+		switch t {
+		case wasm.ValueTypeF32:
+			return uint64(math.Float32bits(float32(v)))
+		case wasm.ValueTypeF64:
+			return math.Float64bits(float64(v))
+		}
+		return v
+	}
+	v := r.Uint64()
+	if t == wasm.ValueTypeI32 || t == wasm.ValueTypeF32 {
+		v &= 0xffffffff
+	}
+	return v
+}
+
+// CallFromBytes returns a call made from the given bytes. CallFromBytes is useful for fuzzing.
+// The first byte selects the function, and each following 8 bytes are an argument in little endian.
+// The missing bytes are treated as 0.
+func (h *Harness) CallFromBytes(data []byte) Call {
+	var f int
+	if len(data) > 0 {
+		f = h.funcs[int(data[0])%len(h.funcs)]
+		data = data[1:]
+	} else {
+		f = h.funcs[0]
+	}
+
+	var args []uint64
+	for _, t := range h.sigs[f].ParamTypes {
+		var buf [8]byte
+		n := copy(buf[:], data)
+		data = data[n:]
+		v := binary.LittleEndian.Uint64(buf[:])
+		if t == wasm.ValueTypeI32 || t == wasm.ValueTypeF32 {
+			v &= 0xffffffff
+		}
+		args = append(args, v)
+	}
+	return Call{
+		Func: f,
+		Args: args,
+	}
+}
+
+// Run runs the calls and returns the calls whose results differ.
+// Run also returns the number of the calls that are actually compared.
+func (h *Harness) Run(calls []Call) ([]*Mismatch, int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var wants []Result
+	var valid []Call
+	for _, c := range calls {
+		if _, ok := h.sigs[c.Func]; !ok {
+			return nil, 0, fmt.Errorf("difftest: func%d is not a target", c.Func)
+		}
+		r, ok, err := h.runReference(c)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !ok {
+			continue
+		}
+		wants = append(wants, r)
+		valid = append(valid, c)
+	}
+	if len(valid) == 0 {
+		return nil, 0, nil
+	}
+
+	gots, err := h.runCpp(valid)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ms []*Mismatch
+	for i, c := range valid {
+		if h.equal(c.Func, wants[i], gots[i]) {
+			continue
+		}
+		ms = append(ms, &Mismatch{
+			Call: c,
+			Want: wants[i],
+			Got:  gots[i],
+		})
+	}
+	return ms, len(valid), nil
+}
+
+// equal reports whether the two results are the same.
+// As the bits of NaN values are not deterministic, any NaN results are treated as the same.
+func (h *Harness) equal(f int, a, b Result) bool {
+	if a.MemPages != b.MemPages || a.MemHash != b.MemHash {
+		return false
+	}
+	if a.Value == b.Value {
+		return true
+	}
+	sig := h.sigs[f]
+	if len(sig.ReturnTypes) == 0 {
+		return true
+	}
+	switch sig.ReturnTypes[0] {
+	case wasm.ValueTypeF32:
+		return isNaN32(a.Value) && isNaN32(b.Value)
+	case wasm.ValueTypeF64:
+		return isNaN64(a.Value) && isNaN64(b.Value)
+	}
+	return false
+}
+
+func isNaN32(v uint64) bool {
+	f := math.Float32frombits(uint32(v))
+	return f != f
+}
+
+func isNaN64(v uint64) bool {
+	return math.IsNaN(math.Float64frombits(v))
+}
+
+// runReference runs the call in the reference interpreter.
+// runReference returns false when the call traps or doesn't finish in time.
+func (h *Harness) runReference(c Call) (Result, bool, error) {
+	mod, err := wasm.ReadModule(bytes.NewReader(h.mod), nil)
+	if err != nil {
+		return Result{}, false, err
+	}
+	vm, err := wagonexec.NewVM(mod)
+	if err != nil {
+		return Result{}, false, err
+	}
+	vm.RecoverPanic = true
+
+	var timedout int32
+	timer := time.AfterFunc(h.timeout, func() {
+		atomic.StoreInt32(&timedout, 1)
+		wagonexec.NewProcess(vm).Terminate()
+	})
+	v, err := vm.ExecCode(int64(c.Func), c.Args...)
+	timer.Stop()
+	if err != nil || atomic.LoadInt32(&timedout) != 0 {
+		return Result{}, false, nil
+	}
+
+	var r Result
+	switch v := v.(type) {
+	case uint32:
+		r.Value = uint64(v)
+	case uint64:
+		r.Value = v
+	case float32:
+		r.Value = uint64(math.Float32bits(v))
+	case float64:
+		r.Value = math.Float64bits(v)
+	}
+	mem := vm.Memory()
+	r.MemPages = len(mem) / (64 * 1024)
+	hash := fnv.New64a()
+	hash.Write(mem)
+	r.MemHash = hash.Sum64()
+	return r, true, nil
+}
+
+// runCpp runs the calls in the generated C++.
+func (h *Harness) runCpp(calls []Call) ([]Result, error) {
+	var in bytes.Buffer
+	for _, c := range calls {
+		fmt.Fprintf(&in, "%d %d", c.Func, len(c.Args))
+		for _, a := range c.Args {
+			fmt.Fprintf(&in, " %x", a)
+		}
+		in.WriteString("\n")
+	}
+
+	// The calls that finish in the reference interpreter should finish in C++ too.
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout*time.Duration(len(calls)+10))
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.bin)
+	cmd.Stdin = &in
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// Report the call that crashed.
+		n := bytes.Count(out, []byte("\n"))
+		if n < len(calls) {
+			return nil, fmt.Errorf("difftest: %s: C++ failed: %v\n%s", calls[n], err, stderr.Bytes())
+		}
+		return nil, fmt.Errorf("difftest: C++ failed: %v\n%s", err, stderr.Bytes())
+	}
+
+	var rs []Result
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		var r Result
+		if _, err := fmt.Sscanf(s.Text(), "%x %d %x", &r.Value, &r.MemPages, &r.MemHash); err != nil {
+			return nil, fmt.Errorf("difftest: unexpected output: %q: %v", s.Text(), err)
+		}
+		rs = append(rs, r)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(rs) != len(calls) {
+		return nil, fmt.Errorf("difftest: the number of results must be %d but %d", len(calls), len(rs))
+	}
+	return rs, nil
+}
+
+var mainCppTmpl = template.Must(template.New("main.cpp").Parse(`// Code generated by difftest. DO NOT EDIT.
+
+#include "inst.h"
+#include "mem.h"
+
+#include <cinttypes>
+#include <cstdio>
+#include <cstring>
+#include <memory>
+
+namespace {
+
+using {{.Namespace}}::IImport;
+using {{.Namespace}}::Inst;
+using {{.Namespace}}::Mem;
+
+template <typename To, typename From>
+To BitCast(From from) {
+  static_assert(sizeof(To) == sizeof(From), "sizes must match");
+  To to;
+  std::memcpy(&to, &from, sizeof(to));
+  return to;
+}
+
+template <typename T>
+T FromBits(uint64_t v);
+
+template <>
+int32_t FromBits<int32_t>(uint64_t v) {
+  return static_cast<int32_t>(static_cast<uint32_t>(v));
+}
+
+template <>
+int64_t FromBits<int64_t>(uint64_t v) {
+  return static_cast<int64_t>(v);
+}
+
+template <>
+float FromBits<float>(uint64_t v) {
+  return BitCast<float>(static_cast<uint32_t>(v));
+}
+
+template <>
+double FromBits<double>(uint64_t v) {
+  return BitCast<double>(v);
+}
+
+uint64_t ToBits(int32_t v) {
+  return static_cast<uint32_t>(v);
+}
+
+uint64_t ToBits(int64_t v) {
+  return static_cast<uint64_t>(v);
+}
+
+uint64_t ToBits(float v) {
+  return BitCast<uint32_t>(v);
+}
+
+uint64_t ToBits(double v) {
+  return BitCast<uint64_t>(v);
+}
+
+uint64_t Call(Inst* inst, int index, const uint64_t* args) {
+  switch (index) {
+{{range $f := .Funcs}}  case {{$f.Index}}:
+{{if $f.Result}}    return ToBits(inst->{{$f.Export}}({{range $i, $p := $f.Params}}{{if $i}}, {{end}}FromBits<{{$p}}>(args[{{$i}}]){{end}}));
+{{else}}    inst->{{$f.Export}}({{range $i, $p := $f.Params}}{{if $i}}, {{end}}FromBits<{{$p}}>(args[{{$i}}]){{end}});
+    return 0;
+{{end}}{{end}}  }
+  std::fprintf(stderr, "unexpected function index: %d\n", index);
+  std::abort();
+}
+
+}
+
+int main() {
+  int index;
+  int num_args;
+  while (std::scanf("%d %d", &index, &num_args) == 2) {
+    std::unique_ptr<uint64_t[]> args(new uint64_t[num_args + 1]);
+    for (int i = 0; i < num_args; i++) {
+      if (std::scanf("%" SCNx64, &args[i]) != 1) {
+        std::fprintf(stderr, "invalid argument\n");
+        return 1;
+      }
+    }
+
+    std::unique_ptr<Mem> mem(new Mem());
+    IImport import;
+    std::unique_ptr<Inst> inst(new Inst(mem.get(), &import));
+    uint64_t value = Call(inst.get(), index, args.get());
+
+    uint64_t hash = 14695981039346656037ull;
+    int32_t size = mem->GetSize() * Mem::kPageSize;
+    for (int32_t i = 0; i < size; i++) {
+      hash ^= mem->LoadUint8(i);
+      hash *= 1099511628211ull;
+    }
+    std::printf("%016" PRIx64 " %d %016" PRIx64 "\n", value, mem->GetSize(), hash);
+    std::fflush(stdout);
+  }
+  return 0;
+}
+`))
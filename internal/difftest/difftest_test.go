@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package difftest_test
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"testing"
+
+	. "github.com/hajimehoshi/go2cpp/internal/difftest"
+	"github.com/hajimehoshi/go2cpp/internal/wat"
+)
+
+// newHarness returns a harness for testdata/ops.wat. The options can be nil.
+// newHarness skips the test when a C++ compiler is not available.
+func newHarness(t testing.TB, options *Options) *Harness {
+	cxx := os.Getenv("CXX")
+	if cxx == "" {
+		cxx = "c++"
+	}
+	if _, err := exec.LookPath(cxx); err != nil {
+		t.Skip("C++ compiler is not available")
+	}
+
+	src, err := ioutil.ReadFile("testdata/ops.wat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := wat.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := New(bin, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestRandomCalls(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiling C++ takes time")
+	}
+
+	h := newHarness(t, nil)
+	defer h.Close()
+
+	ms, n, err := h.Run(h.RandomCalls(rand.New(rand.NewSource(1)), 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range ms {
+		t.Error(m)
+	}
+	if n == 0 {
+		t.Errorf("no calls are compared")
+	}
+}
+
+func TestRandomCallsInterpreter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiling C++ takes time")
+	}
+
+	h := newHarness(t, &Options{
+		InterpretAll: true,
+	})
+	defer h.Close()
+
+	ms, n, err := h.Run(h.RandomCalls(rand.New(rand.NewSource(1)), 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range ms {
+		t.Error(m)
+	}
+	if n == 0 {
+		t.Errorf("no calls are compared")
+	}
+}
+
+func TestSkipTraps(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiling C++ takes time")
+	}
+
+	h := newHarness(t, nil)
+	defer h.Close()
+
+	// func6 is $div and func9 is $call. The import is func0.
+	ms, n, err := h.Run([]Call{
+		{Func: 6, Args: []uint64{1, 0}},
+		{Func: 6, Args: []uint64{0x80000000, 0x80000000}},
+		{Func: 9, Args: []uint64{42}},
+		{Func: 6, Args: []uint64{7, 2}},
+		{Func: 9, Args: []uint64{41}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range ms {
+		t.Error(m)
+	}
+	if got, want := n, 2; got != want {
+		t.Errorf("compared calls: got: %d, want: %d", got, want)
+	}
+}
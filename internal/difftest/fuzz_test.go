@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build go1.18
+// +build go1.18
+
+package difftest_test
+
+import (
+	"testing"
+
+	. "github.com/hajimehoshi/go2cpp/internal/difftest"
+)
+
+// FuzzOps runs the functions in testdata/ops.wat with fuzzed arguments.
+//
+//	go test -run=^$ -fuzz=FuzzOps ./internal/difftest
+func FuzzOps(f *testing.F) {
+	if testing.Short() {
+		f.Skip("compiling C++ takes time")
+	}
+
+	h := newHarness(f, nil)
+	f.Cleanup(func() {
+		h.Close()
+	})
+
+	for i := range h.Funcs() {
+		f.Add(append([]byte{byte(i)}, make([]byte, 16)...))
+		f.Add(append([]byte{byte(i)}, 0xff, 0xff, 0xff, 0x7f, 0, 0, 0, 0, 0x80, 0, 0, 0, 0, 0, 0, 0))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ms, _, err := h.Run([]Call{h.CallFromBytes(data)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range ms {
+			t.Error(m)
+		}
+	})
+}
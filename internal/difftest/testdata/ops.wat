@@ -0,0 +1,83 @@
+(module
+  (import "env" "log" (func $log (param i32)))
+  (memory 1)
+  (global $counter (mut i32) (i32.const 0))
+  (data (i32.const 16) "\01\02\03\04\05\06\07\08")
+
+  (func $cond (param $a i32) (param $b i32) (result i32)
+    (local $r i32)
+    (if (i32.eqz (i32.lt_s (local.get $a) (local.get $b)))
+      (then (local.set $r (i32.const 1)))
+      (else (local.set $r (i32.const 2))))
+    (if (i32.ne (i32.and (local.get $a) (i32.const 1)) (i32.const 0))
+      (then (local.set $r (i32.add (local.get $r) (i32.const 10)))))
+    (if (i32.ge_u (local.get $a) (local.get $b))
+      (then (local.set $r (i32.add (local.get $r) (i32.const 100)))))
+    (select (local.get $r) (i32.sub (i32.const 0) (local.get $r)) (i32.gt_s (local.get $b) (i32.const 0))))
+
+  (func $loop (param $n i32) (result i64)
+    (local $i i32)
+    (local $acc i64)
+    (local.set $n (i32.and (local.get $n) (i32.const 255)))
+    (block $done
+      (loop $next
+        (br_if $done (i32.ge_u (local.get $i) (local.get $n)))
+        (local.set $acc
+          (i64.add
+            (i64.mul (local.get $acc) (i64.const 31))
+            (i64.extend_i32_u (local.get $i))))
+        (local.set $i (i32.add (local.get $i) (i32.const 1)))
+        (br $next)))
+    (local.get $acc))
+
+  (func $stack (param $a i64) (param $b i64) (result i64)
+    (i64.add
+      (i64.mul (local.get $a) (local.get $b))
+      (block $b0
+        (br_if $b0 (i64.eqz (local.get $a)))
+        (local.set $b (i64.rotl (local.get $b) (local.get $a))))
+      ;; The reference interpreter doesn't wrap the shift counts.
+      (i64.xor
+        (i64.shr_s (local.get $a) (i64.and (local.get $b) (i64.const 63)))
+        (i64.shr_u (local.get $b) (i64.const 3)))))
+
+  (func $mem (param $addr i32) (param $v i64)
+    (local.set $addr (i32.and (local.get $addr) (i32.const 0xfff8)))
+    (i64.store (local.get $addr) (local.get $v))
+    (i32.store16 offset=8 (local.get $addr) (i32.wrap_i64 (local.get $v)))
+    (i32.store8 offset=3 (i32.const 16) (i32.load8_s offset=1 (local.get $addr)))
+    (global.set $counter (i32.add (global.get $counter) (i32.const 1)))
+    (i32.store (i32.const 0) (global.get $counter)))
+
+  (func $bits (param $a i32) (param $b i64) (result i64)
+    (i64.add
+      (i64.extend_i32_u
+        (i32.add (i32.clz (local.get $a))
+          (i32.add (i32.ctz (local.get $a)) (i32.popcnt (local.get $a)))))
+      (i64.add (i64.clz (local.get $b))
+        (i64.add (i64.ctz (local.get $b)) (i64.popcnt (local.get $b))))))
+
+  (func $div (param $a i32) (param $b i32) (result i32)
+    ;; The reference interpreter doesn't trap at the overflow of the signed division.
+    (local.set $b (i32.and (local.get $b) (i32.const 0x7fffffff)))
+    (i32.add (i32.div_s (local.get $a) (local.get $b)) (i32.rem_u (local.get $a) (local.get $b))))
+
+  (func $float (param $a f64) (param $b f32) (result f64)
+    (f64.add
+      (f64.add (f64.mul (local.get $a) (f64.promote_f32 (local.get $b)))
+        (f64.floor (f64.div (local.get $a) (f64.const 3))))
+      (f64.add (f64.ceil (f64.neg (local.get $a))) (f64.copysign (f64.sqrt (f64.abs (local.get $a))) (local.get $a)))))
+
+  (func $convert (param $a i64) (param $b i32) (result f32)
+    (f32.add
+      (f32.demote_f64 (f64.convert_i64_s (local.get $a)))
+      (f32.add (f32.convert_i32_u (local.get $b)) (f32.convert_i64_u (local.get $a)))))
+
+  (func $call (param $a i32) (result i32)
+    (if (i32.eq (local.get $a) (i32.const 42))
+      (then (call $log (local.get $a))))
+    (call $cond (local.get $a) (i32.const 7)))
+
+  (func $grow (param $n i32) (result i32)
+    (drop (memory.grow (i32.and (local.get $n) (i32.const 3))))
+    (memory.size)))
@@ -0,0 +1,963 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package spectest runs the WebAssembly spec test scripts (.wast) through the translator.
+//
+// Each module in a script is rewritten so that its exported functions can be called from the outside, translated by
+// gowasm2cpp and compiled with a system C++ compiler. A harness generated for the script executes the actions and
+// the assertions in order. Each of them runs in a forked process so that a trap doesn't stop the script, and the
+// ones that succeed are executed again in the harness process to update the module states.
+//
+// Only assert_return and assert_trap are checked. Modules that import anything other than functions from the
+// spectest module are skipped. The results are grouped by the first numeric or memory instruction of the invoked
+// function like i32.add or f32.min, so that the conformance of each opcode can be seen.
+//
+// As the harness uses fork, spectest works only on POSIX systems.
+package spectest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-interpreter/wagon/disasm"
+	"github.com/go-interpreter/wagon/wasm"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/hajimehoshi/go2cpp/gowasm2cpp"
+	"github.com/hajimehoshi/go2cpp/internal/wat"
+)
+
+// Options represents the options for Run.
+type Options struct {
+	// Interpreter specifies whether the functions that the translator cannot convert are executed by the embedded
+	// interpreter.
+	Interpreter bool
+
+	// CXX is the C++ compiler. The default value is $CXX or c++.
+	CXX string
+
+	// CXXFlags is the flags for the C++ compiler. The default value is -O2.
+	CXXFlags []string
+
+	// Timeout is the time limit of each assertion. The default value is 5 seconds.
+	Timeout time.Duration
+}
+
+// Group is the results of the assertions in an opcode group.
+type Group struct {
+	// Name is the name of the group. Name is an opcode name like i32.add, or the script name when the invoked
+	// function doesn't have any numeric or memory instructions.
+	Name string
+
+	Passed  int
+	Failed  int
+	Skipped int
+
+	// Failures is the descriptions of the failed assertions.
+	Failures []string
+}
+
+// Result is the results of spec test scripts.
+type Result struct {
+	// Groups is the groups sorted by their names.
+	Groups []*Group
+}
+
+// Add adds the groups of r2 to r.
+func (r *Result) Add(r2 *Result) {
+	groups := map[string]*Group{}
+	for _, g := range r.Groups {
+		groups[g.Name] = g
+	}
+	for _, g2 := range r2.Groups {
+		g, ok := groups[g2.Name]
+		if !ok {
+			g = &Group{Name: g2.Name}
+			groups[g.Name] = g
+			r.Groups = append(r.Groups, g)
+		}
+		g.Passed += g2.Passed
+		g.Failed += g2.Failed
+		g.Skipped += g2.Skipped
+		g.Failures = append(g.Failures, g2.Failures...)
+	}
+	sort.Slice(r.Groups, func(i, j int) bool {
+		return r.Groups[i].Name < r.Groups[j].Name
+	})
+}
+
+type export struct {
+	name string
+	sig  *wasm.FunctionSig
+}
+
+type module struct {
+	Index int
+	Start bool
+
+	name    string
+	orig    *wasm.Module
+	exports map[string]*export
+
+	// skip is the reason why the assertions for the module are skipped.
+	skip string
+
+	// err is the error at generating or compiling C++. The assertions for the module fail.
+	err error
+
+	// step is the index of the step to instantiate the module.
+	step int
+}
+
+func (m *module) Namespace() string {
+	return fmt.Sprintf("spectest_m%d", m.Index)
+}
+
+func (m *module) Dir() string {
+	return fmt.Sprintf("m%d", m.Index)
+}
+
+type step struct {
+	Module      *module
+	Instantiate bool
+	Export      string
+	Args        []string
+	HasResult   bool
+	Commit      bool
+}
+
+type assertion struct {
+	cmd    *wat.Command
+	module *module
+	sig    *wasm.FunctionSig
+	group  string
+	step   int
+}
+
+type runner struct {
+	options *Options
+	name    string
+	base    string
+	dir     string
+	groups  map[string]*Group
+}
+
+// Run runs the spec test script wastFile.
+func Run(wastFile string, options *Options) (*Result, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	src, err := ioutil.ReadFile(wastFile)
+	if err != nil {
+		return nil, err
+	}
+	script, err := wat.ParseScript(src)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "spectest")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Base(wastFile)
+	r := &runner{
+		options: options,
+		name:    name,
+		base:    strings.TrimSuffix(name, filepath.Ext(name)),
+		dir:     dir,
+		groups:  map[string]*Group{},
+	}
+	if err := r.run(script); err != nil {
+		return nil, err
+	}
+
+	var result Result
+	for _, g := range r.groups {
+		result.Groups = append(result.Groups, g)
+	}
+	sort.Slice(result.Groups, func(i, j int) bool {
+		return result.Groups[i].Name < result.Groups[j].Name
+	})
+	return &result, nil
+}
+
+func (r *runner) group(name string) *Group {
+	g, ok := r.groups[name]
+	if !ok {
+		g = &Group{Name: name}
+		r.groups[name] = g
+	}
+	return g
+}
+
+func (r *runner) skip(group string) {
+	r.group(group).Skipped++
+}
+
+func (r *runner) fail(group string, c *wat.Command, format string, args ...interface{}) {
+	g := r.group(group)
+	g.Failed++
+	g.Failures = append(g.Failures, fmt.Sprintf("%s:%s: %s", r.name, c, fmt.Sprintf(format, args...)))
+}
+
+func (r *runner) run(script *wat.Script) error {
+	var mods []*module
+	modsByCmd := map[*wat.Command]*module{}
+	for _, c := range script.Commands {
+		if c.Kind != wat.CommandModule {
+			continue
+		}
+		m := r.loadModule(c, len(mods))
+		mods = append(mods, m)
+		modsByCmd[c] = m
+	}
+	if err := r.buildModules(mods); err != nil {
+		return err
+	}
+
+	var steps []*step
+	var asserts []*assertion
+	var cur *module
+	named := map[string]*module{}
+	for _, c := range script.Commands {
+		switch c.Kind {
+		case wat.CommandModule:
+			m := modsByCmd[c]
+			cur = m
+			if m.name != "" {
+				named[m.name] = m
+			}
+			if m.skip != "" || m.err != nil {
+				continue
+			}
+			m.step = len(steps)
+			steps = append(steps, &step{
+				Module:      m,
+				Instantiate: true,
+				Commit:      true,
+			})
+
+		case wat.CommandAction, wat.CommandAssertReturn, wat.CommandAssertTrap:
+			m := cur
+			if c.ModuleName != "" {
+				m = named[c.ModuleName]
+			}
+			a := &assertion{
+				cmd:    c,
+				module: m,
+				group:  r.base,
+			}
+			if m != nil {
+				a.group = groupName(m.orig, c.Field, r.base)
+			}
+			s, ok := r.newStep(a)
+			if !ok {
+				continue
+			}
+			a.step = len(steps)
+			steps = append(steps, s)
+			asserts = append(asserts, a)
+
+		case wat.CommandUnsupported:
+			switch c.Name {
+			case "assert_return", "assert_return_canonical_nan", "assert_return_arithmetic_nan", "assert_trap":
+				r.skip(r.base)
+			}
+		}
+	}
+	if len(steps) == 0 {
+		return nil
+	}
+
+	statuses, err := r.runSteps(mods, steps)
+	if err != nil {
+		return err
+	}
+	for _, a := range asserts {
+		r.check(a, statuses)
+	}
+	return nil
+}
+
+// newStep returns a step for the assertion. If the assertion cannot be executed, newStep records the result and
+// returns false.
+func (r *runner) newStep(a *assertion) (*step, bool) {
+	c := a.cmd
+	action := c.Kind == wat.CommandAction
+
+	m := a.module
+	if m == nil {
+		if !action {
+			r.skip(a.group)
+		}
+		return nil, false
+	}
+	if m.skip != "" {
+		if !action {
+			r.skip(a.group)
+		}
+		return nil, false
+	}
+	if m.err != nil {
+		if !action {
+			r.fail(a.group, c, "%v", m.err)
+		}
+		return nil, false
+	}
+
+	e, ok := m.exports[c.Field]
+	if !ok || len(e.sig.ParamTypes) != len(c.Args) || len(c.Expected) > 1 {
+		if !action {
+			r.skip(a.group)
+		}
+		return nil, false
+	}
+	a.sig = e.sig
+
+	s := &step{
+		Module:    m,
+		Export:    e.name,
+		HasResult: len(e.sig.ReturnTypes) > 0,
+		Commit:    c.Kind != wat.CommandAssertTrap,
+	}
+	for i, t := range e.sig.ParamTypes {
+		arg := c.Args[i]
+		if arg.Type != typeName(t) {
+			if !action {
+				r.skip(a.group)
+			}
+			return nil, false
+		}
+		s.Args = append(s.Args, fmt.Sprintf("FromBits<%s>(0x%xull)", cppType(t), arg.Bits))
+	}
+	return s, true
+}
+
+type stepStatus struct {
+	ok      bool
+	timeout bool
+	bits    uint64
+	detail  string
+}
+
+func (r *runner) check(a *assertion, statuses map[int]*stepStatus) {
+	c := a.cmd
+	if c.Kind == wat.CommandAction {
+		return
+	}
+
+	if st, ok := statuses[a.module.step]; !ok || !st.ok {
+		r.fail(a.group, c, "instantiating the module failed")
+		return
+	}
+
+	st, ok := statuses[a.step]
+	if !ok {
+		r.fail(a.group, c, "the harness crashed")
+		return
+	}
+
+	switch c.Kind {
+	case wat.CommandAssertReturn:
+		if !st.ok {
+			r.fail(a.group, c, "got %s, want a value", st.detail)
+			return
+		}
+		if len(c.Expected) == 0 {
+			break
+		}
+		t := a.sig.ReturnTypes[0]
+		if !match(c.Expected[0], st.bits, t) {
+			r.fail(a.group, c, "got %s, want %s", formatBits(st.bits, t), formatValue(c.Expected[0], t))
+			return
+		}
+	case wat.CommandAssertTrap:
+		if st.ok {
+			var got string
+			if len(a.sig.ReturnTypes) > 0 {
+				got = formatBits(st.bits, a.sig.ReturnTypes[0])
+			} else {
+				got = "no trap"
+			}
+			r.fail(a.group, c, "got %s, want a trap (%s)", got, c.Message)
+			return
+		}
+		if st.timeout {
+			r.fail(a.group, c, "got a timeout, want a trap (%s)", c.Message)
+			return
+		}
+	}
+	r.group(a.group).Passed++
+}
+
+// groupName returns the name of the first numeric or memory instruction in the exported function field.
+func groupName(mod *wasm.Module, field string, fallback string) string {
+	if mod == nil || mod.Export == nil || mod.Code == nil {
+		return fallback
+	}
+	e, ok := mod.Export.Entries[field]
+	if !ok || e.Kind != wasm.ExternalFunction {
+		return fallback
+	}
+	idx := int(e.Index)
+	if mod.Import != nil {
+		idx -= len(mod.Import.Entries)
+	}
+	if idx < 0 || idx >= len(mod.Code.Bodies) {
+		return fallback
+	}
+	instrs, err := disasm.Disassemble(mod.Code.Bodies[idx].Code)
+	if err != nil {
+		return fallback
+	}
+	for _, instr := range instrs {
+		// Memory instructions (0x28-0x40), and numeric instructions including the sign-extension instructions
+		// (0x45-0xc4).
+		if c := instr.Op.Code; 0x28 <= c && c <= 0x40 || 0x45 <= c && c <= 0xc4 {
+			return instr.Op.Name
+		}
+	}
+	return fallback
+}
+
+// loadModule decodes and rewrites the module defined by c.
+func (r *runner) loadModule(c *wat.Command, index int) *module {
+	m := &module{
+		Index: index,
+		name:  c.ModuleName,
+	}
+	if c.Err != nil {
+		m.skip = c.Err.Error()
+		return m
+	}
+
+	orig, err := wasm.DecodeModule(bytes.NewReader(c.Module))
+	if err != nil {
+		m.skip = err.Error()
+		return m
+	}
+	m.orig = orig
+
+	// Decode the module again as rewriteModule modifies the module.
+	mod, err := wasm.DecodeModule(bytes.NewReader(c.Module))
+	if err != nil {
+		m.skip = err.Error()
+		return m
+	}
+	exports, start, err := rewriteModule(mod)
+	if err != nil {
+		m.skip = err.Error()
+		return m
+	}
+	m.exports = exports
+	m.Start = start
+
+	var buf bytes.Buffer
+	if err := wasm.EncodeModule(&buf, mod); err != nil {
+		m.skip = err.Error()
+		return m
+	}
+	if err := ioutil.WriteFile(filepath.Join(r.dir, m.Dir()+".wasm"), buf.Bytes(), 0644); err != nil {
+		m.err = err
+		return m
+	}
+	return m
+}
+
+const startExportName = "spectest_start"
+
+// rewriteModule rewrites the module so that the exported functions can be called from the outside.
+//
+// The imported functions from the spectest module are replaced with defined functions that do nothing. As the new
+// functions are placed at the beginning of the function section, the function indices don't change. The exports
+// are renamed to valid C++ identifiers, and the start function is exported instead of being called at the
+// instantiation.
+func rewriteModule(mod *wasm.Module) (map[string]*export, bool, error) {
+	var types []uint32
+	if mod.Import != nil {
+		for _, e := range mod.Import.Entries {
+			f, ok := e.Type.(wasm.FuncImport)
+			if !ok || e.ModuleName != "spectest" {
+				return nil, false, fmt.Errorf("importing %s.%s is not supported", e.ModuleName, e.FieldName)
+			}
+			types = append(types, f.Type)
+		}
+		mod.Import.Entries = nil
+	}
+
+	if mod.Function == nil {
+		mod.Function = &wasm.SectionFunctions{}
+		setSection(mod, mod.Function)
+	}
+	if mod.Code == nil {
+		mod.Code = &wasm.SectionCode{}
+		setSection(mod, mod.Code)
+	}
+	var bodies []wasm.FunctionBody
+	for _, t := range types {
+		var code []byte
+		if len(mod.Types.Entries[t].ReturnTypes) > 0 {
+			// unreachable. The encoder adds the last end.
+			code = []byte{0x00}
+		}
+		bodies = append(bodies, wasm.FunctionBody{
+			Code: code,
+		})
+	}
+	mod.Function.Types = append(types, mod.Function.Types...)
+	mod.Code.Bodies = append(bodies, mod.Code.Bodies...)
+
+	// The exported names are used as C++ identifiers.
+	if mod.Export == nil {
+		mod.Export = &wasm.SectionExports{}
+		setSection(mod, mod.Export)
+	}
+	exports := map[string]*export{}
+	entries := map[string]wasm.ExportEntry{}
+	var names []string
+	add := func(name string, index uint32) {
+		names = append(names, name)
+		entries[name] = wasm.ExportEntry{
+			FieldStr: name,
+			Kind:     wasm.ExternalFunction,
+			Index:    index,
+		}
+	}
+	for _, n := range mod.Export.Names {
+		e := mod.Export.Entries[n]
+		if e.Kind != wasm.ExternalFunction {
+			continue
+		}
+		name := fmt.Sprintf("spectest_export%d", len(names))
+		add(name, e.Index)
+		exports[n] = &export{
+			name: name,
+			sig:  &mod.Types.Entries[mod.Function.Types[e.Index]],
+		}
+	}
+
+	var start bool
+	if mod.Start != nil {
+		add(startExportName, mod.Start.Index)
+		start = true
+		mod.Start = nil
+		for i, s := range mod.Sections {
+			if s.SectionID() == wasm.SectionIDStart {
+				mod.Sections = append(mod.Sections[:i], mod.Sections[i+1:]...)
+				break
+			}
+		}
+	}
+	mod.Export.Entries = entries
+	mod.Export.Names = names
+
+	return exports, start, nil
+}
+
+// setSection adds the section to the module in the order of the section IDs.
+func setSection(mod *wasm.Module, section wasm.Section) {
+	id := section.SectionID()
+	for i, s := range mod.Sections {
+		if s.SectionID() == wasm.SectionIDCustom {
+			continue
+		}
+		if s.SectionID() > id {
+			mod.Sections = append(mod.Sections[:i], append([]wasm.Section{section}, mod.Sections[i:]...)...)
+			return
+		}
+	}
+	mod.Sections = append(mod.Sections, section)
+}
+
+func (r *runner) cxx() (string, []string) {
+	cxx := r.options.CXX
+	if cxx == "" {
+		cxx = os.Getenv("CXX")
+	}
+	if cxx == "" {
+		cxx = "c++"
+	}
+	flags := r.options.CXXFlags
+	if flags == nil {
+		flags = []string{"-O2"}
+	}
+	return cxx, flags
+}
+
+// buildModules generates C++ for the modules and compiles them into object files in parallel.
+// The errors of the generation and the compilation are recorded in the modules.
+func (r *runner) buildModules(mods []*module) error {
+	cxx, flags := r.cxx()
+	sem := make(chan struct{}, runtime.NumCPU())
+
+	var g errgroup.Group
+	for _, m := range mods {
+		m := m
+		if m.skip != "" || m.err != nil {
+			continue
+		}
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+			}()
+
+			dir := filepath.Join(r.dir, m.Dir())
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if err := gowasm2cpp.GenerateWithOptions(dir, "", dir+".wasm", m.Namespace(), &gowasm2cpp.Options{
+				Interpreter: r.options.Interpreter,
+			}); err != nil {
+				m.err = fmt.Errorf("generating C++ failed: %v", err)
+				return nil
+			}
+
+			// Only the files for the instance are needed. The other files assume a Go program.
+			var srcs []string
+			for _, name := range []string{"bits.cpp", "bytes.cpp", "mem.cpp", "interp.cpp", "inst.*.cpp"} {
+				ms, err := filepath.Glob(filepath.Join(dir, name))
+				if err != nil {
+					return err
+				}
+				for _, s := range ms {
+					srcs = append(srcs, filepath.Base(s))
+				}
+			}
+			args := append([]string{"-std=c++14", "-w", "-I.", "-c"}, flags...)
+			args = append(args, srcs...)
+			cmd := exec.Command(cxx, args...)
+			cmd.Dir = dir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				m.err = fmt.Errorf("compiling C++ failed: %v\n%s", err, out)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// runSteps compiles the harness and runs the steps.
+func (r *runner) runSteps(mods []*module, steps []*step) (map[int]*stepStatus, error) {
+	var used []*module
+	var objs []string
+	for _, m := range mods {
+		if m.skip != "" || m.err != nil {
+			continue
+		}
+		used = append(used, m)
+		ms, err := filepath.Glob(filepath.Join(r.dir, m.Dir(), "*.o"))
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, ms...)
+	}
+
+	timeout := r.options.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	mainFile := filepath.Join(r.dir, "main.cpp")
+	f, err := os.Create(mainFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := mainCppTmpl.Execute(f, struct {
+		Modules        []*module
+		Steps          []*step
+		TimeoutSeconds int
+	}{
+		Modules:        used,
+		Steps:          steps,
+		TimeoutSeconds: int((timeout + time.Second - 1) / time.Second),
+	}); err != nil {
+		return nil, err
+	}
+
+	cxx, flags := r.cxx()
+	bin := filepath.Join(r.dir, "spectest")
+	args := append([]string{"-std=c++14", "-w", "-I" + r.dir, "-o", bin}, flags...)
+	args = append(args, mainFile)
+	args = append(args, objs...)
+	if out, err := exec.Command(cxx, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("spectest: %s: compiling the harness failed: %v\n%s", r.name, err, out)
+	}
+
+	// Each step has its own time limit. This is for the steps executed again in the harness process.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout*time.Duration(len(steps)+10))
+	defer cancel()
+
+	// The harness exits with an error when a step crashes in the harness process. The statuses of the following
+	// steps are missing in this case.
+	out, _ := exec.CommandContext(ctx, bin).Output()
+
+	statuses := map[int]*stepStatus{}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		var idx int
+		var kind string
+		var v uint64
+		if _, err := fmt.Sscanf(s.Text(), "%d %s %x", &idx, &kind, &v); err != nil {
+			return nil, fmt.Errorf("spectest: %s: unexpected output: %q: %v", r.name, s.Text(), err)
+		}
+		st := &stepStatus{}
+		switch kind {
+		case "ok":
+			st.ok = true
+			st.bits = v
+		case "signal":
+			st.detail = fmt.Sprintf("a trap (signal %d)", v)
+		case "exit":
+			st.detail = fmt.Sprintf("a trap (exit status %d)", v)
+		case "timeout":
+			st.timeout = true
+			st.detail = "a timeout"
+		default:
+			return nil, fmt.Errorf("spectest: %s: unexpected output: %q", r.name, s.Text())
+		}
+		statuses[idx] = st
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+func typeName(t wasm.ValueType) string {
+	switch t {
+	case wasm.ValueTypeI32:
+		return "i32"
+	case wasm.ValueTypeI64:
+		return "i64"
+	case wasm.ValueTypeF32:
+		return "f32"
+	case wasm.ValueTypeF64:
+		return "f64"
+	default:
+		panic("not reached")
+	}
+}
+
+func cppType(t wasm.ValueType) string {
+	switch t {
+	case wasm.ValueTypeI32:
+		return "int32_t"
+	case wasm.ValueTypeI64:
+		return "int64_t"
+	case wasm.ValueTypeF32:
+		return "float"
+	case wasm.ValueTypeF64:
+		return "double"
+	default:
+		panic("not reached")
+	}
+}
+
+// floatMasks returns the masks of the sign, the exponent and the quiet bit of the float type t.
+func floatMasks(t wasm.ValueType) (sign, exp, quiet uint64) {
+	if t == wasm.ValueTypeF32 {
+		return 1 << 31, 0x7f800000, 0x400000
+	}
+	return 1 << 63, 0x7ff0000000000000, 0x8000000000000
+}
+
+func match(want wat.Value, bits uint64, t wasm.ValueType) bool {
+	if t == wasm.ValueTypeI32 || t == wasm.ValueTypeF32 {
+		bits &= math.MaxUint32
+	}
+	sign, exp, quiet := floatMasks(t)
+	switch want.NaN {
+	case wat.NaNCanonical:
+		return bits&^sign == exp|quiet
+	case wat.NaNArithmetic:
+		return bits&exp == exp && bits&quiet != 0
+	}
+	return bits == want.Bits
+}
+
+func formatBits(bits uint64, t wasm.ValueType) string {
+	switch t {
+	case wasm.ValueTypeI32:
+		return fmt.Sprintf("i32:0x%08x", uint32(bits))
+	case wasm.ValueTypeI64:
+		return fmt.Sprintf("i64:0x%016x", bits)
+	case wasm.ValueTypeF32:
+		return fmt.Sprintf("f32:%v (0x%08x)", math.Float32frombits(uint32(bits)), uint32(bits))
+	case wasm.ValueTypeF64:
+		return fmt.Sprintf("f64:%v (0x%016x)", math.Float64frombits(bits), bits)
+	default:
+		panic("not reached")
+	}
+}
+
+func formatValue(v wat.Value, t wasm.ValueType) string {
+	switch v.NaN {
+	case wat.NaNCanonical:
+		return typeName(t) + ":nan:canonical"
+	case wat.NaNArithmetic:
+		return typeName(t) + ":nan:arithmetic"
+	}
+	return formatBits(v.Bits, t)
+}
+
+var mainCppTmpl = template.Must(template.New("main.cpp").Parse(`// Code generated by spectest. DO NOT EDIT.
+
+{{range .Modules}}#include "{{.Dir}}/inst.h"
+#include "{{.Dir}}/mem.h"
+{{end}}
+#include <signal.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include <cinttypes>
+#include <cstdio>
+#include <cstdlib>
+#include <cstring>
+#include <memory>
+
+namespace {
+
+template <typename To, typename From>
+To BitCast(From from) {
+  static_assert(sizeof(To) == sizeof(From), "sizes must match");
+  To to;
+  std::memcpy(&to, &from, sizeof(to));
+  return to;
+}
+
+template <typename T>
+T FromBits(uint64_t v);
+
+template <>
+int32_t FromBits<int32_t>(uint64_t v) {
+  return static_cast<int32_t>(static_cast<uint32_t>(v));
+}
+
+template <>
+int64_t FromBits<int64_t>(uint64_t v) {
+  return static_cast<int64_t>(v);
+}
+
+template <>
+float FromBits<float>(uint64_t v) {
+  return BitCast<float>(static_cast<uint32_t>(v));
+}
+
+template <>
+double FromBits<double>(uint64_t v) {
+  return BitCast<double>(v);
+}
+
+uint64_t ToBits(int32_t v) {
+  return static_cast<uint32_t>(v);
+}
+
+uint64_t ToBits(int64_t v) {
+  return static_cast<uint64_t>(v);
+}
+
+uint64_t ToBits(float v) {
+  return BitCast<uint32_t>(v);
+}
+
+uint64_t ToBits(double v) {
+  return BitCast<uint64_t>(v);
+}
+
+{{range .Modules}}std::unique_ptr<{{.Namespace}}::Mem> mem{{.Index}};
+std::unique_ptr<{{.Namespace}}::IImport> import{{.Index}};
+std::unique_ptr<{{.Namespace}}::Inst> inst{{.Index}};
+{{end}}
+constexpr int kNumSteps = {{len .Steps}};
+constexpr bool kCommits[] = { {{- range $i, $s := .Steps}}{{if $i}}, {{end}}{{$s.Commit}}{{end -}} };
+
+uint64_t Run(int step) {
+  switch (step) {
+{{range $i, $s := .Steps}}  case {{$i}}:
+{{if $s.Instantiate}}    mem{{$s.Module.Index}}.reset(new {{$s.Module.Namespace}}::Mem());
+    import{{$s.Module.Index}}.reset(new {{$s.Module.Namespace}}::IImport());
+    inst{{$s.Module.Index}}.reset(new {{$s.Module.Namespace}}::Inst(mem{{$s.Module.Index}}.get(), import{{$s.Module.Index}}.get()));
+{{if $s.Module.Start}}    inst{{$s.Module.Index}}->spectest_start();
+{{end}}    return 0;
+{{else if $s.HasResult}}    return ToBits(inst{{$s.Module.Index}}->{{$s.Export}}({{range $j, $a := $s.Args}}{{if $j}}, {{end}}{{$a}}{{end}}));
+{{else}}    inst{{$s.Module.Index}}->{{$s.Export}}({{range $j, $a := $s.Args}}{{if $j}}, {{end}}{{$a}}{{end}});
+    return 0;
+{{end}}{{end}}  }
+  std::fprintf(stderr, "unexpected step: %d\n", step);
+  std::abort();
+}
+
+}
+
+int main() {
+  for (int i = 0; i < kNumSteps; i++) {
+    int fds[2];
+    if (pipe(fds) != 0) {
+      std::perror("pipe");
+      return 1;
+    }
+    std::fflush(stdout);
+
+    // Run the step in a child process so that a trap doesn't stop the script.
+    pid_t pid = fork();
+    if (pid < 0) {
+      std::perror("fork");
+      return 1;
+    }
+    if (pid == 0) {
+      close(fds[0]);
+      alarm({{.TimeoutSeconds}});
+      uint64_t value = Run(i);
+      if (write(fds[1], &value, sizeof(value)) != sizeof(value)) {
+        _exit(1);
+      }
+      _exit(0);
+    }
+
+    close(fds[1]);
+    uint64_t value = 0;
+    ssize_t n = read(fds[0], &value, sizeof(value));
+    close(fds[0]);
+    int status = 0;
+    waitpid(pid, &status, 0);
+
+    if (WIFSIGNALED(status)) {
+      if (WTERMSIG(status) == SIGALRM) {
+        std::printf("%d timeout 0\n", i);
+      } else {
+        std::printf("%d signal %x\n", i, WTERMSIG(status));
+      }
+      continue;
+    }
+    if (!WIFEXITED(status) || WEXITSTATUS(status) != 0 || n != sizeof(value)) {
+      std::printf("%d exit %x\n", i, WIFEXITED(status) ? WEXITSTATUS(status) : 0);
+      continue;
+    }
+    std::printf("%d ok %" PRIx64 "\n", i, value);
+
+    // Execute the step again to update the state.
+    if (kCommits[i]) {
+      Run(i);
+    }
+  }
+  return 0;
+}
+`))
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package spectest_test
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	. "github.com/hajimehoshi/go2cpp/internal/spectest"
+)
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiling C++ takes time")
+	}
+	cxx := os.Getenv("CXX")
+	if cxx == "" {
+		cxx = "c++"
+	}
+	if _, err := exec.LookPath(cxx); err != nil {
+		t.Skip("C++ compiler is not available")
+	}
+
+	r, err := Run("testdata/basic.wast", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type counts struct {
+		Passed  int
+		Failed  int
+		Skipped int
+	}
+	want := map[string]counts{
+		// The module $m imports a function from a module other than spectest.
+		"basic":     {Passed: 2, Skipped: 1},
+		"f64.sqrt":  {Passed: 2},
+		"i32.add":   {Passed: 2},
+		"i32.div_s": {Passed: 2},
+	}
+	got := map[string]counts{}
+	for _, g := range r.Groups {
+		got[g.Name] = counts{
+			Passed:  g.Passed,
+			Failed:  g.Failed,
+			Skipped: g.Skipped,
+		}
+		for _, f := range g.Failures {
+			t.Error(f)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("groups: got: %v, want: %v", got, want)
+	}
+	for name, w := range want {
+		if g := got[name]; g != w {
+			t.Errorf("%s: got: %+v, want: %+v", name, g, w)
+		}
+	}
+}
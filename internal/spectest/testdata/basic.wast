@@ -0,0 +1,36 @@
+(module
+  (import "spectest" "print_i32" (func $print (param i32)))
+  (global $g (mut i32) (i32.const 0))
+  (func (export "add") (param i32 i32) (result i32)
+    (i32.add (local.get 0) (local.get 1)))
+  (func (export "div_s") (param i32 i32) (result i32)
+    (i32.div_s (local.get 0) (local.get 1)))
+  (func (export "sqrt") (param f64) (result f64)
+    (f64.sqrt (local.get 0)))
+  (func (export "inc")
+    (call $print (global.get $g))
+    (global.set $g (i32.add (global.get $g) (i32.const 1))))
+  (func (export "get") (result i32)
+    (global.get $g))
+  (func (export "unreachable")
+    unreachable))
+
+(assert_return (invoke "add" (i32.const 1) (i32.const 2)) (i32.const 3))
+(assert_return (invoke "add" (i32.const -1) (i32.const 1)) (i32.const 0))
+(assert_trap (invoke "div_s" (i32.const 1) (i32.const 0)) "integer divide by zero")
+(assert_return (invoke "div_s" (i32.const 7) (i32.const -2)) (i32.const -3))
+(assert_return (invoke "sqrt" (f64.const 4)) (f64.const 2))
+(assert_return (invoke "sqrt" (f64.const -1)) (f64.const nan:canonical))
+
+;; The state is kept between the invocations, but not after a trap.
+(invoke "inc")
+(assert_trap (invoke "unreachable") "unreachable")
+(invoke "inc")
+(assert_return (invoke "get") (i32.const 2))
+
+(module $m
+  (import "env" "f" (func))
+  (func (export "f") (result i32) (i32.const 1)))
+(assert_return (invoke $m "f") (i32.const 1))
+
+(assert_invalid (module (func (result i32))) "type mismatch")
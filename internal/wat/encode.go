@@ -0,0 +1,629 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package wat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+func writeUleb(buf *bytes.Buffer, v uint64) {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			b |= 0x80
+		}
+		buf.WriteByte(b)
+		if v == 0 {
+			return
+		}
+	}
+}
+
+func writeSleb(buf *bytes.Buffer, v int64) {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			buf.WriteByte(b)
+			return
+		}
+		buf.WriteByte(b | 0x80)
+	}
+}
+
+func writeName(buf *bytes.Buffer, s string) {
+	writeUleb(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+// encoder encodes instructions of a function body or a constant expression.
+type encoder struct {
+	m      *module
+	locals map[string]uint32
+	labels []string
+	buf    bytes.Buffer
+}
+
+func (e *encoder) instrs(items []*sexpr) error {
+	c := &cursor{list: items}
+	for !c.done() {
+		s := c.next()
+		if s.isList() {
+			if err := e.folded(s); err != nil {
+				return err
+			}
+			continue
+		}
+		if !s.isAtom() {
+			return errorf(s, "instruction expected but %s", s)
+		}
+		if err := e.flat(s, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flat encodes an instruction in the flat form. The immediates are read from c.
+func (e *encoder) flat(s *sexpr, c *cursor) error {
+	name := s.tok.text
+	op, ok := lookupOp(name)
+	if !ok {
+		return errorf(s, "unknown instruction %s", name)
+	}
+
+	switch op.code {
+	case 0x02, 0x03, 0x04:
+		label := c.id()
+		bt, err := e.blockType(c)
+		if err != nil {
+			return err
+		}
+		e.buf.WriteByte(op.code)
+		e.buf.WriteByte(bt)
+		e.labels = append(e.labels, label)
+		return nil
+	case 0x05:
+		if err := e.checkLabel(c, s); err != nil {
+			return err
+		}
+		e.buf.WriteByte(op.code)
+		return nil
+	case 0x0b:
+		if len(e.labels) == 0 {
+			return errorf(s, "unexpected end")
+		}
+		if err := e.checkLabel(c, s); err != nil {
+			return err
+		}
+		e.labels = e.labels[:len(e.labels)-1]
+		e.buf.WriteByte(op.code)
+		return nil
+	}
+
+	bs, err := e.op(s, op, c)
+	if err != nil {
+		return err
+	}
+	e.buf.Write(bs)
+	return nil
+}
+
+// checkLabel consumes the optional label after else or end, and checks it matches the current block.
+func (e *encoder) checkLabel(c *cursor, s *sexpr) error {
+	label := c.id()
+	if label == "" {
+		return nil
+	}
+	if len(e.labels) == 0 || e.labels[len(e.labels)-1] != label {
+		return errorf(s, "mismatching label %s", label)
+	}
+	return nil
+}
+
+// folded encodes an instruction in the folded form.
+func (e *encoder) folded(s *sexpr) error {
+	name := s.head()
+	if name == "" {
+		return errorf(s, "instruction expected but %s", s)
+	}
+	op, ok := lookupOp(name)
+	if !ok {
+		return errorf(s, "unknown instruction %s", name)
+	}
+	c := newCursor(s)
+
+	switch op.code {
+	case 0x02, 0x03:
+		label := c.id()
+		bt, err := e.blockType(c)
+		if err != nil {
+			return err
+		}
+		e.buf.WriteByte(op.code)
+		e.buf.WriteByte(bt)
+		e.labels = append(e.labels, label)
+		if err := e.instrs(c.rest()); err != nil {
+			return err
+		}
+		e.labels = e.labels[:len(e.labels)-1]
+		e.buf.WriteByte(0x0b)
+		return nil
+	case 0x04:
+		label := c.id()
+		bt, err := e.blockType(c)
+		if err != nil {
+			return err
+		}
+		// The condition.
+		for {
+			cond := c.peek()
+			if cond == nil || !cond.isList() || cond.head() == "then" {
+				break
+			}
+			c.next()
+			if err := e.folded(cond); err != nil {
+				return err
+			}
+		}
+		then := c.next()
+		if then == nil || then.head() != "then" {
+			return errorf(s, "then expected")
+		}
+		e.buf.WriteByte(op.code)
+		e.buf.WriteByte(bt)
+		e.labels = append(e.labels, label)
+		if err := e.instrs(then.list[1:]); err != nil {
+			return err
+		}
+		if els := c.next(); els != nil {
+			if els.head() != "else" {
+				return errorf(els, "else expected")
+			}
+			e.buf.WriteByte(0x05)
+			if err := e.instrs(els.list[1:]); err != nil {
+				return err
+			}
+		}
+		if !c.done() {
+			return errorf(c.peek(), "unexpected %s", c.peek())
+		}
+		e.labels = e.labels[:len(e.labels)-1]
+		e.buf.WriteByte(0x0b)
+		return nil
+	case 0x05, 0x0b:
+		return errorf(s, "unexpected %s", name)
+	}
+
+	bs, err := e.op(s, op, c)
+	if err != nil {
+		return err
+	}
+	// The rest are the operands.
+	for !c.done() {
+		arg := c.next()
+		if !arg.isList() {
+			return errorf(arg, "unexpected %s", arg)
+		}
+		if err := e.folded(arg); err != nil {
+			return err
+		}
+	}
+	e.buf.Write(bs)
+	return nil
+}
+
+// blockType parses a block type like (result i32).
+func (e *encoder) blockType(c *cursor) (byte, error) {
+	var t *funcType
+	if s := c.peek(); s != nil && s.head() == "type" {
+		c.next()
+		idx, err := resolve(newCursor(s).next(), e.m.typeNames)
+		if err != nil {
+			return 0, err
+		}
+		if int(idx) >= len(e.m.types) {
+			return 0, errorf(s, "type index out of range: %d", idx)
+		}
+		t = e.m.types[idx]
+	}
+	ft, _, err := e.m.parseSignature(c, false)
+	if err != nil {
+		return 0, err
+	}
+	if t == nil {
+		t = ft
+	}
+	if len(t.params) > 0 || len(t.results) > 1 {
+		return 0, fmt.Errorf("wat: multi-value block types are not supported")
+	}
+	if len(t.results) == 0 {
+		return blockTypeEmpty, nil
+	}
+	return t.results[0], nil
+}
+
+func (e *encoder) label(s *sexpr) (uint32, error) {
+	if s == nil {
+		return 0, fmt.Errorf("wat: label expected")
+	}
+	if s.isID() {
+		for i := len(e.labels) - 1; i >= 0; i-- {
+			if e.labels[i] == s.tok.text {
+				return uint32(len(e.labels) - 1 - i), nil
+			}
+		}
+		return 0, errorf(s, "unknown label %s", s.tok.text)
+	}
+	return parseUint32(s)
+}
+
+func isIndex(s *sexpr) bool {
+	return s != nil && (s.isID() || s.isAtom() && isNumber(s.tok.text))
+}
+
+// op encodes an instruction other than structured control instructions. The immediates are read from c.
+func (e *encoder) op(s *sexpr, op opInfo, c *cursor) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(op.code)
+	if op.prefixed {
+		writeUleb(&buf, uint64(op.sub))
+	}
+
+	switch op.imm {
+	case immNone:
+	case immLabel:
+		idx, err := e.label(c.next())
+		if err != nil {
+			return nil, err
+		}
+		writeUleb(&buf, uint64(idx))
+	case immBrTable:
+		var idxs []uint32
+		for isIndex(c.peek()) {
+			idx, err := e.label(c.next())
+			if err != nil {
+				return nil, err
+			}
+			idxs = append(idxs, idx)
+		}
+		if len(idxs) == 0 {
+			return nil, errorf(s, "br_table requires at least one label")
+		}
+		writeUleb(&buf, uint64(len(idxs)-1))
+		for _, idx := range idxs {
+			writeUleb(&buf, uint64(idx))
+		}
+	case immFunc:
+		idx, err := resolve(c.next(), e.m.funcNames)
+		if err != nil {
+			return nil, err
+		}
+		writeUleb(&buf, uint64(idx))
+	case immCallIndirect:
+		var table uint32
+		if isIndex(c.peek()) {
+			idx, err := resolve(c.next(), e.m.tableNames)
+			if err != nil {
+				return nil, err
+			}
+			table = idx
+		}
+		t, _, err := e.m.parseTypeUse(c, false)
+		if err != nil {
+			return nil, err
+		}
+		writeUleb(&buf, uint64(t))
+		writeUleb(&buf, uint64(table))
+	case immLocal:
+		idx, err := resolve(c.next(), e.locals)
+		if err != nil {
+			return nil, err
+		}
+		writeUleb(&buf, uint64(idx))
+	case immGlobal:
+		idx, err := resolve(c.next(), e.m.globalNames)
+		if err != nil {
+			return nil, err
+		}
+		writeUleb(&buf, uint64(idx))
+	case immMemArg:
+		offset := uint64(0)
+		align := op.align
+	memarg:
+		for {
+			a := c.peek()
+			if a == nil || !a.isAtom() {
+				break
+			}
+			switch {
+			case strings.HasPrefix(a.tok.text, "offset="):
+				v, err := parseUnsigned(a.tok.text[len("offset="):], 32)
+				if err != nil {
+					return nil, errorf(a, "invalid offset %s", a.tok.text)
+				}
+				offset = v
+			case strings.HasPrefix(a.tok.text, "align="):
+				v, err := parseUnsigned(a.tok.text[len("align="):], 32)
+				if err != nil || v == 0 || v&(v-1) != 0 {
+					return nil, errorf(a, "invalid alignment %s", a.tok.text)
+				}
+				align = 0
+				for v > 1 {
+					v >>= 1
+					align++
+				}
+			default:
+				break memarg
+			}
+			c.next()
+		}
+		writeUleb(&buf, uint64(align))
+		writeUleb(&buf, offset)
+	case immMemIndex:
+		buf.WriteByte(0x00)
+	case immMemCopy:
+		buf.WriteByte(0x00)
+		buf.WriteByte(0x00)
+	case immData, immMemInit:
+		idx, err := parseUint32OrNil(c.next())
+		if err != nil {
+			return nil, err
+		}
+		writeUleb(&buf, uint64(idx))
+		if op.imm == immMemInit {
+			buf.WriteByte(0x00)
+		}
+	case immI32:
+		a := c.next()
+		if a == nil {
+			return nil, errorf(s, "constant expected")
+		}
+		v, err := parseInt(a, 32)
+		if err != nil {
+			return nil, err
+		}
+		writeSleb(&buf, int64(int32(uint32(v))))
+	case immI64:
+		a := c.next()
+		if a == nil {
+			return nil, errorf(s, "constant expected")
+		}
+		v, err := parseInt(a, 64)
+		if err != nil {
+			return nil, err
+		}
+		writeSleb(&buf, int64(v))
+	case immF32:
+		a := c.next()
+		if a == nil {
+			return nil, errorf(s, "constant expected")
+		}
+		v, err := parseFloat(a, 32)
+		if err != nil {
+			return nil, err
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(v))
+		buf.Write(b[:])
+	case immF64:
+		a := c.next()
+		if a == nil {
+			return nil, errorf(s, "constant expected")
+		}
+		v, err := parseFloat(a, 64)
+		if err != nil {
+			return nil, err
+		}
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], v)
+		buf.Write(b[:])
+	default:
+		panic(fmt.Sprintf("wat: unexpected immediate kind %d", op.imm))
+	}
+	return buf.Bytes(), nil
+}
+
+func parseUint32OrNil(s *sexpr) (uint32, error) {
+	if s == nil || !s.isAtom() {
+		return 0, fmt.Errorf("wat: index expected")
+	}
+	return parseUint32(s)
+}
+
+func writeSection(buf *bytes.Buffer, id byte, content *bytes.Buffer) {
+	buf.WriteByte(id)
+	writeUleb(buf, uint64(content.Len()))
+	buf.Write(content.Bytes())
+}
+
+func writeLimits(buf *bytes.Buffer, l limits) {
+	if l.max == nil {
+		buf.WriteByte(0x00)
+		writeUleb(buf, uint64(l.min))
+		return
+	}
+	buf.WriteByte(0x01)
+	writeUleb(buf, uint64(l.min))
+	writeUleb(buf, uint64(*l.max))
+}
+
+// encode returns the module in the binary format.
+func (m *module) encode() []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00})
+
+	if len(m.types) > 0 {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(len(m.types)))
+		for _, t := range m.types {
+			s.WriteByte(0x60)
+			writeUleb(&s, uint64(len(t.params)))
+			s.Write(t.params)
+			writeUleb(&s, uint64(len(t.results)))
+			s.Write(t.results)
+		}
+		writeSection(&buf, 1, &s)
+	}
+
+	if len(m.imports) > 0 {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(len(m.imports)))
+		for _, im := range m.imports {
+			writeName(&s, im.module)
+			writeName(&s, im.field)
+			s.WriteByte(externalFunc)
+			writeUleb(&s, uint64(im.typ))
+		}
+		writeSection(&buf, 2, &s)
+	}
+
+	if len(m.funcs) > 0 {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(len(m.funcs)))
+		for _, f := range m.funcs {
+			writeUleb(&s, uint64(f.typ))
+		}
+		writeSection(&buf, 3, &s)
+	}
+
+	if len(m.tables) > 0 {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(len(m.tables)))
+		for _, t := range m.tables {
+			s.WriteByte(elemTypeFunc)
+			writeLimits(&s, t)
+		}
+		writeSection(&buf, 4, &s)
+	}
+
+	if len(m.mems) > 0 {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(len(m.mems)))
+		for _, l := range m.mems {
+			writeLimits(&s, l)
+		}
+		writeSection(&buf, 5, &s)
+	}
+
+	if len(m.globals) > 0 {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(len(m.globals)))
+		for _, g := range m.globals {
+			s.WriteByte(g.typ)
+			if g.mut {
+				s.WriteByte(0x01)
+			} else {
+				s.WriteByte(0x00)
+			}
+			s.Write(g.init)
+		}
+		writeSection(&buf, 6, &s)
+	}
+
+	if len(m.exports) > 0 {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(len(m.exports)))
+		for _, e := range m.exports {
+			writeName(&s, e.name)
+			s.WriteByte(e.kind)
+			writeUleb(&s, uint64(e.idx))
+		}
+		writeSection(&buf, 7, &s)
+	}
+
+	if m.start != nil {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(*m.start))
+		writeSection(&buf, 8, &s)
+	}
+
+	if len(m.elems) > 0 {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(len(m.elems)))
+		for _, e := range m.elems {
+			writeUleb(&s, uint64(e.table))
+			s.Write(e.offset)
+			writeUleb(&s, uint64(len(e.funcs)))
+			for _, f := range e.funcs {
+				writeUleb(&s, uint64(f))
+			}
+		}
+		writeSection(&buf, 9, &s)
+	}
+
+	if len(m.funcs) > 0 {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(len(m.funcs)))
+		for _, f := range m.funcs {
+			var body bytes.Buffer
+			// Group the consecutive locals of the same type.
+			var groups [][2]int
+			for _, t := range f.localTypes {
+				if len(groups) > 0 && groups[len(groups)-1][1] == int(t) {
+					groups[len(groups)-1][0]++
+					continue
+				}
+				groups = append(groups, [2]int{1, int(t)})
+			}
+			writeUleb(&body, uint64(len(groups)))
+			for _, g := range groups {
+				writeUleb(&body, uint64(g[0]))
+				body.WriteByte(byte(g[1]))
+			}
+			body.Write(f.code)
+			writeUleb(&s, uint64(body.Len()))
+			s.Write(body.Bytes())
+		}
+		writeSection(&buf, 10, &s)
+	}
+
+	if len(m.datas) > 0 {
+		var s bytes.Buffer
+		writeUleb(&s, uint64(len(m.datas)))
+		for _, d := range m.datas {
+			writeUleb(&s, uint64(d.mem))
+			s.Write(d.offset)
+			writeUleb(&s, uint64(len(d.bytes)))
+			s.Write(d.bytes)
+		}
+		writeSection(&buf, 11, &s)
+	}
+
+	// The name section is required as the converter uses the function names.
+	var names bytes.Buffer
+	var n int
+	for i, im := range m.imports {
+		if im.name != "" {
+			n++
+			writeUleb(&names, uint64(i))
+			writeName(&names, im.name[1:])
+		}
+	}
+	for i, f := range m.funcs {
+		if f.name != "" {
+			n++
+			writeUleb(&names, uint64(len(m.imports)+i))
+			writeName(&names, f.name[1:])
+		}
+	}
+	if n > 0 {
+		var sub bytes.Buffer
+		writeUleb(&sub, uint64(n))
+		sub.Write(names.Bytes())
+
+		var s bytes.Buffer
+		writeName(&s, "name")
+		// Function names.
+		s.WriteByte(1)
+		writeUleb(&s, uint64(sub.Len()))
+		s.Write(sub.Bytes())
+		writeSection(&buf, 0, &s)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package wat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenLParen tokenKind = iota
+	tokenRParen
+	tokenAtom
+	tokenString
+)
+
+type pos struct {
+	line int
+	col  int
+}
+
+func (p pos) String() string {
+	return fmt.Sprintf("%d:%d", p.line, p.col)
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  pos
+}
+
+func isIDChar(c byte) bool {
+	if '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-./:<=>?@\\^_`|~", c) >= 0
+}
+
+type lexer struct {
+	src  []byte
+	i    int
+	line int
+	col  int
+}
+
+func (l *lexer) pos() pos {
+	return pos{line: l.line, col: l.col}
+}
+
+func (l *lexer) advance(n int) {
+	for ; n > 0; n-- {
+		if l.src[l.i] == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+		l.i++
+	}
+}
+
+func (l *lexer) errorf(p pos, format string, args ...interface{}) error {
+	return fmt.Errorf("wat: %s: %s", p, fmt.Sprintf(format, args...))
+}
+
+func tokenize(src []byte) ([]token, error) {
+	l := &lexer{
+		src:  src,
+		line: 1,
+		col:  1,
+	}
+
+	var tokens []token
+	for l.i < len(l.src) {
+		c := l.src[l.i]
+		p := l.pos()
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.advance(1)
+		case c == ';' && l.i+1 < len(l.src) && l.src[l.i+1] == ';':
+			for l.i < len(l.src) && l.src[l.i] != '\n' {
+				l.advance(1)
+			}
+		case c == '(' && l.i+1 < len(l.src) && l.src[l.i+1] == ';':
+			// Block comments can be nested.
+			depth := 0
+			for {
+				if l.i+1 >= len(l.src) {
+					return nil, l.errorf(p, "unterminated block comment")
+				}
+				if l.src[l.i] == '(' && l.src[l.i+1] == ';' {
+					depth++
+					l.advance(2)
+					continue
+				}
+				if l.src[l.i] == ';' && l.src[l.i+1] == ')' {
+					depth--
+					l.advance(2)
+					if depth == 0 {
+						break
+					}
+					continue
+				}
+				l.advance(1)
+			}
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: p})
+			l.advance(1)
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: p})
+			l.advance(1)
+		case c == '"':
+			str, err := l.readString()
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: str, pos: p})
+		case isIDChar(c):
+			start := l.i
+			for l.i < len(l.src) && isIDChar(l.src[l.i]) {
+				l.advance(1)
+			}
+			tokens = append(tokens, token{kind: tokenAtom, text: string(l.src[start:l.i]), pos: p})
+		default:
+			return nil, l.errorf(p, "unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// readString reads a string literal and returns the decoded bytes as a string.
+func (l *lexer) readString() (string, error) {
+	p := l.pos()
+	l.advance(1)
+
+	var buf []byte
+	for {
+		if l.i >= len(l.src) {
+			return "", l.errorf(p, "unterminated string")
+		}
+		c := l.src[l.i]
+		if c == '"' {
+			l.advance(1)
+			return string(buf), nil
+		}
+		if c == '\n' {
+			return "", l.errorf(p, "newline in string")
+		}
+		if c != '\\' {
+			buf = append(buf, c)
+			l.advance(1)
+			continue
+		}
+
+		if l.i+1 >= len(l.src) {
+			return "", l.errorf(p, "unterminated string")
+		}
+		e := l.src[l.i+1]
+		switch e {
+		case 'n':
+			buf = append(buf, '\n')
+			l.advance(2)
+		case 't':
+			buf = append(buf, '\t')
+			l.advance(2)
+		case 'r':
+			buf = append(buf, '\r')
+			l.advance(2)
+		case '"', '\'', '\\':
+			buf = append(buf, e)
+			l.advance(2)
+		case 'u':
+			end := strings.IndexByte(string(l.src[l.i:]), '}')
+			if l.i+2 >= len(l.src) || l.src[l.i+2] != '{' || end < 0 {
+				return "", l.errorf(l.pos(), "invalid unicode escape")
+			}
+			v, err := strconv.ParseUint(strings.Replace(string(l.src[l.i+3:l.i+end]), "_", "", -1), 16, 32)
+			if err != nil || !utf8.ValidRune(rune(v)) {
+				return "", l.errorf(l.pos(), "invalid unicode escape")
+			}
+			var b [utf8.UTFMax]byte
+			n := utf8.EncodeRune(b[:], rune(v))
+			buf = append(buf, b[:n]...)
+			l.advance(end + 1)
+		default:
+			if l.i+2 >= len(l.src) {
+				return "", l.errorf(l.pos(), "invalid escape")
+			}
+			v, err := strconv.ParseUint(string(l.src[l.i+1:l.i+3]), 16, 8)
+			if err != nil {
+				return "", l.errorf(l.pos(), "invalid escape")
+			}
+			buf = append(buf, byte(v))
+			l.advance(3)
+		}
+	}
+}
+
+// sexpr is an S-expression: either an atom or a list.
+type sexpr struct {
+	tok  token
+	list []*sexpr
+}
+
+func (s *sexpr) isList() bool {
+	return s.tok.kind == tokenLParen
+}
+
+// isAtom reports whether s is an atom (a keyword, an identifier or a number).
+func (s *sexpr) isAtom() bool {
+	return s.tok.kind == tokenAtom
+}
+
+func (s *sexpr) isString() bool {
+	return s.tok.kind == tokenString
+}
+
+func (s *sexpr) isID() bool {
+	return s.isAtom() && strings.HasPrefix(s.tok.text, "$")
+}
+
+// head returns the keyword at the head of the list, or an empty string.
+func (s *sexpr) head() string {
+	if !s.isList() || len(s.list) == 0 || !s.list[0].isAtom() {
+		return ""
+	}
+	return s.list[0].tok.text
+}
+
+func (s *sexpr) String() string {
+	if !s.isList() {
+		if s.isString() {
+			return strconv.Quote(s.tok.text)
+		}
+		return s.tok.text
+	}
+	var strs []string
+	for _, e := range s.list {
+		strs = append(strs, e.String())
+	}
+	return "(" + strings.Join(strs, " ") + ")"
+}
+
+func parseSExprs(tokens []token) ([]*sexpr, error) {
+	var stack [][]*sexpr
+	var starts []token
+	var cur []*sexpr
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenLParen:
+			stack = append(stack, cur)
+			starts = append(starts, t)
+			cur = nil
+		case tokenRParen:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("wat: %s: unexpected )", t.pos)
+			}
+			e := &sexpr{
+				tok:  starts[len(starts)-1],
+				list: cur,
+			}
+			cur = append(stack[len(stack)-1], e)
+			stack = stack[:len(stack)-1]
+			starts = starts[:len(starts)-1]
+		default:
+			cur = append(cur, &sexpr{tok: t})
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("wat: %s: unclosed (", starts[len(starts)-1].pos)
+	}
+	return cur, nil
+}
@@ -0,0 +1,284 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package wat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CommandKind represents a kind of a command in a script.
+type CommandKind int
+
+const (
+	// CommandModule defines a module. The module becomes the target of the following actions.
+	CommandModule CommandKind = iota
+
+	// CommandAction invokes an exported function and ignores the results.
+	CommandAction
+
+	// CommandAssertReturn invokes an exported function and checks the results.
+	CommandAssertReturn
+
+	// CommandAssertTrap invokes an exported function and expects a trap.
+	CommandAssertTrap
+
+	// CommandUnsupported is a command that is not supported, such as assert_invalid or register.
+	CommandUnsupported
+)
+
+// NaNKind represents a kind of an expected NaN result.
+type NaNKind int
+
+const (
+	// NaNNone means the value is not a NaN pattern and must match the bits exactly.
+	NaNNone NaNKind = iota
+
+	// NaNCanonical matches a canonical NaN with either sign.
+	NaNCanonical
+
+	// NaNArithmetic matches a NaN whose most significant bit of the payload is set.
+	NaNArithmetic
+)
+
+// Value is an argument or an expected result of an invocation.
+type Value struct {
+	// Type is one of i32, i64, f32 and f64. Type is empty for the results of legacy assertions like
+	// assert_return_canonical_nan.
+	Type string
+
+	// Bits is the bits of the value.
+	Bits uint64
+
+	// NaN is the pattern of the expected NaN.
+	NaN NaNKind
+}
+
+// Command is a command in a script.
+type Command struct {
+	Kind CommandKind
+
+	// Line is the line number of the command.
+	Line int
+
+	// Name is the name of the command like assert_return.
+	Name string
+
+	// Module is the module in the binary format for CommandModule.
+	Module []byte
+
+	// ModuleName is the name of the defined module for CommandModule, or the name of the target module for
+	// actions. An empty name means the last defined module.
+	ModuleName string
+
+	// Err is the error at parsing the module for CommandModule, or at parsing the command for
+	// CommandUnsupported.
+	Err error
+
+	// Field is the export name of the invoked function.
+	Field string
+
+	// Args is the arguments of the invoked function.
+	Args []Value
+
+	// Expected is the expected results for CommandAssertReturn.
+	Expected []Value
+
+	// Message is the expected trap message for CommandAssertTrap.
+	Message string
+}
+
+// Script is a WebAssembly script like the spec test's .wast file.
+type Script struct {
+	Commands []*Command
+}
+
+// ParseScript parses a WebAssembly script.
+//
+// Modules and invocations are parsed. The other commands like assert_invalid, register or get are reported as
+// CommandUnsupported. An error at parsing a module is recorded in the command instead of failing the whole script.
+func ParseScript(src []byte) (*Script, error) {
+	es, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Script
+	for _, e := range es {
+		if !e.isList() {
+			return nil, errorf(e, "unexpected %s", e)
+		}
+		c := &Command{
+			Line: e.tok.pos.line,
+			Name: e.head(),
+		}
+		if err := parseCommand(c, e); err != nil {
+			c.Kind = CommandUnsupported
+			c.Err = err
+		}
+		s.Commands = append(s.Commands, c)
+	}
+	return &s, nil
+}
+
+func parseCommand(c *Command, e *sexpr) error {
+	switch c.Name {
+	case "module":
+		c.Kind = CommandModule
+		parseScriptModule(c, e)
+		return nil
+	case "invoke":
+		c.Kind = CommandAction
+		return parseInvoke(c, e)
+	case "assert_return":
+		c.Kind = CommandAssertReturn
+		if len(e.list) < 2 {
+			return errorf(e, "missing action")
+		}
+		if err := parseInvoke(c, e.list[1]); err != nil {
+			return err
+		}
+		for _, r := range e.list[2:] {
+			v, err := parseValue(r, true)
+			if err != nil {
+				return err
+			}
+			c.Expected = append(c.Expected, v)
+		}
+		return nil
+	case "assert_return_canonical_nan", "assert_return_arithmetic_nan":
+		c.Kind = CommandAssertReturn
+		if len(e.list) != 2 {
+			return errorf(e, "invalid %s", c.Name)
+		}
+		if err := parseInvoke(c, e.list[1]); err != nil {
+			return err
+		}
+		v := Value{NaN: NaNCanonical}
+		if c.Name == "assert_return_arithmetic_nan" {
+			v.NaN = NaNArithmetic
+		}
+		c.Expected = []Value{v}
+		return nil
+	case "assert_trap":
+		c.Kind = CommandAssertTrap
+		if len(e.list) != 3 || !e.list[2].isString() {
+			return errorf(e, "invalid assert_trap")
+		}
+		c.Message = e.list[2].tok.text
+		return parseInvoke(c, e.list[1])
+	}
+	return errorf(e, "unsupported command %s", c.Name)
+}
+
+// parseScriptModule parses a module command. The error is recorded in c.Err.
+func parseScriptModule(c *Command, e *sexpr) {
+	fields := e.list[1:]
+	if len(fields) > 0 && fields[0].isID() {
+		c.ModuleName = fields[0].tok.text
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && fields[0].isAtom() {
+		switch fields[0].tok.text {
+		case "binary":
+			var bin []byte
+			for _, f := range fields[1:] {
+				if !f.isString() {
+					c.Err = errorf(f, "expected a string but %s", f)
+					return
+				}
+				bin = append(bin, f.tok.text...)
+			}
+			c.Module = bin
+			return
+		default:
+			c.Err = errorf(fields[0], "unsupported module form %s", fields[0])
+			return
+		}
+	}
+	c.Module, c.Err = parseModule(fields)
+}
+
+func parseInvoke(c *Command, e *sexpr) error {
+	if e.head() != "invoke" {
+		return errorf(e, "unsupported action %s", e)
+	}
+	args := e.list[1:]
+	if len(args) > 0 && args[0].isID() {
+		c.ModuleName = args[0].tok.text
+		args = args[1:]
+	}
+	if len(args) == 0 || !args[0].isString() {
+		return errorf(e, "missing function name")
+	}
+	c.Field = args[0].tok.text
+	for _, a := range args[1:] {
+		v, err := parseValue(a, false)
+		if err != nil {
+			return err
+		}
+		c.Args = append(c.Args, v)
+	}
+	return nil
+}
+
+// parseValue parses a constant like (i32.const 1). If result is true, NaN patterns like nan:canonical are
+// accepted.
+func parseValue(s *sexpr, result bool) (Value, error) {
+	if len(s.list) != 2 || !s.list[1].isAtom() {
+		return Value{}, errorf(s, "invalid value %s", s)
+	}
+	var bits int
+	switch s.head() {
+	case "i32.const":
+		bits = 32
+	case "i64.const":
+		bits = 64
+	case "f32.const":
+		bits = 32
+	case "f64.const":
+		bits = 64
+	default:
+		return Value{}, errorf(s, "unsupported value %s", s)
+	}
+
+	v := Value{
+		Type: strings.TrimSuffix(s.head(), ".const"),
+	}
+	a := s.list[1]
+	if v.Type[0] == 'i' {
+		b, err := parseInt(a, bits)
+		if err != nil {
+			return Value{}, err
+		}
+		if bits == 32 {
+			b = uint64(uint32(b))
+		}
+		v.Bits = b
+		return v, nil
+	}
+
+	if result {
+		switch a.tok.text {
+		case "nan:canonical":
+			v.NaN = NaNCanonical
+			return v, nil
+		case "nan:arithmetic":
+			v.NaN = NaNArithmetic
+			return v, nil
+		}
+	}
+	b, err := parseFloat(a, bits)
+	if err != nil {
+		return Value{}, err
+	}
+	v.Bits = b
+	return v, nil
+}
+
+func (c *Command) String() string {
+	if c.Field == "" {
+		return fmt.Sprintf("%d: %s", c.Line, c.Name)
+	}
+	return fmt.Sprintf("%d: %s %q", c.Line, c.Name, c.Field)
+}
@@ -0,0 +1,940 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package wat parses the WebAssembly text format.
+//
+// Parse converts a text module into the binary format so that the module can be decoded in the same way as a binary
+// module. Only the features that the converter supports are accepted: function imports, a table of funcref, a
+// memory, globals, exports, a start function, active element and data segments, and the MVP instructions plus the
+// sign-extension, non-trapping float-to-int and bulk memory instructions. Both the flat and the folded forms of
+// instructions are accepted.
+//
+// ParseScript parses a script like the spec test's .wast file, which is a sequence of modules and assertions.
+package wat
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	valueTypeI32 = 0x7f
+	valueTypeI64 = 0x7e
+	valueTypeF32 = 0x7d
+	valueTypeF64 = 0x7c
+
+	blockTypeEmpty = 0x40
+	elemTypeFunc   = 0x70
+)
+
+const (
+	externalFunc   = 0
+	externalTable  = 1
+	externalMemory = 2
+	externalGlobal = 3
+)
+
+type funcType struct {
+	params  []byte
+	results []byte
+}
+
+func (t *funcType) equal(u *funcType) bool {
+	return bytes.Equal(t.params, u.params) && bytes.Equal(t.results, u.results)
+}
+
+type importFunc struct {
+	module string
+	field  string
+	name   string
+	typ    uint32
+	decl   *sexpr
+	// inline is true if the import is written like (func $f (import "m" "n") ...).
+	inline bool
+}
+
+type function struct {
+	name       string
+	typ        uint32
+	localTypes []byte
+	localNames map[string]uint32
+	decl       *sexpr
+	// body is the index of the first instruction in decl.list.
+	body int
+	code []byte
+}
+
+type limits struct {
+	min uint32
+	max *uint32
+}
+
+type global struct {
+	typ  byte
+	mut  bool
+	init []byte
+}
+
+type export struct {
+	name string
+	kind byte
+	idx  uint32
+}
+
+type elem struct {
+	table  uint32
+	offset []byte
+	funcs  []uint32
+}
+
+type data struct {
+	mem    uint32
+	offset []byte
+	bytes  []byte
+}
+
+type module struct {
+	types     []*funcType
+	typeNames map[string]uint32
+
+	imports   []*importFunc
+	funcs     []*function
+	funcNames map[string]uint32
+
+	tables     []limits
+	tableNames map[string]uint32
+
+	mems     []limits
+	memNames map[string]uint32
+
+	globals     []*global
+	globalNames map[string]uint32
+
+	exports []export
+	start   *uint32
+	elems   []elem
+	datas   []data
+}
+
+func errorf(s *sexpr, format string, args ...interface{}) error {
+	return fmt.Errorf("wat: %s: %s", s.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// Parse parses the WebAssembly text format and returns the module in the binary format.
+func Parse(src []byte) ([]byte, error) {
+	es, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := es
+	if len(es) == 1 && es[0].head() == "module" {
+		fields = es[0].list[1:]
+		if len(fields) > 0 && fields[0].isID() {
+			fields = fields[1:]
+		}
+	}
+	return parseModule(fields)
+}
+
+func parse(src []byte) ([]*sexpr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	return parseSExprs(tokens)
+}
+
+// parseModule parses the module fields and returns the module in the binary format.
+func parseModule(fields []*sexpr) ([]byte, error) {
+	for _, f := range fields {
+		if !f.isList() {
+			return nil, errorf(f, "unexpected %s", f)
+		}
+	}
+
+	m := &module{
+		typeNames:   map[string]uint32{},
+		funcNames:   map[string]uint32{},
+		tableNames:  map[string]uint32{},
+		memNames:    map[string]uint32{},
+		globalNames: map[string]uint32{},
+	}
+	if err := m.declare(fields); err != nil {
+		return nil, err
+	}
+	if err := m.define(fields); err != nil {
+		return nil, err
+	}
+	return m.encode(), nil
+}
+
+// declare collects the types and the names of the module fields.
+// As a field can refer to a field defined later, the names must be known before parsing the fields.
+func (m *module) declare(fields []*sexpr) error {
+	var funcs []*sexpr
+	for _, f := range fields {
+		switch f.head() {
+		case "type":
+			c := newCursor(f)
+			name := c.id()
+			t := c.next()
+			if t == nil || t.head() != "func" {
+				return errorf(f, "type must be a func type")
+			}
+			ft, _, err := m.parseSignature(newCursor(t), false)
+			if err != nil {
+				return err
+			}
+			if name != "" {
+				m.typeNames[name] = uint32(len(m.types))
+			}
+			m.types = append(m.types, ft)
+			if !c.done() {
+				return errorf(f, "unexpected %s", c.peek())
+			}
+		case "import":
+			c := newCursor(f)
+			if len(c.rest()) != 3 || !c.rest()[0].isString() || !c.rest()[1].isString() {
+				return errorf(f, "invalid import")
+			}
+			desc := c.rest()[2]
+			if desc.head() != "func" {
+				return errorf(desc, "only function imports are supported")
+			}
+			name := newCursor(desc).id()
+			if name != "" {
+				m.funcNames[name] = uint32(len(m.imports))
+			}
+			m.imports = append(m.imports, &importFunc{
+				module: c.rest()[0].tok.text,
+				field:  c.rest()[1].tok.text,
+				name:   name,
+				decl:   desc,
+			})
+		case "func":
+			c := newCursor(f)
+			name := c.id()
+			c.exports()
+			if im := c.peek(); im != nil && im.head() == "import" {
+				ic := newCursor(im)
+				if len(ic.rest()) != 2 || !ic.rest()[0].isString() || !ic.rest()[1].isString() {
+					return errorf(im, "invalid import")
+				}
+				if name != "" {
+					m.funcNames[name] = uint32(len(m.imports))
+				}
+				m.imports = append(m.imports, &importFunc{
+					module: ic.rest()[0].tok.text,
+					field:  ic.rest()[1].tok.text,
+					name:   name,
+					decl:   f,
+					inline: true,
+				})
+				continue
+			}
+			funcs = append(funcs, f)
+		case "table":
+			if name := newCursor(f).id(); name != "" {
+				m.tableNames[name] = uint32(len(m.tables))
+			}
+			m.tables = append(m.tables, limits{})
+		case "memory":
+			if name := newCursor(f).id(); name != "" {
+				m.memNames[name] = uint32(len(m.mems))
+			}
+			m.mems = append(m.mems, limits{})
+		case "global":
+			if name := newCursor(f).id(); name != "" {
+				m.globalNames[name] = uint32(len(m.globals))
+			}
+			m.globals = append(m.globals, &global{})
+		case "export", "start", "elem", "data":
+		default:
+			return errorf(f, "unexpected module field %s", f.head())
+		}
+	}
+
+	// The imported functions precede the defined functions in the index space.
+	for _, f := range funcs {
+		name := newCursor(f).id()
+		if name != "" {
+			m.funcNames[name] = uint32(len(m.imports) + len(m.funcs))
+		}
+		m.funcs = append(m.funcs, &function{
+			name: name,
+			decl: f,
+		})
+	}
+	return nil
+}
+
+// define parses the module fields.
+func (m *module) define(fields []*sexpr) error {
+	for i, im := range m.imports {
+		c := newCursor(im.decl)
+		c.id()
+		if im.inline {
+			for _, e := range c.exports() {
+				m.exports = append(m.exports, export{name: e, kind: externalFunc, idx: uint32(i)})
+			}
+			// Skip (import "m" "n").
+			c.next()
+		}
+		t, _, err := m.parseTypeUse(c, true)
+		if err != nil {
+			return err
+		}
+		im.typ = t
+		if !c.done() {
+			return errorf(c.peek(), "unexpected %s", c.peek())
+		}
+	}
+
+	for i, f := range m.funcs {
+		c := newCursor(f.decl)
+		c.id()
+		for _, e := range c.exports() {
+			m.exports = append(m.exports, export{name: e, kind: externalFunc, idx: uint32(len(m.imports) + i)})
+		}
+		t, paramNames, err := m.parseTypeUse(c, true)
+		if err != nil {
+			return err
+		}
+		f.typ = t
+		f.localNames = paramNames
+		n := uint32(len(m.types[t].params))
+		for {
+			l := c.peek()
+			if l == nil || l.head() != "local" {
+				break
+			}
+			c.next()
+			lc := newCursor(l)
+			if name := lc.id(); name != "" {
+				vt, err := parseValueType(lc.next())
+				if err != nil {
+					return err
+				}
+				f.localNames[name] = n
+				f.localTypes = append(f.localTypes, vt)
+				n++
+				continue
+			}
+			for !lc.done() {
+				vt, err := parseValueType(lc.next())
+				if err != nil {
+					return err
+				}
+				f.localTypes = append(f.localTypes, vt)
+				n++
+			}
+		}
+		f.body = c.i
+	}
+
+	var tableIndex, memIndex, globalIndex uint32
+	for _, f := range fields {
+		switch f.head() {
+		case "func":
+		case "table":
+			if err := m.defineTable(f, tableIndex); err != nil {
+				return err
+			}
+			tableIndex++
+		case "memory":
+			if err := m.defineMemory(f, memIndex); err != nil {
+				return err
+			}
+			memIndex++
+		case "global":
+			if err := m.defineGlobal(f, globalIndex); err != nil {
+				return err
+			}
+			globalIndex++
+		case "export":
+			c := newCursor(f)
+			name := c.next()
+			desc := c.next()
+			if name == nil || !name.isString() || desc == nil || !desc.isList() || !c.done() {
+				return errorf(f, "invalid export")
+			}
+			dc := newCursor(desc)
+			idx := dc.next()
+			if idx == nil || !dc.done() {
+				return errorf(desc, "invalid export")
+			}
+			e := export{name: name.tok.text}
+			var err error
+			switch desc.head() {
+			case "func":
+				e.kind = externalFunc
+				e.idx, err = resolve(idx, m.funcNames)
+			case "table":
+				e.kind = externalTable
+				e.idx, err = resolve(idx, m.tableNames)
+			case "memory":
+				e.kind = externalMemory
+				e.idx, err = resolve(idx, m.memNames)
+			case "global":
+				e.kind = externalGlobal
+				e.idx, err = resolve(idx, m.globalNames)
+			default:
+				return errorf(desc, "unexpected export kind %s", desc.head())
+			}
+			if err != nil {
+				return err
+			}
+			m.exports = append(m.exports, e)
+		case "start":
+			c := newCursor(f)
+			idx, err := resolve(c.next(), m.funcNames)
+			if err != nil {
+				return err
+			}
+			m.start = &idx
+		case "elem":
+			if err := m.defineElem(f); err != nil {
+				return err
+			}
+		case "data":
+			if err := m.defineData(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, f := range m.funcs {
+		e := &encoder{
+			m:      m,
+			locals: f.localNames,
+		}
+		if err := e.instrs(f.decl.list[f.body:]); err != nil {
+			return err
+		}
+		e.buf.WriteByte(0x0b)
+		f.code = e.buf.Bytes()
+	}
+	return nil
+}
+
+func (m *module) defineTable(f *sexpr, idx uint32) error {
+	c := newCursor(f)
+	c.id()
+	for _, e := range c.exports() {
+		m.exports = append(m.exports, export{name: e, kind: externalTable, idx: idx})
+	}
+	if t := c.peek(); t != nil && t.isAtom() && isElemType(t.tok.text) {
+		// (table funcref (elem $f ...))
+		c.next()
+		es := c.next()
+		if es == nil || es.head() != "elem" || !c.done() {
+			return errorf(f, "invalid table")
+		}
+		var funcs []uint32
+		for _, x := range es.list[1:] {
+			idx, err := resolve(x, m.funcNames)
+			if err != nil {
+				return err
+			}
+			funcs = append(funcs, idx)
+		}
+		n := uint32(len(funcs))
+		m.tables[idx] = limits{min: n, max: &n}
+		m.elems = append(m.elems, elem{
+			table:  idx,
+			offset: []byte{0x41, 0x00, 0x0b},
+			funcs:  funcs,
+		})
+		return nil
+	}
+	l, err := parseLimits(c)
+	if err != nil {
+		return err
+	}
+	t := c.next()
+	if t == nil || !t.isAtom() || !isElemType(t.tok.text) || !c.done() {
+		return errorf(f, "invalid table")
+	}
+	m.tables[idx] = l
+	return nil
+}
+
+func (m *module) defineMemory(f *sexpr, idx uint32) error {
+	c := newCursor(f)
+	c.id()
+	for _, e := range c.exports() {
+		m.exports = append(m.exports, export{name: e, kind: externalMemory, idx: idx})
+	}
+	if d := c.peek(); d != nil && d.head() == "data" {
+		// (memory (data "..."))
+		c.next()
+		var bs []byte
+		for _, s := range d.list[1:] {
+			if !s.isString() {
+				return errorf(s, "string expected")
+			}
+			bs = append(bs, s.tok.text...)
+		}
+		const pageSize = 64 * 1024
+		n := uint32((len(bs) + pageSize - 1) / pageSize)
+		m.mems[idx] = limits{min: n, max: &n}
+		m.datas = append(m.datas, data{
+			mem:    idx,
+			offset: []byte{0x41, 0x00, 0x0b},
+			bytes:  bs,
+		})
+		return nil
+	}
+	l, err := parseLimits(c)
+	if err != nil {
+		return err
+	}
+	if !c.done() {
+		return errorf(c.peek(), "unexpected %s", c.peek())
+	}
+	m.mems[idx] = l
+	return nil
+}
+
+func (m *module) defineGlobal(f *sexpr, idx uint32) error {
+	c := newCursor(f)
+	c.id()
+	for _, e := range c.exports() {
+		m.exports = append(m.exports, export{name: e, kind: externalGlobal, idx: idx})
+	}
+	t := c.next()
+	if t == nil {
+		return errorf(f, "global type expected")
+	}
+	g := m.globals[idx]
+	if t.head() == "mut" {
+		if len(t.list) != 2 {
+			return errorf(t, "invalid global type")
+		}
+		g.mut = true
+		t = t.list[1]
+	}
+	vt, err := parseValueType(t)
+	if err != nil {
+		return err
+	}
+	g.typ = vt
+	init, err := m.constExpr(c.rest())
+	if err != nil {
+		return err
+	}
+	g.init = init
+	return nil
+}
+
+func (m *module) defineElem(f *sexpr) error {
+	c := newCursor(f)
+	c.id()
+	var table uint32
+	if t := c.peek(); t != nil && t.head() == "table" {
+		c.next()
+		idx, err := resolve(newCursor(t).next(), m.tableNames)
+		if err != nil {
+			return err
+		}
+		table = idx
+	} else if t != nil && (t.isID() || t.isAtom() && isNumber(t.tok.text)) {
+		c.next()
+		idx, err := resolve(t, m.tableNames)
+		if err != nil {
+			return err
+		}
+		table = idx
+	}
+	offset, err := m.offsetExpr(c)
+	if err != nil {
+		return err
+	}
+	if k := c.peek(); k != nil && k.isAtom() && k.tok.text == "func" {
+		c.next()
+	}
+	var funcs []uint32
+	for !c.done() {
+		idx, err := resolve(c.next(), m.funcNames)
+		if err != nil {
+			return err
+		}
+		funcs = append(funcs, idx)
+	}
+	m.elems = append(m.elems, elem{
+		table:  table,
+		offset: offset,
+		funcs:  funcs,
+	})
+	return nil
+}
+
+func (m *module) defineData(f *sexpr) error {
+	c := newCursor(f)
+	c.id()
+	var mem uint32
+	if t := c.peek(); t != nil && t.head() == "memory" {
+		c.next()
+		idx, err := resolve(newCursor(t).next(), m.memNames)
+		if err != nil {
+			return err
+		}
+		mem = idx
+	} else if t != nil && (t.isID() || t.isAtom() && isNumber(t.tok.text)) {
+		c.next()
+		idx, err := resolve(t, m.memNames)
+		if err != nil {
+			return err
+		}
+		mem = idx
+	}
+	if t := c.peek(); t == nil || !t.isList() {
+		return errorf(f, "passive data segments are not supported")
+	}
+	offset, err := m.offsetExpr(c)
+	if err != nil {
+		return err
+	}
+	var bs []byte
+	for !c.done() {
+		s := c.next()
+		if !s.isString() {
+			return errorf(s, "string expected")
+		}
+		bs = append(bs, s.tok.text...)
+	}
+	m.datas = append(m.datas, data{
+		mem:    mem,
+		offset: offset,
+		bytes:  bs,
+	})
+	return nil
+}
+
+// offsetExpr parses an offset like (offset (i32.const 0)) or (i32.const 0).
+func (m *module) offsetExpr(c *cursor) ([]byte, error) {
+	o := c.next()
+	if o == nil || !o.isList() {
+		return nil, fmt.Errorf("wat: offset expected")
+	}
+	if o.head() == "offset" {
+		return m.constExpr(o.list[1:])
+	}
+	return m.constExpr([]*sexpr{o})
+}
+
+func (m *module) constExpr(instrs []*sexpr) ([]byte, error) {
+	e := &encoder{
+		m: m,
+	}
+	if err := e.instrs(instrs); err != nil {
+		return nil, err
+	}
+	e.buf.WriteByte(0x0b)
+	return e.buf.Bytes(), nil
+}
+
+// parseTypeUse parses a type use like (type $t) (param i32) (result i32), and returns the type index.
+// If the type use doesn't have a type index, a matching type is used or a new type is added.
+func (m *module) parseTypeUse(c *cursor, allowNames bool) (uint32, map[string]uint32, error) {
+	var idx *uint32
+	if t := c.peek(); t != nil && t.head() == "type" {
+		c.next()
+		tc := newCursor(t)
+		i, err := resolve(tc.next(), m.typeNames)
+		if err != nil {
+			return 0, nil, err
+		}
+		if int(i) >= len(m.types) {
+			return 0, nil, errorf(t, "type index out of range: %d", i)
+		}
+		idx = &i
+	}
+	ft, names, err := m.parseSignature(c, allowNames)
+	if err != nil {
+		return 0, nil, err
+	}
+	if idx != nil {
+		if (len(ft.params) > 0 || len(ft.results) > 0) && !ft.equal(m.types[*idx]) {
+			return 0, nil, fmt.Errorf("wat: inline function type doesn't match the type %d", *idx)
+		}
+		return *idx, names, nil
+	}
+	for i, t := range m.types {
+		if t.equal(ft) {
+			return uint32(i), names, nil
+		}
+	}
+	m.types = append(m.types, ft)
+	return uint32(len(m.types) - 1), names, nil
+}
+
+// parseSignature parses params and results.
+func (m *module) parseSignature(c *cursor, allowNames bool) (*funcType, map[string]uint32, error) {
+	ft := &funcType{}
+	names := map[string]uint32{}
+	for {
+		p := c.peek()
+		if p == nil || p.head() != "param" {
+			break
+		}
+		c.next()
+		pc := newCursor(p)
+		if name := pc.id(); name != "" {
+			if !allowNames {
+				return nil, nil, errorf(p, "named parameters are not allowed here")
+			}
+			vt, err := parseValueType(pc.next())
+			if err != nil {
+				return nil, nil, err
+			}
+			names[name] = uint32(len(ft.params))
+			ft.params = append(ft.params, vt)
+			continue
+		}
+		for !pc.done() {
+			vt, err := parseValueType(pc.next())
+			if err != nil {
+				return nil, nil, err
+			}
+			ft.params = append(ft.params, vt)
+		}
+	}
+	for {
+		r := c.peek()
+		if r == nil || r.head() != "result" {
+			break
+		}
+		c.next()
+		rc := newCursor(r)
+		for !rc.done() {
+			vt, err := parseValueType(rc.next())
+			if err != nil {
+				return nil, nil, err
+			}
+			ft.results = append(ft.results, vt)
+		}
+	}
+	return ft, names, nil
+}
+
+func parseLimits(c *cursor) (limits, error) {
+	min := c.next()
+	if min == nil || !min.isAtom() {
+		return limits{}, fmt.Errorf("wat: limits expected")
+	}
+	v, err := parseUint32(min)
+	if err != nil {
+		return limits{}, err
+	}
+	l := limits{min: v}
+	if max := c.peek(); max != nil && max.isAtom() && isNumber(max.tok.text) {
+		c.next()
+		v, err := parseUint32(max)
+		if err != nil {
+			return limits{}, err
+		}
+		l.max = &v
+	}
+	return l, nil
+}
+
+func isElemType(s string) bool {
+	return s == "funcref" || s == "anyfunc"
+}
+
+func parseValueType(s *sexpr) (byte, error) {
+	if s == nil {
+		return 0, fmt.Errorf("wat: value type expected")
+	}
+	if s.isAtom() {
+		switch s.tok.text {
+		case "i32":
+			return valueTypeI32, nil
+		case "i64":
+			return valueTypeI64, nil
+		case "f32":
+			return valueTypeF32, nil
+		case "f64":
+			return valueTypeF64, nil
+		}
+	}
+	return 0, errorf(s, "invalid value type %s", s)
+}
+
+// resolve returns the index that s represents. s is either a number or an identifier.
+func resolve(s *sexpr, names map[string]uint32) (uint32, error) {
+	if s == nil {
+		return 0, fmt.Errorf("wat: index expected")
+	}
+	if s.isID() {
+		idx, ok := names[s.tok.text]
+		if !ok {
+			return 0, errorf(s, "unknown identifier %s", s.tok.text)
+		}
+		return idx, nil
+	}
+	if !s.isAtom() {
+		return 0, errorf(s, "index expected but %s", s)
+	}
+	return parseUint32(s)
+}
+
+// cursor iterates the elements of a list.
+type cursor struct {
+	list []*sexpr
+	i    int
+}
+
+// newCursor returns a cursor that points the element next to the head of the list.
+func newCursor(s *sexpr) *cursor {
+	return &cursor{
+		list: s.list,
+		i:    1,
+	}
+}
+
+func (c *cursor) peek() *sexpr {
+	if c.i >= len(c.list) {
+		return nil
+	}
+	return c.list[c.i]
+}
+
+func (c *cursor) next() *sexpr {
+	s := c.peek()
+	if s != nil {
+		c.i++
+	}
+	return s
+}
+
+func (c *cursor) done() bool {
+	return c.i >= len(c.list)
+}
+
+func (c *cursor) rest() []*sexpr {
+	return c.list[c.i:]
+}
+
+// id consumes an identifier if exists, and returns it.
+func (c *cursor) id() string {
+	if s := c.peek(); s != nil && s.isID() {
+		c.i++
+		return s.tok.text
+	}
+	return ""
+}
+
+// exports consumes inline exports like (export "name"), and returns the names.
+func (c *cursor) exports() []string {
+	var names []string
+	for {
+		s := c.peek()
+		if s == nil || s.head() != "export" || len(s.list) != 2 || !s.list[1].isString() {
+			return names
+		}
+		c.i++
+		names = append(names, s.list[1].tok.text)
+	}
+}
+
+func isNumber(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	return len(s) > 0 && '0' <= s[0] && s[0] <= '9'
+}
+
+// parseUnsigned parses an unsigned integer in the decimal or the hexadecimal form.
+func parseUnsigned(s string, bits int) (uint64, error) {
+	s = strings.Replace(s, "_", "", -1)
+	if strings.HasPrefix(s, "0x") {
+		return strconv.ParseUint(s[2:], 16, bits)
+	}
+	return strconv.ParseUint(s, 10, bits)
+}
+
+func parseUint32(s *sexpr) (uint32, error) {
+	v, err := parseUnsigned(s.tok.text, 32)
+	if err != nil {
+		return 0, errorf(s, "invalid number %s", s.tok.text)
+	}
+	return uint32(v), nil
+}
+
+// parseInt parses an integer that is either signed or unsigned, and returns the bits.
+func parseInt(s *sexpr, bits int) (uint64, error) {
+	str := s.tok.text
+	var neg bool
+	switch {
+	case strings.HasPrefix(str, "-"):
+		neg = true
+		str = str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+	v, err := parseUnsigned(str, bits)
+	if err != nil {
+		return 0, errorf(s, "invalid integer %s", s.tok.text)
+	}
+	if neg {
+		if v > 1<<uint(bits-1) {
+			return 0, errorf(s, "integer out of range %s", s.tok.text)
+		}
+		return -v, nil
+	}
+	return v, nil
+}
+
+// parseFloat parses a float and returns the bits.
+func parseFloat(s *sexpr, bits int) (uint64, error) {
+	str := strings.Replace(s.tok.text, "_", "", -1)
+	var neg bool
+	switch {
+	case strings.HasPrefix(str, "-"):
+		neg = true
+		str = str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+
+	var sign, expMask, canonical uint64
+	if bits == 32 {
+		sign, expMask, canonical = 1<<31, 0x7f800000, 0x400000
+	} else {
+		sign, expMask, canonical = 1<<63, 0x7ff0000000000000, 0x8000000000000
+	}
+	if !neg {
+		sign = 0
+	}
+
+	switch {
+	case str == "inf":
+		return sign | expMask, nil
+	case str == "nan":
+		return sign | expMask | canonical, nil
+	case strings.HasPrefix(str, "nan:0x"):
+		payload, err := strconv.ParseUint(str[len("nan:0x"):], 16, bits)
+		if err != nil || payload == 0 || payload&expMask != 0 || payload&sign != 0 {
+			return 0, errorf(s, "invalid NaN payload %s", s.tok.text)
+		}
+		return sign | expMask | payload, nil
+	}
+
+	if strings.HasPrefix(str, "0x") && !strings.ContainsAny(str, "pP") {
+		str += "p0"
+	}
+	v, err := strconv.ParseFloat(str, bits)
+	if err != nil {
+		return 0, errorf(s, "invalid float %s", s.tok.text)
+	}
+	if neg {
+		v = -v
+	}
+	if bits == 32 {
+		return uint64(math.Float32bits(float32(v))), nil
+	}
+	return math.Float64bits(v), nil
+}
@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package wat_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-interpreter/wagon/wasm"
+
+	. "github.com/hajimehoshi/go2cpp/internal/wat"
+)
+
+func TestParse(t *testing.T) {
+	src := `(module
+  (func $add (export "add") (param i32 i32) (result i32)
+    local.get 0
+    local.get 1
+    i32.add))`
+	want := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		// Type
+		0x01, 0x07, 0x01, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+		// Function
+		0x03, 0x02, 0x01, 0x00,
+		// Export
+		0x07, 0x07, 0x01, 0x03, 'a', 'd', 'd', 0x00, 0x00,
+		// Code
+		0x0a, 0x09, 0x01, 0x07, 0x00, 0x20, 0x00, 0x20, 0x01, 0x6a, 0x0b,
+		// Name
+		0x00, 0x0d, 0x04, 'n', 'a', 'm', 'e', 0x01, 0x06, 0x01, 0x00, 0x03, 'a', 'd', 'd',
+	}
+	got, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got: % x, want: % x", got, want)
+	}
+}
+
+func TestParseFolded(t *testing.T) {
+	flat := `(module
+  (func $f (param $x i32) (result i32) (local $y i32)
+    block $b
+      local.get $x
+      i32.eqz
+      br_if $b
+      local.get $x
+      i32.const -1
+      i32.add
+      local.set $y
+    end
+    local.get $y))`
+	folded := `(module
+  (func $f (param $x i32) (result i32) (local $y i32)
+    (block $b
+      (br_if $b (i32.eqz (local.get $x)))
+      (local.set $y (i32.add (local.get $x) (i32.const -1))))
+    (local.get $y)))`
+	b0, err := Parse([]byte(flat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := Parse([]byte(folded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b0, b1) {
+		t.Errorf("flat: % x, folded: % x", b0, b1)
+	}
+}
+
+func TestParseModule(t *testing.T) {
+	src := `(module
+  (type $t (func (param i32) (result i32)))
+  (import "env" "log" (func $log (param i32)))
+  (memory (export "mem") 1)
+  (data (i32.const 16) "hi\00\n")
+  (global $g (mut i32) (i32.const 7))
+  (table 2 funcref)
+  (elem (i32.const 0) $fac $f)
+  (func $fac (export "fac") (type $t)
+    (if (result i32) (i32.le_s (local.get 0) (i32.const 1))
+      (then (i32.const 1))
+      (else
+        (i32.mul (local.get 0)
+          (call $fac (i32.sub (local.get 0) (i32.const 1)))))))
+  (func $f (param i32) (result i32)
+    (call $log (global.get $g))
+    (i32.load offset=4 (local.get 0))
+    (call_indirect (type $t) (i32.const 0))))`
+	b, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod, err := wasm.DecodeModule(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(mod.Types.Entries), 2; got != want {
+		t.Errorf("len(mod.Types.Entries): got: %d, want: %d", got, want)
+	}
+	if got, want := mod.Import.Entries[0].FieldName, "log"; got != want {
+		t.Errorf("mod.Import.Entries[0].FieldName: got: %s, want: %s", got, want)
+	}
+	if got, want := mod.Export.Entries["fac"].Index, uint32(1); got != want {
+		t.Errorf(`mod.Export.Entries["fac"].Index: got: %d, want: %d`, got, want)
+	}
+	if got, want := mod.Data.Entries[0].Data, []byte("hi\x00\n"); !bytes.Equal(got, want) {
+		t.Errorf("mod.Data.Entries[0].Data: got: %q, want: %q", got, want)
+	}
+	if got, want := mod.Elements.Entries[0].Elems, []uint32{1, 2}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("mod.Elements.Entries[0].Elems: got: %v, want: %v", got, want)
+	}
+	if got, want := mod.Function.Types, []uint32{0, 0}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("mod.Function.Types: got: %v, want: %v", got, want)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	cases := []struct {
+		Src string
+		Err string
+	}{
+		{
+			Src: "(module (func i32.foo))",
+			Err: "wat: 1:15: unknown instruction i32.foo",
+		},
+		{
+			Src: "(module\n  (func (call $g)))",
+			Err: "wat: 2:15: unknown identifier $g",
+		},
+		{
+			Src: "(module (func)",
+			Err: "wat: 1:1: unclosed (",
+		},
+	}
+	for _, c := range cases {
+		_, err := Parse([]byte(c.Src))
+		if err == nil {
+			t.Errorf("Parse(%q) must return an error", c.Src)
+			continue
+		}
+		if got := err.Error(); got != c.Err {
+			t.Errorf("Parse(%q): got: %s, want: %s", c.Src, got, c.Err)
+		}
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	src := `(module $m
+  (func (export "add") (param i32 i32) (result i32)
+    (i32.add (local.get 0) (local.get 1))))
+(invoke "add" (i32.const 1) (i32.const 2))
+(assert_return (invoke $m "add" (i32.const -1) (i32.const 2)) (i32.const 1))
+(assert_return (invoke "f" (f32.const nan)) (f32.const nan:canonical))
+(assert_return_arithmetic_nan (invoke "f" (f64.const -inf)))
+(assert_trap (invoke "div" (i32.const 0)) "integer divide by zero")
+(assert_invalid (module (func (result i32))) "type mismatch")
+(module (func (param externref)))`
+	s, err := ParseScript([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := s.Commands
+	if got, want := len(cs), 8; got != want {
+		t.Fatalf("len(s.Commands): got: %d, want: %d", got, want)
+	}
+	kinds := []CommandKind{CommandModule, CommandAction, CommandAssertReturn, CommandAssertReturn, CommandAssertReturn, CommandAssertTrap, CommandUnsupported, CommandModule}
+	for i, c := range cs {
+		if got, want := c.Kind, kinds[i]; got != want {
+			t.Errorf("s.Commands[%d].Kind: got: %d, want: %d", i, got, want)
+		}
+	}
+
+	if cs[0].Err != nil || cs[0].ModuleName != "$m" || len(cs[0].Module) == 0 {
+		t.Errorf("s.Commands[0]: got: %+v", cs[0])
+	}
+	if got, want := cs[2].Args, []Value{{Type: "i32", Bits: 0xffffffff}, {Type: "i32", Bits: 2}}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("s.Commands[2].Args: got: %v, want: %v", got, want)
+	}
+	if got, want := cs[2].ModuleName, "$m"; got != want {
+		t.Errorf("s.Commands[2].ModuleName: got: %s, want: %s", got, want)
+	}
+	if got, want := cs[3].Expected, []Value{{Type: "f32", NaN: NaNCanonical}}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("s.Commands[3].Expected: got: %v, want: %v", got, want)
+	}
+	if got, want := cs[4].Expected, []Value{{NaN: NaNArithmetic}}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("s.Commands[4].Expected: got: %v, want: %v", got, want)
+	}
+	if got, want := cs[5].Message, "integer divide by zero"; got != want {
+		t.Errorf("s.Commands[5].Message: got: %s, want: %s", got, want)
+	}
+	if got, want := cs[6].Line, 9; got != want {
+		t.Errorf("s.Commands[6].Line: got: %d, want: %d", got, want)
+	}
+	if cs[7].Err == nil {
+		t.Errorf("s.Commands[7].Err must not be nil")
+	}
+}